@@ -19,3 +19,10 @@ func NewAzureOpenAIEmbedding(config map[string]interface{}) Embedder {
 func (a *AzureOpenAIEmbedding) Embed(text string) ([]float64, []float32, error) {
 	return nil, nil, errors.New("AzureOpenAIEmbedding.Embed not implemented")
 }
+
+func (a *AzureOpenAIEmbedding) Model() string {
+	if a.config.Model == nil {
+		return ""
+	}
+	return *a.config.Model
+}
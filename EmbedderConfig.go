@@ -34,3 +34,37 @@ func (ec *EmbedderConfig) ValidateConfig() error {
 		return fmt.Errorf("unsupported embedding provider: %s", ec.Provider)
 	}
 }
+
+// defaultEmbeddingModels - model used by each provider when none is configured
+var defaultEmbeddingModels = map[string]string{
+	"openai": "text-embedding-3-small",
+	"ollama": "nomic-embed-text",
+}
+
+// knownEmbeddingDims - output dimensions of well known embedding models
+var knownEmbeddingDims = map[string]int{
+	"text-embedding-3-small": 1536,
+	"text-embedding-3-large": 3072,
+	"text-embedding-ada-002": 1536,
+	"nomic-embed-text":       768,
+	"mxbai-embed-large":      1024,
+	"all-minilm":             384,
+}
+
+// Model returns the configured embedding model, or the provider default
+func (ec *EmbedderConfig) Model() string {
+	if model, ok := ec.Config["model"].(string); ok && model != "" {
+		return model
+	}
+	return defaultEmbeddingModels[ec.Provider]
+}
+
+// Dims returns the declared output dimensions of the embedder: config embedding_dims
+// or the known size of its model. ok is false if they are unknown.
+func (ec *EmbedderConfig) Dims() (dims int, ok bool) {
+	if dims, ok := configInt(ec.Config, "embedding_dims"); ok {
+		return dims, true
+	}
+	dims, ok = knownEmbeddingDims[ec.Model()]
+	return dims, ok
+}
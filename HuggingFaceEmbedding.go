@@ -19,3 +19,10 @@ func NewHuggingFaceEmbedding(config map[string]interface{}) Embedder {
 func (h *HuggingFaceEmbedding) Embed(text string) ([]float64, []float32, error) {
 	return nil, nil, errors.New("HuggingFaceEmbedding.Embed not implemented")
 }
+
+func (h *HuggingFaceEmbedding) Model() string {
+	if h.config.Model == nil {
+		return ""
+	}
+	return *h.config.Model
+}
@@ -19,3 +19,10 @@ func NewOllamaEmbedding(config map[string]interface{}) Embedder {
 func (o *OllamaEmbedding) Embed(text string) ([]float64, []float32, error) {
 	return nil, nil, errors.New("OllamaEmbedding.Embed not implemented")
 }
+
+func (o *OllamaEmbedding) Model() string {
+	if o.config.Model == nil {
+		return ""
+	}
+	return *o.config.Model
+}
@@ -37,7 +37,11 @@ func NewOpenAIEmbedding(config map[string]interface{}) Embedder {
 		apiKey = *baseConfig.APIKey
 	}
 
-	client, err := openai.New(openai.WithModel(*baseConfig.Model))
+	options := []openai.Option{openai.WithEmbeddingModel(*baseConfig.Model)}
+	if apiKey != "" {
+		options = append(options, openai.WithToken(apiKey))
+	}
+	client, err := openai.New(options...)
 	if err != nil {
 		fmt.Println("NewOpenAIEmbedding cliente fail.")
 		log.Fatal(err)
@@ -47,6 +51,10 @@ func NewOpenAIEmbedding(config map[string]interface{}) Embedder {
 	return &OpenAIEmbedding{config: &baseConfig, client: client}
 }
 
+func (o *OpenAIEmbedding) Model() string {
+	return *o.config.Model
+}
+
 func (o *OpenAIEmbedding) Embed(text string) ([]float64, []float32, error) {
 	text = strings.ReplaceAll(text, "\n", " ")
 
@@ -156,6 +156,44 @@ func (o *OpenAILLM) GenerateResponse(
 	return o.parseResponse(response, tools)
 }
 
+// GenerateStream generates a plain text answer, calling onToken with every chunk as it arrives.
+// Token counts are estimated when the API doesn't report them while streaming.
+func (o *OpenAILLM) GenerateStream(ctx context.Context, messages []llms.MessageContent, onToken func(token string) error, overrides ...llms.CallOption) (*LLMAnswer, error) {
+	options := append([]llms.CallOption{
+		llms.WithModel(*o.config.Model),
+		llms.WithTemperature(o.config.Temperature),
+		llms.WithMaxTokens(o.config.MaxTokens),
+	}, overrides...)
+	var called llms.CallOptions
+	for _, option := range options {
+		option(&called)
+	}
+	if onToken != nil {
+		options = append(options, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+			return onToken(string(chunk))
+		}))
+	}
+	response, err := o.client.GenerateContent(ctx, messages, options...)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("empty response from %s", called.Model)
+	}
+
+	answer := &LLMAnswer{Content: response.Choices[0].Content, Model: called.Model}
+	genInfo := response.Choices[0].GenerationInfo
+	answer.PromptTokens, _ = genInfo["PromptTokens"].(int)
+	answer.CompletionTokens, _ = genInfo["CompletionTokens"].(int)
+	if answer.PromptTokens == 0 {
+		answer.PromptTokens = countMessageTokens(answer.Model, messages)
+	}
+	if answer.CompletionTokens == 0 {
+		answer.CompletionTokens = llms.CountTokens(answer.Model, answer.Content)
+	}
+	return answer, nil
+}
+
 /*
 
  */
@@ -17,6 +17,11 @@ type VectorStore interface {
 	Update(vectorID string, vector []float32, payload map[string]interface{}) error
 	Delete(vectorID string) error
 	DeleteCol() error
+	VectorSize() (int, error) // size of the vectors stored in the collection
+	// Scroll returns up to limit points matching filters starting at offset ("" for the first page)
+	// and the offset of the next page, "" on the last one
+	Scroll(filters map[string]interface{}, limit int, offset string, withVectors bool) ([]SearchResult, string, error)
+	Count() (int, error) // exact number of points in the collection
 }
 
 // VectorStoreConfig -
@@ -54,3 +59,18 @@ func (vsc *VectorStoreConfig) ValidateAndCreateConfig() error {
 
 	return nil
 }
+
+// configInt reads an integer from a provider config map. Values decoded from
+// config files are float64, values set in code are int.
+func configInt(config map[string]interface{}, key string) (int, bool) {
+	switch v := config[key].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyConfig - a static API key mapped to a tenant
+type APIKeyConfig struct {
+	Key      string   `json:"key"`
+	Tenant   string   `json:"tenant"`
+	AgentIDs []string `json:"agent_ids,omitempty"` // allowed agent ids, empty or "*" allows any
+	Admin    bool     `json:"admin,omitempty"`     // admin keys can query cross-tenant endpoints like /v1/usage
+}
+
+// JWTConfig - verification of locally signed JWTs (HS256 or RS256)
+type JWTConfig struct {
+	HMACSecret       string `json:"hmac_secret,omitempty"`
+	RSAPublicKeyPath string `json:"rsa_public_key_path,omitempty"`
+	Issuer           string `json:"issuer,omitempty"`
+	Audience         string `json:"audience,omitempty"`
+	TenantClaim      string `json:"tenant_claim" default:"tenant_id"`
+	AgentIDsClaim    string `json:"agent_ids_claim" default:"agent_ids"`
+	AdminClaim       string `json:"admin_claim" default:"admin"`
+}
+
+// AuthConfig - authentication of the HTTP server and tenant isolation of Memory
+type AuthConfig struct {
+	Enabled bool           `json:"enabled" default:"false"`
+	APIKeys []APIKeyConfig `json:"api_keys,omitempty"`
+	JWT     JWTConfig      `json:"jwt"`
+}
+
+// Principal - the authenticated caller of a request
+type Principal struct {
+	Tenant   string
+	AgentIDs []string
+	Admin    bool
+}
+
+// AllowsAgent reports whether the principal may act as agentID
+func (p *Principal) AllowsAgent(agentID string) bool {
+	if len(p.AgentIDs) == 0 {
+		return true
+	}
+	for _, allowed := range p.AgentIDs {
+		if allowed == "*" || allowed == agentID {
+			return true
+		}
+	}
+	return false
+}
+
+// agentFilter restricts the memories of a tenant wide operation to the agent_ids of the
+// principal, nil if it may act as any agent
+func (p *Principal) agentFilter() *Filter {
+	if len(p.AgentIDs) == 0 || slices.Contains(p.AgentIDs, "*") {
+		return nil
+	}
+	agentIDs := make([]interface{}, len(p.AgentIDs))
+	for i, agentID := range p.AgentIDs {
+		agentIDs[i] = agentID
+	}
+	return &Filter{Field: "agent_id", In: agentIDs}
+}
+
+const principalContextKey = "memgo.principal"
+
+// Authenticator validates API keys and JWTs
+type Authenticator struct {
+	config    AuthConfig
+	rsaPubKey *rsa.PublicKey
+}
+
+// NewAuthenticator creates an Authenticator, loading the RS256 public key if configured
+func NewAuthenticator(config AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{config: config}
+	if config.JWT.TenantClaim == "" {
+		a.config.JWT.TenantClaim = "tenant_id"
+	}
+	if config.JWT.AgentIDsClaim == "" {
+		a.config.JWT.AgentIDsClaim = "agent_ids"
+	}
+	if config.JWT.AdminClaim == "" {
+		a.config.JWT.AdminClaim = "admin"
+	}
+	if config.JWT.RSAPublicKeyPath != "" {
+		pemBytes, err := os.ReadFile(config.JWT.RSAPublicKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading RSA public key: %w", err)
+		}
+		block, _ := pem.Decode(pemBytes)
+		if block == nil {
+			return nil, errors.New("error decoding RSA public key: no PEM block found")
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing RSA public key: %w", err)
+		}
+		rsaPub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("public key is not an RSA key")
+		}
+		a.rsaPubKey = rsaPub
+	}
+	return a, nil
+}
+
+// Authenticate resolves the principal of a bearer token or API key
+func (a *Authenticator) Authenticate(token string) (*Principal, error) {
+	for _, key := range a.config.APIKeys {
+		if key.Key != "" && subtle.ConstantTimeCompare([]byte(key.Key), []byte(token)) == 1 {
+			return &Principal{Tenant: key.Tenant, AgentIDs: key.AgentIDs, Admin: key.Admin}, nil
+		}
+	}
+	if strings.Count(token, ".") == 2 {
+		return a.verifyJWT(token)
+	}
+	return nil, errors.New("invalid API key")
+}
+
+func (a *Authenticator) verifyJWT(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, fmt.Errorf("invalid JWT header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT signature: %w", err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch header.Alg {
+	case "HS256":
+		if a.config.JWT.HMACSecret == "" {
+			return nil, errors.New("HS256 JWTs are not enabled")
+		}
+		mac := hmac.New(sha256.New, []byte(a.config.JWT.HMACSecret))
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("invalid JWT signature")
+		}
+	case "RS256":
+		if a.rsaPubKey == nil {
+			return nil, errors.New("RS256 JWTs are not enabled")
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(a.rsaPubKey, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, errors.New("invalid JWT signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT alg: %s", header.Alg)
+	}
+
+	claimsBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT claims: %w", err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(claimsBytes, &claims); err != nil {
+		return nil, fmt.Errorf("invalid JWT claims: %w", err)
+	}
+
+	now := float64(time.Now().Unix())
+	if exp, ok := claims["exp"].(float64); ok && now >= exp {
+		return nil, errors.New("JWT expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return nil, errors.New("JWT not valid yet")
+	}
+	if a.config.JWT.Issuer != "" && claims["iss"] != a.config.JWT.Issuer {
+		return nil, errors.New("invalid JWT issuer")
+	}
+	if a.config.JWT.Audience != "" && !jwtHasAudience(claims["aud"], a.config.JWT.Audience) {
+		return nil, errors.New("invalid JWT audience")
+	}
+
+	tenant, _ := claims[a.config.JWT.TenantClaim].(string)
+	if tenant == "" {
+		return nil, fmt.Errorf("JWT has no %s claim", a.config.JWT.TenantClaim)
+	}
+	principal := &Principal{Tenant: tenant}
+	if agentIDs, ok := claims[a.config.JWT.AgentIDsClaim].([]interface{}); ok {
+		for _, agentID := range agentIDs {
+			if s, ok := agentID.(string); ok {
+				principal.AgentIDs = append(principal.AgentIDs, s)
+			}
+		}
+	}
+	principal.Admin, _ = claims[a.config.JWT.AdminClaim].(bool)
+	return principal, nil
+}
+
+func jwtHasAudience(aud interface{}, expected string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == expected
+	case []interface{}:
+		for _, item := range v {
+			if item == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// authMiddleware authenticates every request with an "Authorization: Bearer <token>"
+// or "X-API-Key" header and stores the Principal in the gin context
+func authMiddleware(a *Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("X-API-Key")
+		if token == "" {
+			token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing credentials"})
+			return
+		}
+		principal, err := a.Authenticate(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(principalContextKey, principal)
+		c.Next()
+	}
+}
+
+// principalFrom returns the authenticated principal of the request, nil if auth is disabled
+func principalFrom(c *gin.Context) *Principal {
+	if p, ok := c.Get(principalContextKey); ok {
+		return p.(*Principal)
+	}
+	return nil
+}
+
+// tenantMemory returns the Memory scoped to the request's tenant and checks that
+// the principal may act as agentID. It answers 403 and returns nil otherwise.
+func tenantMemory(c *gin.Context, m *Memory, agentID string) *Memory {
+	principal := principalFrom(c)
+	if principal == nil {
+		return m
+	}
+	if !principal.AllowsAgent(agentID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("agent_id %q not allowed", agentID)})
+		return nil
+	}
+	return m.WithTenant(principal.Tenant)
+}
+
+// tenantWideMemory returns the Memory scoped to the request's tenant for the operations over
+// all of its memories (import, forget, time zones): principals restricted to agent_ids only
+// reach the memories of those agents, see Memory.WithFilter
+func tenantWideMemory(c *gin.Context, m *Memory) *Memory {
+	principal := principalFrom(c)
+	if principal == nil {
+		return m
+	}
+	m = m.WithTenant(principal.Tenant)
+	if f := principal.agentFilter(); f != nil {
+		m = m.WithFilter(f)
+	}
+	return m
+}
+
+// requireAdmin answers 403 unless auth is disabled or the principal is an admin
+func requireAdmin(c *gin.Context) bool {
+	if principal := principalFrom(c); principal != nil && !principal.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "admin credentials required"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func signHS256(t *testing.T, secret string, claims string) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthenticator(t *testing.T) {
+	a, err := NewAuthenticator(AuthConfig{
+		Enabled: true,
+		APIKeys: []APIKeyConfig{{Key: "k1", Tenant: "acme", AgentIDs: []string{"whatsapp"}}},
+		JWT:     JWTConfig{HMACSecret: "s3cret"},
+	})
+	assert.NoError(t, err)
+
+	p, err := a.Authenticate("k1")
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", p.Tenant)
+	assert.True(t, p.AllowsAgent("whatsapp"))
+	assert.False(t, p.AllowsAgent("http"))
+
+	_, err = a.Authenticate("k2")
+	assert.Error(t, err)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	token := signHS256(t, "s3cret", `{"tenant_id":"globex","agent_ids":["*"],"exp":`+strconv.FormatInt(exp, 10)+`}`)
+	p, err = a.Authenticate(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "globex", p.Tenant)
+	assert.True(t, p.AllowsAgent("http"))
+
+	_, err = a.Authenticate(signHS256(t, "wrong", `{"tenant_id":"globex"}`))
+	assert.Error(t, err)
+
+	expired := time.Now().Add(-time.Hour).Unix()
+	_, err = a.Authenticate(signHS256(t, "s3cret", `{"tenant_id":"globex","exp":`+strconv.FormatInt(expired, 10)+`}`))
+	assert.Error(t, err)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	m := &Memory{config: MemoryConfig{Auth: AuthConfig{Enabled: true}}}
+
+	assert.ErrorIs(t, m.applyTenant(map[string]interface{}{}), ErrTenantRequired)
+
+	acme := m.WithTenant("acme")
+	filters := map[string]interface{}{"user_id": "u1"}
+	assert.NoError(t, acme.applyTenant(filters))
+	assert.Equal(t, "acme", filters["tenant_id"])
+
+	assert.NoError(t, acme.checkTenant("1", map[string]interface{}{"tenant_id": "acme"}))
+	assert.Error(t, acme.checkTenant("1", map[string]interface{}{"tenant_id": "globex"}))
+	assert.Error(t, acme.checkTenant("1", map[string]interface{}{}))
+}
+
+func TestHistoryOfDeletedMemory(t *testing.T) {
+	db, err := sqlitemanager.NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+	config := NewMemoryConfig()
+	config.Auth.Enabled = true
+	config.Usage.Enabled = false
+	m := &Memory{config: config, vectorStore: &fakeVectorStore{points: map[string]SearchResult{}}, embeddingModel: letterEmbedder{}, db: db, scopeLocks: newScopeLocks()}
+
+	acme := m.WithTenant("acme")
+	memoryID, err := acme.createMemory("likes coffee", map[string]interface{}{"user_id": "Blas", "tenant_id": "acme"}, EventAdd)
+	assert.NoError(t, err)
+	_, err = acme.Delete(memoryID)
+	assert.NoError(t, err)
+
+	history, err := acme.History(memoryID)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	_, err = m.WithTenant("globex").History(memoryID)
+	assert.Error(t, err)
+	_, err = m.History(memoryID)
+	assert.ErrorIs(t, err, ErrTenantRequired)
+}
+
+func TestAgentRestrictedTenantWideOperations(t *testing.T) {
+	assert.Nil(t, (&Principal{Tenant: "acme"}).agentFilter())
+	assert.Nil(t, (&Principal{Tenant: "acme", AgentIDs: []string{"*"}}).agentFilter())
+
+	db, err := sqlitemanager.NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+	config := NewMemoryConfig()
+	config.Auth.Enabled = true
+	config.Usage.Enabled = false
+	store := &fakeVectorStore{points: map[string]SearchResult{}}
+	m := &Memory{config: config, vectorStore: store, embeddingModel: letterEmbedder{}, db: db, scopeLocks: newScopeLocks()}
+
+	principal := &Principal{Tenant: "acme", AgentIDs: []string{"whatsapp"}}
+	restricted := m.WithTenant(principal.Tenant).WithFilter(principal.agentFilter())
+	report, err := restricted.Import(strings.NewReader(
+		`{"id": "11111111-1111-1111-1111-111111111111", "text": "likes coffee", "user_id": "Blas", "agent_id": "whatsapp"}`+"\n"+
+			`{"id": "22222222-2222-2222-2222-222222222222", "text": "likes tea", "user_id": "Blas", "agent_id": "telegram"}`+"\n"), ImportSkip)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 1, report.Failed)
+	assert.Len(t, store.points, 1)
+}
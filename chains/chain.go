@@ -19,9 +19,14 @@ import (
 	"github.com/tmc/langchaingo/prompts"
 )
 
+// UsageFunc is called after every LLM call with the model and token counts.
+type UsageFunc func(operation string, model string, promptTokens int, completionTokens int)
+
 type Chain struct {
-	debug bool
-	gc    *gin.Context
+	debug   bool
+	gc      *gin.Context
+	onUsage UsageFunc
+	now     time.Time
 }
 
 func NewChain(debug bool, gc *gin.Context) *Chain {
@@ -31,6 +36,26 @@ func NewChain(debug bool, gc *gin.Context) *Chain {
 	}
 }
 
+// WithUsage registers a callback that receives the token usage of every LLM call.
+func (c *Chain) WithUsage(fn UsageFunc) *Chain {
+	c.onUsage = fn
+	return c
+}
+
+// WithNow sets the current time, in the time zone of the speaker, the prompts resolve relative
+// dates against (e.g. "mañana a las 17"). Defaults to time.Now().
+func (c *Chain) WithNow(now time.Time) *Chain {
+	c.now = now
+	return c
+}
+
+func (c *Chain) currentTime() time.Time {
+	if c.now.IsZero() {
+		return time.Now()
+	}
+	return c.now
+}
+
 func (c *Chain) Cb(ctx context.Context, m map[string]any) {
 	c.debugPrint("callback: " + fmt.Sprintf("%v", m))
 }
@@ -105,6 +130,7 @@ Responde en formato JSON
 	totalTokens := int(promptTokens + completionTokens)
 	c.debugPrint("Total Tokens: " + strconv.Itoa(totalTokens))
 	c.debugPrint("Token Cost: " + fmt.Sprintf("%.6f", utils.EstimateCost(model, int(promptTokens), int(completionTokens))))
+	c.reportUsage("PATTERNS_ATTENTION", model, promptTokens, completionTokens)
 
 	/* ====== OUTPUT FORMAT ====== */
 	parsedOutput := out.Choices[0].Content
@@ -142,13 +168,14 @@ func (c *Chain) MEMORY_DEDUCTION(data string) (map[string]interface{}, error) {
 	/* ====== PROMPT ====== */
 	prompt := prompts.NewPromptTemplate(
 		p.MEMORY_DEDUCTION_PROMPT_SPA,
-		[]string{"conversation"},
+		[]string{"conversation", "now"},
 	)
 
 	/* ====== DATA FORMAT ====== */
 
 	strPrompt, err := prompt.Format(map[string]any{
 		"conversation": data,
+		"now":          c.currentTime().Format("Monday 2006-01-02T15:04:05Z07:00"),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error formatting prompt: %w", err)
@@ -183,6 +210,7 @@ func (c *Chain) MEMORY_DEDUCTION(data string) (map[string]interface{}, error) {
 	totalTokens := int(promptTokens + completionTokens)
 	c.debugPrint("Total Tokens: " + strconv.Itoa(totalTokens))
 	c.debugPrint("Token Cost: " + fmt.Sprintf("%.6f", utils.EstimateCost(model, int(promptTokens), int(completionTokens))))
+	c.reportUsage("MEMORY_DEDUCTION", model, promptTokens, completionTokens)
 
 	/* ====== OUTPUT FORMAT ====== */
 	// parsedOutput, ok := out["text"].(string)
@@ -250,6 +278,167 @@ func (c *Chain) MEMORY_DEDUCTION(data string) (map[string]interface{}, error) {
 	return result, nil
 }
 
+// MEMORY_CONSOLIDATION merges the redundant memories of a cluster and summarizes it, see
+// prompts.MEMORY_CONSOLIDATION_PROMPT_SPA. The memories are numbered from 1 in the result.
+func (c *Chain) MEMORY_CONSOLIDATION(memories []string) (map[string]interface{}, error) {
+	c.debugPrint("Chain.MEMORY_CONSOLIDATION")
+	st := time.Now()
+
+	/* ====== SETTINGS ====== */
+	ctx := context.Background()
+
+	model := "gpt-4o-mini"
+
+	/* ====== LLM INSTANCE ====== */
+	llm, err := openai.New(openai.WithModel(model))
+	if err != nil {
+		return nil, fmt.Errorf("error creating LLM: %w", err)
+	}
+
+	/* ====== PROMPT ====== */
+	prompt := prompts.NewPromptTemplate(
+		p.MEMORY_CONSOLIDATION_PROMPT_SPA,
+		[]string{"memories"},
+	)
+
+	/* ====== DATA FORMAT ====== */
+	var memoriesText string
+	for i, memory := range memories {
+		memoriesText += fmt.Sprintf("%d - %s\n", i+1, memory)
+	}
+
+	strPrompt, err := prompt.Format(map[string]any{
+		"memories": memoriesText,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error formatting prompt: %w", err)
+	}
+
+	messages := []llms.MessageContent{}
+	messages = append(messages, llms.TextParts(llms.ChatMessageTypeHuman, strPrompt))
+
+	/* ====== GENERATE CONTENT ====== */
+	out, err := llm.GenerateContent(ctx, messages, llms.WithJSONMode())
+	if err != nil {
+		return nil, fmt.Errorf("error calling LLM: %w", err)
+	}
+
+	/* ====== DEBUG ====== */
+	c.debugPrint("Using model: " + model)
+	c.debugPrint("Output from LLM: " + fmt.Sprintf("%+v", out.Choices[0].Content))
+
+	genInfo := out.Choices[0].GenerationInfo
+	promptTokens, ok1 := genInfo["PromptTokens"].(int)
+	completionTokens, ok2 := genInfo["CompletionTokens"].(int)
+	if !ok1 || !ok2 {
+		log.Printf("PromptTokens or CompletionTokens not found in GenerationInfo: %+v", genInfo)
+	}
+	c.reportUsage("MEMORY_CONSOLIDATION", model, promptTokens, completionTokens)
+
+	/* ====== OUTPUT FORMAT ====== */
+	parsedOutput := out.Choices[0].Content
+	parsedOutput = strings.Trim(parsedOutput, "```json")
+	parsedOutput = strings.Trim(parsedOutput, "`")
+
+	var result map[string]interface{}
+	err = json.Unmarshal([]byte(parsedOutput), &result)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %w", err)
+	}
+
+	/* ====== OUTPUT SCHEMA ====== */
+	/*
+		{
+			"HECHOS": [{"texto": "merged fact", "memorias": [1, 3]}],
+			"RESUMEN": [{"texto": "summary", "memorias": [1, 2, 3]}]
+		}
+	*/
+
+	elapsed := time.Since(st)
+	c.debugPrint("Chain.MEMORY_CONSOLIDATION took: " + elapsed.String())
+	return result, nil
+}
+
+// GRAPH_EXTRACTION extracts the entity-relation-entity triples of a memory, see
+// prompts.GRAPH_EXTRACTION_PROMPT_SPA. entities are the names the triples should reuse.
+func (c *Chain) GRAPH_EXTRACTION(memory string, speaker string, entities []string) (map[string]interface{}, error) {
+	c.debugPrint("Chain.GRAPH_EXTRACTION")
+	st := time.Now()
+
+	/* ====== SETTINGS ====== */
+	ctx := context.Background()
+
+	model := "gpt-4o-mini"
+
+	/* ====== LLM INSTANCE ====== */
+	llm, err := openai.New(openai.WithModel(model))
+	if err != nil {
+		return nil, fmt.Errorf("error creating LLM: %w", err)
+	}
+
+	/* ====== PROMPT ====== */
+	prompt := prompts.NewPromptTemplate(
+		p.GRAPH_EXTRACTION_PROMPT_SPA,
+		[]string{"memory", "speaker", "entities"},
+	)
+
+	/* ====== DATA FORMAT ====== */
+	if speaker == "" {
+		speaker = "desconocida"
+	}
+	strPrompt, err := prompt.Format(map[string]any{
+		"memory":   memory,
+		"speaker":  speaker,
+		"entities": strings.Join(entities, ", "),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error formatting prompt: %w", err)
+	}
+
+	messages := []llms.MessageContent{}
+	messages = append(messages, llms.TextParts(llms.ChatMessageTypeHuman, strPrompt))
+
+	/* ====== GENERATE CONTENT ====== */
+	out, err := llm.GenerateContent(ctx, messages, llms.WithJSONMode())
+	if err != nil {
+		return nil, fmt.Errorf("error calling LLM: %w", err)
+	}
+
+	/* ====== DEBUG ====== */
+	c.debugPrint("Using model: " + model)
+	c.debugPrint("Output from LLM: " + fmt.Sprintf("%+v", out.Choices[0].Content))
+
+	genInfo := out.Choices[0].GenerationInfo
+	promptTokens, ok1 := genInfo["PromptTokens"].(int)
+	completionTokens, ok2 := genInfo["CompletionTokens"].(int)
+	if !ok1 || !ok2 {
+		log.Printf("PromptTokens or CompletionTokens not found in GenerationInfo: %+v", genInfo)
+	}
+	c.reportUsage("GRAPH_EXTRACTION", model, promptTokens, completionTokens)
+
+	/* ====== OUTPUT FORMAT ====== */
+	parsedOutput := out.Choices[0].Content
+	parsedOutput = strings.Trim(parsedOutput, "```json")
+	parsedOutput = strings.Trim(parsedOutput, "`")
+
+	var result map[string]interface{}
+	err = json.Unmarshal([]byte(parsedOutput), &result)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %w", err)
+	}
+
+	/* ====== OUTPUT SCHEMA ====== */
+	/*
+		{
+			"triples": [{"source": "Blas", "source_type": "persona", "relation": "trabaja_en", "target": "ITR", "target_type": "organizacion"}]
+		}
+	*/
+
+	elapsed := time.Since(st)
+	c.debugPrint("Chain.GRAPH_EXTRACTION took: " + elapsed.String())
+	return result, nil
+}
+
 func (c *Chain) MEMORY_UPDATER(existingMemories []models.MemoryItem, relevantFacts []interface{}) (*llms.ContentChoice, error) {
 	c.debugPrint("Chain.MEMORY_UPDATER")
 	st := time.Now()
@@ -355,6 +544,7 @@ func (c *Chain) MEMORY_UPDATER(existingMemories []models.MemoryItem, relevantFac
 	totalTokens := int(promptTokens + completionTokens)
 	c.debugPrint("Total Tokens: " + strconv.Itoa(totalTokens))
 	c.debugPrint("Token Cost: " + fmt.Sprintf("%.6f", utils.EstimateCost(model, int(promptTokens), int(completionTokens))))
+	c.reportUsage("MEMORY_UPDATER", model, promptTokens, completionTokens)
 
 	/*
 		// Iterate through the RelevanciaResponse to filter facts
@@ -38,6 +38,12 @@ func (c *Chain) debugPrint(message string) {
 	// }
 }
 
+func (c *Chain) reportUsage(operation string, model string, promptTokens int, completionTokens int) {
+	if c.onUsage != nil {
+		c.onUsage(operation, model, promptTokens, completionTokens)
+	}
+}
+
 // updateMessageHistory updates the message history with the assistant's
 // response and requested tool calls.
 func updateMessageHistory(messageHistory []llms.MessageContent, resp *llms.ContentResponse) []llms.MessageContent {
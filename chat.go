@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/matigumma/memGo/prompts"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// ChatTurn - a previous message of the conversation
+type ChatTurn struct {
+	Role    string `json:"role"` // user, assistant or system
+	Content string `json:"content"`
+}
+
+// ChatOptions - options of Memory.Chat
+type ChatOptions struct {
+	UserID  *string
+	AgentID *string
+	RunID   *string
+	Limit   int        // memories retrieved, defaults to 5
+	History []ChatTurn // earlier messages, oldest first
+	// Remember adds the exchange to the memory with Memory.Add once answered
+	Remember bool
+	// OnToken receives the answer as it is generated, nil to wait for the whole answer
+	OnToken func(token string) error
+}
+
+// ChatResponse - result of Memory.Chat
+type ChatResponse struct {
+	Answer    string                   `json:"answer"`
+	MemoryIDs []string                 `json:"memory_ids"` // memories cited in the answer
+	Memories  []map[string]interface{} `json:"memories"`   // memories given to the LLM
+	Added     map[string]interface{}   `json:"added,omitempty"`
+}
+
+// chatCitation matches the [n] markers the answer prompt asks the LLM to cite memories with
+var chatCitation = regexp.MustCompile(`\[(\d+)\]`)
+
+// memoryPrompt returns the answer prompt with the numbered memories, see chatCitation
+func memoryPrompt(memories []map[string]interface{}) string {
+	var prompt strings.Builder
+	prompt.WriteString(strings.TrimSpace(prompts.MEMORY_ANSWER_PROMPT))
+	prompt.WriteString("\n\nMemories:\n")
+	if len(memories) == 0 {
+		prompt.WriteString("(none)\n")
+	}
+	for i, memory := range memories {
+		fmt.Fprintf(&prompt, "[%d] %v", i+1, memory["memory"])
+		if createdAt, ok := memory["created_at"].(string); ok && createdAt != "" {
+			fmt.Fprintf(&prompt, " (%s)", createdAt)
+		}
+		prompt.WriteString("\n")
+	}
+	prompt.WriteString("\nWhen the answer uses a memory, cite it with its number in brackets, e.g. [1].")
+	return prompt.String()
+}
+
+// chatRole maps an OpenAI style role to a langchaingo message type, user by default
+func chatRole(role string) llms.ChatMessageType {
+	switch role {
+	case "assistant":
+		return llms.ChatMessageTypeAI
+	case "system", "developer":
+		return llms.ChatMessageTypeSystem
+	default:
+		return llms.ChatMessageTypeHuman
+	}
+}
+
+// chatMessages builds the LLM messages: the memory prompt, the history and the query
+func chatMessages(query string, memories []map[string]interface{}, history []ChatTurn) []llms.MessageContent {
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeSystem, memoryPrompt(memories))}
+	for _, turn := range history {
+		messages = append(messages, llms.TextParts(chatRole(turn.Role), turn.Content))
+	}
+	return append(messages, llms.TextParts(llms.ChatMessageTypeHuman, query))
+}
+
+// citedMemoryIDs returns the ids of the memories cited in answer, in order of first citation
+func citedMemoryIDs(answer string, memories []map[string]interface{}) []string {
+	ids := []string{}
+	seen := map[int]bool{}
+	for _, match := range chatCitation.FindAllStringSubmatch(answer, -1) {
+		n, _ := strconv.Atoi(match[1])
+		if n < 1 || n > len(memories) || seen[n] {
+			continue
+		}
+		seen[n] = true
+		ids = append(ids, plainPointID(fmt.Sprint(memories[n-1]["id"])))
+	}
+	return ids
+}
+
+// Chat answers query with the configured LLM, using the memories of the scope most relevant
+// to it (prompts.MEMORY_ANSWER_PROMPT). The answer is streamed to opts.OnToken when set and
+// the LLM supports it. The exchange is added to the memory when opts.Remember is true.
+func (m *Memory) Chat(ctx context.Context, query string, opts ChatOptions) (*ChatResponse, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, errors.New("query is required")
+	}
+	if opts.UserID == nil && opts.AgentID == nil && opts.RunID == nil {
+		return nil, errors.New("error: missing parameters, at least one of userID, agentID, or runID is required")
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = 5
+	}
+
+	scope := map[string]interface{}{}
+	for key, value := range map[string]*string{"user_id": opts.UserID, "agent_id": opts.AgentID, "run_id": opts.RunID} {
+		if value != nil {
+			scope[key] = *value
+		}
+	}
+	if err := m.applyTenant(scope); err != nil {
+		return nil, err
+	}
+
+	// a chat counts as one request, its Search and Add don't consume the quota again
+	if _, err := m.CheckQuota(scope, true); err != nil {
+		return nil, err
+	}
+	consumed := *m
+	consumed.quotaConsumed = true
+	m = &consumed
+
+	memories, err := m.Search(query, opts.UserID, opts.AgentID, opts.RunID, opts.Limit, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	memories = normalizeIDs(memories)
+	if memories == nil {
+		memories = []map[string]interface{}{}
+	}
+
+	answer, err := m.generate(ctx, chatMessages(query, memories, opts.History), opts.OnToken, "chat", scope)
+	if err != nil {
+		return nil, fmt.Errorf("error generating chat answer: %w", err)
+	}
+
+	result := &ChatResponse{
+		Answer:    answer.Content,
+		MemoryIDs: citedMemoryIDs(answer.Content, memories),
+		Memories:  memories,
+	}
+	if opts.Remember {
+		exchange := fmt.Sprintf("user: %s\nassistant: %s", query, answer.Content)
+		if result.Added, err = m.Add(exchange, opts.UserID, opts.AgentID, opts.RunID, nil, nil, nil, nil); err != nil {
+			return result, fmt.Errorf("error adding the exchange to the memory: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// ErrLLMOptionsUnsupported is returned when model, temperature, etc. are given to an LLM that
+// can't take them, see StreamingLLM
+var ErrLLMOptionsUnsupported = errors.New("the configured LLM provider doesn't take model, temperature, max_tokens or stop")
+
+// responseText returns the text of an LLM.GenerateResponse result: a string, or the content of
+// a response with tools
+func responseText(response interface{}) (string, error) {
+	switch r := response.(type) {
+	case string:
+		return r, nil
+	case map[string]interface{}:
+		if content, ok := r["content"].(string); ok {
+			return content, nil
+		}
+	}
+	return "", fmt.Errorf("unexpected LLM response of type %T", response)
+}
+
+// countMessageTokens estimates the prompt tokens of messages, for the LLMs that don't report them
+func countMessageTokens(model string, messages []llms.MessageContent) int {
+	tokens := 0
+	for _, message := range messages {
+		for _, part := range message.Parts {
+			if text, ok := part.(llms.TextContent); ok {
+				tokens += llms.CountTokens(model, text.Text)
+			}
+		}
+	}
+	return tokens
+}
+
+// generate calls the configured LLM for a plain text answer and records its usage for scope.
+// onToken receives the answer as it is generated, or all at once if the LLM can't stream.
+func (m *Memory) generate(ctx context.Context, messages []llms.MessageContent, onToken func(string) error, operation string, scope map[string]interface{}, options ...llms.CallOption) (*LLMAnswer, error) {
+	if streaming, ok := m.llm.(StreamingLLM); ok {
+		answer, err := streaming.GenerateStream(ctx, messages, onToken, options...)
+		if err != nil {
+			return nil, err
+		}
+		m.recordUsage("llm", operation, answer.Model, answer.PromptTokens, answer.CompletionTokens, scope)
+		return answer, nil
+	}
+	if len(options) > 0 {
+		return nil, ErrLLMOptionsUnsupported
+	}
+	response, err := m.llm.GenerateResponse(messages, nil, false, "")
+	if err != nil {
+		return nil, err
+	}
+	content, err := responseText(response)
+	if err != nil {
+		return nil, err
+	}
+	answer := &LLMAnswer{Content: content}
+	answer.Model, _ = m.config.Llm.Config["model"].(string)
+	answer.PromptTokens = countMessageTokens(answer.Model, messages)
+	answer.CompletionTokens = llms.CountTokens(answer.Model, answer.Content)
+	m.recordUsage("llm", operation, answer.Model, answer.PromptTokens, answer.CompletionTokens, scope)
+	if onToken != nil {
+		if err := onToken(answer.Content); err != nil {
+			return nil, err
+		}
+	}
+	return answer, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matigumma/memGo/models"
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestChatPromptAndCitations(t *testing.T) {
+	memories := []map[string]interface{}{
+		{"id": `uuid:"4d3c1f0e-5b8a-4f44-9d3e-2a1b0c9d8e7f"`, "memory": "Viaja a Córdoba el lunes", "created_at": "2025-01-13T09:02:00-03:00"},
+		{"id": "7", "memory": "Prefiere el café negro"},
+	}
+	history := []ChatTurn{{Role: "user", Content: "Hola"}, {Role: "assistant", Content: "Hola Blas"}}
+
+	messages := chatMessages("¿Cuándo viajo?", memories, history)
+	assert.Len(t, messages, 4)
+	assert.Equal(t, llms.ChatMessageTypeSystem, messages[0].Role)
+	system := messages[0].Parts[0].(llms.TextContent).Text
+	assert.True(t, strings.Contains(system, "[1] Viaja a Córdoba el lunes (2025-01-13T09:02:00-03:00)"))
+	assert.True(t, strings.Contains(system, "[2] Prefiere el café negro\n"))
+	assert.Equal(t, llms.ChatMessageTypeAI, messages[2].Role)
+	assert.Equal(t, llms.ChatMessageTypeHuman, messages[3].Role)
+
+	answer := "Viajás el lunes [1]. Recordá llevar café [2][1], no [3]."
+	assert.Equal(t, []string{"4d3c1f0e-5b8a-4f44-9d3e-2a1b0c9d8e7f", "7"}, citedMemoryIDs(answer, memories))
+}
+
+// plainLLM answers like OpenAILLM.GenerateResponse with tools, without streaming
+type plainLLM struct{}
+
+func (plainLLM) GenerateResponse(messages []llms.MessageContent, tools []models.Tool, jsonMode bool, toolChoice string) (interface{}, error) {
+	return map[string]interface{}{"content": "Blas likes coffee", "tool_calls": []interface{}{}}, nil
+}
+
+func TestGenerateWithoutStreaming(t *testing.T) {
+	db, err := sqlitemanager.NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+	config := NewMemoryConfig()
+	config.Usage.Enabled = true
+	m := &Memory{config: config, llm: plainLLM{}, db: db}
+	scope := map[string]interface{}{"user_id": "Blas"}
+	messages := []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "what does Blas like?")}
+
+	tokens := []string{}
+	answer, err := m.generate(context.Background(), messages, func(token string) error {
+		tokens = append(tokens, token)
+		return nil
+	}, "chat", scope)
+	assert.NoError(t, err)
+	assert.Equal(t, "Blas likes coffee", answer.Content)
+	assert.Equal(t, []string{"Blas likes coffee"}, tokens)
+
+	totals, err := m.Usage(sqlitemanager.UsageQuery{UserID: "Blas"})
+	assert.NoError(t, err)
+	assert.Len(t, totals, 1)
+	assert.Equal(t, 1, totals[0].Calls)
+	assert.Greater(t, totals[0].CompletionTokens, 0)
+
+	_, err = m.generate(context.Background(), messages, nil, "chat", scope, llms.WithTemperature(0.5))
+	assert.ErrorIs(t, err, ErrLLMOptionsUnsupported)
+}
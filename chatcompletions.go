@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// Headers selecting the memory scope of /v1/chat/completions, the "user" field is used
+// as user_id when X-MemGo-User-Id is missing
+const (
+	headerMemGoUserID  = "X-MemGo-User-Id"
+	headerMemGoAgentID = "X-MemGo-Agent-Id"
+	headerMemGoRunID   = "X-MemGo-Run-Id"
+)
+
+// completionMessage - a message of the OpenAI chat completions API. Content is a string
+// or a list of parts, only the text parts are used.
+type completionMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the text of the message content
+func (cm completionMessage) text() string {
+	var s string
+	if err := json.Unmarshal(cm.Content, &s); err == nil {
+		return s
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(cm.Content, &parts); err != nil {
+		return ""
+	}
+	texts := []string{}
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// completionRequest - the fields of an OpenAI chat completions request memGo uses. memGo
+// only proxies plain text answers, see callOptions.
+type completionRequest struct {
+	Model          string              `json:"model"`
+	Messages       []completionMessage `json:"messages"`
+	Stream         bool                `json:"stream"`
+	User           string              `json:"user"`
+	Temperature    *float64            `json:"temperature"`
+	MaxTokens      *int                `json:"max_tokens"`
+	Stop           json.RawMessage     `json:"stop"` // a string or a list of them
+	Tools          json.RawMessage     `json:"tools"`
+	ToolChoice     json.RawMessage     `json:"tool_choice"`
+	ResponseFormat *struct {
+		Type string `json:"type"`
+	} `json:"response_format"`
+}
+
+// callOptions returns the model, temperature, max_tokens and stop of the request as LLM call
+// options. Tools and response formats other than text are rejected.
+func (r completionRequest) callOptions() ([]llms.CallOption, error) {
+	if tools := strings.TrimSpace(string(r.Tools)); tools != "" && tools != "null" && tools != "[]" {
+		return nil, errors.New("tools are not supported")
+	}
+	if choice := strings.TrimSpace(string(r.ToolChoice)); choice != "" && choice != "null" && choice != `"none"` && choice != `"auto"` {
+		return nil, errors.New("tool_choice is not supported")
+	}
+	if r.ResponseFormat != nil && r.ResponseFormat.Type != "" && r.ResponseFormat.Type != "text" {
+		return nil, fmt.Errorf("response_format %s is not supported", r.ResponseFormat.Type)
+	}
+
+	options := []llms.CallOption{}
+	if r.Model != "" {
+		options = append(options, llms.WithModel(r.Model))
+	}
+	if r.Temperature != nil {
+		options = append(options, llms.WithTemperature(*r.Temperature))
+	}
+	if r.MaxTokens != nil {
+		options = append(options, llms.WithMaxTokens(*r.MaxTokens))
+	}
+	if stop := strings.TrimSpace(string(r.Stop)); stop != "" && stop != "null" {
+		var words []string
+		if err := json.Unmarshal(r.Stop, &words); err != nil {
+			var word string
+			if err := json.Unmarshal(r.Stop, &word); err != nil {
+				return nil, errors.New("stop must be a string or a list of strings")
+			}
+			words = []string{word}
+		}
+		options = append(options, llms.WithStopWords(words))
+	}
+	return options, nil
+}
+
+// proxyMemoryMessage is the system message with the memories injected before the conversation
+func proxyMemoryMessage(memories []map[string]interface{}) string {
+	var sb strings.Builder
+	sb.WriteString("Relevant memories about the user, use them when they help to answer:\n")
+	for _, memory := range memories {
+		fmt.Fprintf(&sb, "- %v", memory["memory"])
+		if createdAt, ok := memory["created_at"].(string); ok && createdAt != "" {
+			fmt.Fprintf(&sb, " (%s)", createdAt)
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// lastUserMessage returns the text of the last user message, "" if there is none
+func lastUserMessage(messages []completionMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].text()
+		}
+	}
+	return ""
+}
+
+// Handler for /v1/chat/completions
+// OpenAI compatible: the conversation is answered by the configured LLM with the memories of
+// the user (the "user" field or X-MemGo-User-Id) and agent (X-MemGo-Agent-Id) most relevant
+// to the last user message injected as a system message. The last exchange is then added to
+// the memory through the job queue. model, temperature, max_tokens and stop are passed to the
+// LLM, tools and structured response formats are answered 400.
+func chatCompletionsHandler(c *gin.Context, m *Memory) {
+	var request completionRequest
+	if err := c.ShouldBindJSON(&request); err != nil || len(request.Messages) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": "invalid request body: messages are required", "type": "invalid_request_error"}})
+		return
+	}
+	options, err := request.callOptions()
+	if err == nil && len(options) > 0 {
+		if _, ok := m.llm.(StreamingLLM); !ok {
+			err = ErrLLMOptionsUnsupported
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": gin.H{"message": err.Error(), "type": "invalid_request_error"}})
+		return
+	}
+
+	userID := c.GetHeader(headerMemGoUserID)
+	if userID == "" {
+		userID = request.User
+	}
+	agentID := c.GetHeader(headerMemGoAgentID)
+	runID := c.GetHeader(headerMemGoRunID)
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+	scoped := userID != "" || agentID != "" || runID != ""
+
+	m = tenantMemory(c, m, agentID)
+	if m == nil {
+		return
+	}
+	if scoped && !enforceQuota(c, m, userID, agentID) {
+		return
+	}
+
+	messages := []llms.MessageContent{}
+	query := lastUserMessage(request.Messages)
+	if scoped && query != "" {
+		memories, err := m.Search(query, optional(userID), optional(agentID), optional(runID), 5, nil, nil)
+		if respondQuotaError(c, err) {
+			return
+		}
+		if err != nil {
+			// answer without memories rather than failing the agent
+			log.Printf("Error searching memories for chat completion: %v", err)
+		}
+		if len(memories) > 0 {
+			messages = append(messages, llms.TextParts(llms.ChatMessageTypeSystem, proxyMemoryMessage(memories)))
+		}
+	}
+	for _, message := range request.Messages {
+		messages = append(messages, llms.TextParts(chatRole(message.Role), message.text()))
+	}
+
+	id := "chatcmpl-" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	created := time.Now().Unix()
+	scope := map[string]interface{}{"user_id": userID, "agent_id": agentID, "run_id": runID}
+
+	var onToken func(string) error
+	model := request.Model
+	chunk := func(delta gin.H, finishReason interface{}) gin.H {
+		return gin.H{
+			"id": id, "object": "chat.completion.chunk", "created": created, "model": model,
+			"choices": []gin.H{{"index": 0, "delta": delta, "finish_reason": finishReason}},
+		}
+	}
+	writeChunk := func(value interface{}) {
+		data, _ := json.Marshal(value)
+		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+	}
+	if request.Stream {
+		c.Writer.Header().Set("Content-Type", "text/event-stream")
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+		writeChunk(chunk(gin.H{"role": "assistant", "content": ""}, nil))
+		onToken = func(token string) error {
+			writeChunk(chunk(gin.H{"content": token}, nil))
+			return c.Request.Context().Err()
+		}
+	}
+
+	answer, err := m.generate(c.Request.Context(), messages, onToken, "chat.completions", scope, options...)
+	if err != nil {
+		if request.Stream {
+			writeChunk(gin.H{"error": gin.H{"message": err.Error(), "type": "server_error"}})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": gin.H{"message": err.Error(), "type": "server_error"}})
+		return
+	}
+	if answer.Model != "" {
+		model = answer.Model
+	}
+
+	if request.Stream {
+		writeChunk(chunk(gin.H{}, "stop"))
+		fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+		c.Writer.Flush()
+	} else {
+		c.JSON(http.StatusOK, gin.H{
+			"id": id, "object": "chat.completion", "created": created, "model": model,
+			"choices": []gin.H{{
+				"index":         0,
+				"message":       gin.H{"role": "assistant", "content": answer.Content},
+				"finish_reason": "stop",
+			}},
+			"usage": gin.H{
+				"prompt_tokens":     answer.PromptTokens,
+				"completion_tokens": answer.CompletionTokens,
+				"total_tokens":      answer.PromptTokens + answer.CompletionTokens,
+			},
+		})
+	}
+
+	// remember the exchange without delaying the agent
+	if scoped && query != "" {
+		exchange := fmt.Sprintf("user: %s\nassistant: %s", query, answer.Content)
+		if _, err := m.EnqueueAdd(exchange, optional(userID), optional(agentID), optional(runID), nil); err != nil {
+			log.Printf("Error queuing chat completion for memory: %v", err)
+		}
+	}
+}
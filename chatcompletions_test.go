@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/matigumma/memGo/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// echoLLM streams back the last message in two chunks
+type echoLLM struct {
+	received []llms.MessageContent
+	options  llms.CallOptions
+}
+
+func (e *echoLLM) GenerateResponse(messages []llms.MessageContent, tools []models.Tool, jsonMode bool, toolChoice string) (interface{}, error) {
+	return nil, nil
+}
+
+func (e *echoLLM) GenerateStream(ctx context.Context, messages []llms.MessageContent, onToken func(string) error, options ...llms.CallOption) (*LLMAnswer, error) {
+	e.received = messages
+	e.options = llms.CallOptions{}
+	for _, option := range options {
+		option(&e.options)
+	}
+	last := messages[len(messages)-1].Parts[0].(llms.TextContent).Text
+	if onToken != nil {
+		onToken("echo: ")
+		onToken(last)
+	}
+	return &LLMAnswer{Content: "echo: " + last, Model: "gpt-4o-mini", PromptTokens: 3, CompletionTokens: 2}, nil
+}
+
+func TestChatCompletionsHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	llm := &echoLLM{}
+	m := &Memory{config: NewMemoryConfig(), llm: llm}
+	m.config.Usage.Enabled = false
+	router := gin.New()
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		chatCompletionsHandler(c, m)
+	})
+
+	body := `{"model":"any","messages":[{"role":"system","content":"Be brief"},{"role":"user","content":[{"type":"text","text":"hola"}]}]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Object  string `json:"object"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "chat.completion", response.Object)
+	assert.Equal(t, "gpt-4o-mini", response.Model)
+	assert.Equal(t, "echo: hola", response.Choices[0].Message.Content)
+	assert.Equal(t, 5, response.Usage.TotalTokens)
+	// without user or agent there are no memories to inject
+	assert.Len(t, llm.received, 2)
+	assert.Equal(t, llms.ChatMessageTypeSystem, llm.received[0].Role)
+
+	w = httptest.NewRecorder()
+	streamBody := strings.Replace(body, `"model":"any"`, `"model":"any","stream":true`, 1)
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(streamBody)))
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `"delta":{"content":"hola"}`)
+	assert.True(t, strings.HasSuffix(w.Body.String(), "data: [DONE]\n\n"))
+
+	w = httptest.NewRecorder()
+	optionsBody := strings.Replace(body, `"model":"any"`, `"model":"gpt-4o","temperature":0.2,"max_tokens":64,"stop":"\n"`, 1)
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(optionsBody)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gpt-4o", llm.options.Model)
+	assert.Equal(t, 0.2, llm.options.Temperature)
+	assert.Equal(t, 64, llm.options.MaxTokens)
+	assert.Equal(t, []string{"\n"}, llm.options.StopWords)
+
+	for _, unsupported := range []string{
+		`"tools":[{"type":"function","function":{"name":"lookup"}}]`,
+		`"tool_choice":"required"`,
+		`"response_format":{"type":"json_object"}`,
+	} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(strings.Replace(body, `"model":"any"`, unsupported, 1))))
+		assert.Equal(t, http.StatusBadRequest, w.Code, unsupported)
+		assert.Contains(t, w.Body.String(), "invalid_request_error")
+	}
+}
+
+func TestProxyMemoryMessage(t *testing.T) {
+	message := proxyMemoryMessage([]map[string]interface{}{{"memory": "Viaja a Córdoba", "created_at": "2025-01-13T09:02:00-03:00"}})
+	assert.Equal(t, "Relevant memories about the user, use them when they help to answer:\n- Viaja a Córdoba (2025-01-13T09:02:00-03:00)", message)
+	assert.Equal(t, "b", lastUserMessage([]completionMessage{
+		{Role: "user", Content: json.RawMessage(`"a"`)}, {Role: "user", Content: json.RawMessage(`"b"`)}, {Role: "assistant", Content: json.RawMessage(`"c"`)},
+	}))
+}
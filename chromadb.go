@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 
 	"github.com/qdrant/go-client/qdrant"
 )
@@ -41,3 +43,103 @@ func (c *ChromaDB) Delete(vectorID string) error {
 func (c *ChromaDB) DeleteCol() error {
 	return errors.New("ChromaDB.DeleteCol not implemented")
 }
+func (c *ChromaDB) VectorSize() (int, error) {
+	return 0, errors.New("ChromaDB.VectorSize not implemented")
+}
+func (c *ChromaDB) Scroll(filters map[string]interface{}, limit int, offset string, withVectors bool) ([]SearchResult, string, error) {
+	return nil, "", errors.New("ChromaDB.Scroll not implemented")
+}
+func (c *ChromaDB) Count() (int, error) {
+	return 0, errors.New("ChromaDB.Count not implemented")
+}
+
+// chromaWhere translates the filters of a VectorStore call to a Chroma where document: the
+// scope values as $eq and the filter expression of Memory.WithFilter. Chroma has no not,
+// which is pushed down to the conditions, and compares numbers only, so date ranges are on
+// the epoch fields (created_at_ts, updated_at_ts) and exists and is_null are unsupported.
+func chromaWhere(filters map[string]interface{}) (map[string]interface{}, error) {
+	clauses := []map[string]interface{}{}
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if f, ok := filters[key].(*Filter); ok {
+			clause, err := chromaClause(*f, false)
+			if err != nil {
+				return nil, err
+			}
+			clauses = append(clauses, clause)
+			continue
+		}
+		clauses = append(clauses, map[string]interface{}{key: map[string]interface{}{"$eq": filters[key]}})
+	}
+	return chromaJoin("$and", clauses), nil
+}
+
+// chromaJoin combines clauses with $and or $or, which need at least two of them
+func chromaJoin(operator string, clauses []map[string]interface{}) map[string]interface{} {
+	switch len(clauses) {
+	case 0:
+		return nil
+	case 1:
+		return clauses[0]
+	}
+	return map[string]interface{}{operator: clauses}
+}
+
+func chromaClause(f Filter, negate bool) (map[string]interface{}, error) {
+	and, or := "$and", "$or"
+	if negate {
+		and, or = or, and
+	}
+	switch {
+	case f.And != nil, f.Or != nil:
+		operator, children := and, f.And
+		if f.Or != nil {
+			operator, children = or, f.Or
+		}
+		clauses := make([]map[string]interface{}, len(children))
+		for i, child := range children {
+			clause, err := chromaClause(child, negate)
+			if err != nil {
+				return nil, err
+			}
+			clauses[i] = clause
+		}
+		return chromaJoin(operator, clauses), nil
+	case f.Not != nil:
+		return chromaClause(*f.Not, !negate)
+	case f.Eq != nil:
+		return map[string]interface{}{f.Field: map[string]interface{}{map[bool]string{false: "$eq", true: "$ne"}[negate]: f.Eq}}, nil
+	case f.In != nil, f.Any != nil:
+		return map[string]interface{}{f.Field: map[string]interface{}{map[bool]string{false: "$in", true: "$nin"}[negate]: append(append([]interface{}{}, f.In...), f.Any...)}}, nil
+	case f.Range != nil:
+		field := f.Field
+		if dateFields[field] {
+			field += "_ts"
+		}
+		negated := map[string]string{"$gt": "$lte", "$gte": "$lt", "$lt": "$gte", "$lte": "$gt"}
+		clauses := []map[string]interface{}{}
+		for _, bound := range []struct {
+			operator string
+			value    interface{}
+		}{{"$gt", f.Range.Gt}, {"$gte", f.Range.Gte}, {"$lt", f.Range.Lt}, {"$lte", f.Range.Lte}} {
+			if bound.value == nil {
+				continue
+			}
+			operator := bound.operator
+			if negate {
+				operator = negated[operator]
+			}
+			value, err := f.rangeBound(bound.value)
+			if err != nil {
+				return nil, err
+			}
+			clauses = append(clauses, map[string]interface{}{field: map[string]interface{}{operator: value}})
+		}
+		return chromaJoin(and, clauses), nil
+	}
+	return nil, fmt.Errorf("filter %s is not supported by ChromaDB", f)
+}
@@ -0,0 +1,1125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/matigumma/memGo/utils"
+)
+
+// cliCommand - a memgo subcommand
+type cliCommand struct {
+	name    string
+	usage   string // arguments after the command name
+	summary string
+	run     func(w io.Writer, args []string) error
+}
+
+var cliCommands []cliCommand
+
+// set in init: the commands' flag usage refers back to cliCommands
+func init() {
+	cliCommands = []cliCommand{
+		{"add", "[text | -file path | stdin] -user|-agent|-run id", "extract facts from a text and store them as memories", addCommand},
+		{"search", "<query> [-limit n] [-threshold score] [-hybrid] [-rerank]", "search memories by similarity", searchCommand},
+		{"chat", "<question> -user|-agent|-run id [-remember]", "answer a question using the memories", chatCommand},
+		{"get", "<memory_id>...", "show memories by id", getCommand},
+		{"list", "[-limit n] [-expired]", "list the memories of a scope", listCommand},
+		{"update", "<memory_id> [text | -file path | stdin]", "replace the text of a memory", updateCommand},
+		{"delete", "<memory_id>...", "delete memories by id", deleteCommand},
+		{"delete-all", "-user|-agent|-run id -yes", "delete every memory of a scope", deleteAllCommand},
+		{"history", "<memory_id>", "show the change history of a memory", historyCommand},
+		{"reset", "-yes", "delete the collection and the history", resetCommand},
+		{"export", "[-user|-agent|-run id] [-vectors] [-file path]", "write memories and their history as JSONL", exportCommand},
+		{"import", "[file | -file path | stdin] [-mode skip|overwrite|merge]", "read memories written by export", importCommand},
+		{"ingest", "<file> [-format whatsapp|jsonl] [-agent id] [-source name]", "add a chat archive as memories, resumable", ingestCommand},
+		{"serve", "[-addr :8080] [-grpc-addr :9090]", "start the HTTP server", serveCommand},
+		{"mcp", "[-user|-agent|-run id]", "run an MCP server over stdio", mcpCommand},
+		{"reindex", "[-graph]", "rebuild the keyword index of hybrid search", reindexCommand},
+		{"graph", "<entity> [-user|-agent|-run id] [-depth n]", "show the knowledge graph around an entity", graphCommand},
+		{"forget", "[-dry-run]", "archive or delete the memories below the forgetting threshold", forgetCommand},
+		{"consolidate", "[-user|-agent|-run id] [-dry-run]", "merge similar memories and summarize them with the LLM", consolidateCommand},
+		{"sweep", "", "delete the memories past their expires_at", sweepCommand},
+		{"migrate-timestamps", "", "rewrite the timestamps of memories and history in UTC", migrateTimestampsCommand},
+		{"timezone", "-user id [zone | -unset]", "show or set the time zone of a user's timestamps", timezoneCommand},
+		{"reembed", "-model model [-provider provider]", "rebuild the vectors with another embedder", reembedCommand},
+	}
+}
+
+// runCLI runs the memgo subcommand in args. With no subcommand it starts the server.
+// Results are written to stdout, everything the Memory logs or prints goes to stderr
+// so the output can be piped.
+func runCLI(args []string) error {
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = stdout }()
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return serveCommand(stdout, args)
+	}
+	if args[0] == "help" {
+		printCLIUsage(stdout)
+		return nil
+	}
+	for _, cmd := range cliCommands {
+		if cmd.name == args[0] {
+			err := cmd.run(stdout, args[1:])
+			if errors.Is(err, flag.ErrHelp) {
+				return nil
+			}
+			return err
+		}
+	}
+	printCLIUsage(os.Stderr)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func printCLIUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: memgo <command> [flags] [args]")
+	fmt.Fprintln(w, "\ncommands:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range cliCommands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nRun memgo <command> -h for the flags of a command.")
+}
+
+// commandFlags - flags shared by the memory subcommands
+type commandFlags struct {
+	*flag.FlagSet
+	configPath string
+	tenant     string
+	output     string
+	userID     string
+	agentID    string
+	runID      string
+}
+
+// newCommandFlags registers the common flags; scoped adds -user, -agent and -run
+func newCommandFlags(name string, scoped bool) *commandFlags {
+	cf := &commandFlags{FlagSet: flag.NewFlagSet(name, flag.ContinueOnError)}
+	cf.StringVar(&cf.configPath, "config", os.Getenv("MEMGO_CONFIG"), "path to a YAML, JSON or TOML config file")
+	cf.StringVar(&cf.tenant, "tenant", "", "tenant to act on, required when auth is enabled")
+	cf.StringVar(&cf.output, "output", "table", "output format: table or json")
+	if scoped {
+		cf.StringVar(&cf.userID, "user", "", "user_id scope")
+		cf.StringVar(&cf.agentID, "agent", "", "agent_id scope")
+		cf.StringVar(&cf.runID, "run", "", "run_id scope")
+	}
+	cf.Usage = func() {
+		for _, cmd := range cliCommands {
+			if cmd.name == name {
+				fmt.Fprintf(cf.Output(), "usage: memgo %s %s\n\n%s\n\nflags:\n", cmd.name, cmd.usage, cmd.summary)
+			}
+		}
+		cf.PrintDefaults()
+	}
+	return cf
+}
+
+// parse parses flags placed before, between or after the positional arguments, which are returned
+func (cf *commandFlags) parse(args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := cf.Parse(args); err != nil {
+			return nil, err
+		}
+		args = cf.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if cf.output != "table" && cf.output != "json" {
+		return nil, fmt.Errorf("invalid -output %q, use table or json", cf.output)
+	}
+	return positional, nil
+}
+
+// newCLIMemory creates the Memory of the commands, the tests replace its stores
+var newCLIMemory = NewMemory
+
+// memory creates the Memory from the config, scoped to -tenant if set
+func (cf *commandFlags) memory() (*Memory, error) {
+	config, err := LoadConfig(cf.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config: %w", err)
+	}
+	m := newCLIMemory(config)
+	if cf.tenant != "" {
+		m = m.WithTenant(cf.tenant)
+	}
+	return m, nil
+}
+
+// scope returns the -user, -agent and -run flags, nil when not set
+func (cf *commandFlags) scope() (userID, agentID, runID *string) {
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+	return optional(cf.userID), optional(cf.agentID), optional(cf.runID)
+}
+
+func (cf *commandFlags) hasScope() bool {
+	return cf.userID != "" || cf.agentID != "" || cf.runID != ""
+}
+
+// print writes value as JSON, or rows as a table with the given columns
+func (cf *commandFlags) print(w io.Writer, value interface{}, columns []string, rows []map[string]interface{}) error {
+	if cf.output == "json" {
+		return printJSON(w, value)
+	}
+	return printTable(w, columns, rows)
+}
+
+// readInput returns the text from -file (- for stdin), the arguments, or piped stdin, in that order
+func readInput(args []string, file string) (string, error) {
+	var content []byte
+	var err error
+	switch {
+	case file == "-" || (file == "" && len(args) == 1 && args[0] == "-"):
+		content, err = io.ReadAll(os.Stdin)
+	case file != "":
+		content, err = os.ReadFile(file)
+	case len(args) > 0:
+		content = []byte(strings.Join(args, " "))
+	default:
+		if stat, statErr := os.Stdin.Stat(); statErr == nil && stat.Mode()&os.ModeCharDevice == 0 {
+			content, err = io.ReadAll(os.Stdin)
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading input: %w", err)
+	}
+	text := strings.TrimSpace(string(content))
+	if text == "" {
+		return "", errors.New("no input: pass the text as arguments, with -file or on stdin")
+	}
+	return text, nil
+}
+
+// keyValueFlags collects repeated key=value flags into a map
+type keyValueFlags map[string]interface{}
+
+func (kv keyValueFlags) String() string {
+	return fmt.Sprint(map[string]interface{}(kv))
+}
+
+func (kv keyValueFlags) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	kv[key] = utils.ParseScalar(value)
+	return nil
+}
+
+var (
+	memoryColumns  = []string{"id", "memory", "user_id", "agent_id", "run_id", "created_at", "updated_at"}
+	searchColumns  = []string{"id", "score", "memory", "user_id", "agent_id", "run_id", "created_at"}
+	eventColumns   = []string{"id", "event", "data"}
+	historyColumns = []string{"event", "old_memory", "new_memory", "created_at", "updated_at"}
+)
+
+func addCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("add", true)
+	file := cf.String("file", "", "read the text from a file, - for stdin")
+	prompt := cf.String("prompt", "", "custom prompt for the memory deduction")
+	metadata := keyValueFlags{}
+	cf.Var(metadata, "metadata", "metadata stored with the memories as key=value, repeatable")
+	expiresAt := cf.String("expires-at", "", "RFC3339 time or YYYY-MM-DD date after which the memories expire")
+	ttl := cf.String("ttl", "", "duration after which the memories expire, e.g. 48h")
+	args, err := cf.parse(args)
+	if err != nil {
+		return err
+	}
+	text, err := readInput(args, *file)
+	if err != nil {
+		return err
+	}
+	if !cf.hasScope() {
+		return errors.New("add requires -user, -agent or -run")
+	}
+	var customPrompt *string
+	if *prompt != "" {
+		customPrompt = prompt
+	}
+
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	userID, agentID, runID := cf.scope()
+	if *expiresAt != "" || *ttl != "" {
+		expiry, err := parseExpiry(*expiresAt, *ttl, m.displayLocation(derefString(userID)))
+		if err != nil {
+			return err
+		}
+		setExpiry(metadata, expiry)
+	}
+	result, err := m.Add(text, userID, agentID, runID, metadata, nil, customPrompt, nil)
+	if err != nil {
+		return err
+	}
+
+	details, _ := result["details"].([]map[string]interface{})
+	if cf.output == "table" && len(details) == 0 {
+		fmt.Fprintf(w, "%v: %v\n", result["message"], result["details"])
+		return nil
+	}
+	return cf.print(w, result, eventColumns, normalizeIDs(details))
+}
+
+func searchCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("search", true)
+	file := cf.String("file", "", "read the query from a file, - for stdin")
+	limit := cf.Int("limit", 5, "maximum number of results")
+	threshold := cf.Float64("threshold", 0, "minimum similarity score, 0 uses the vector store default")
+	filters := keyValueFlags{}
+	cf.Var(filters, "filter", "payload filter as key=value, repeatable")
+	where := cf.String("where", "", "filter expression as JSON, e.g. {\"field\":\"tags\",\"any\":[\"work\"]}")
+	hybrid := cf.Bool("hybrid", false, "fuse similarity with keyword (BM25) ranking")
+	vectorWeight := cf.Float64("vector-weight", 1, "weight of the similarity ranking with -hybrid")
+	keywordWeight := cf.Float64("keyword-weight", 1, "weight of the keyword ranking with -hybrid")
+	rerank := cf.Bool("rerank", false, "rerank the results with the LLM or the rerank endpoint")
+	rerankModel := cf.String("rerank-model", "", "model of -rerank (default: rerank.model)")
+	rerankCutoff := cf.Float64("rerank-cutoff", 0, "minimum rerank score from 0 to 1 (default: rerank.cutoff)")
+	since := cf.String("since", "", "only memories created since this RFC3339 time or YYYY-MM-DD date")
+	until := cf.String("until", "", "only memories created before this RFC3339 time or YYYY-MM-DD date")
+	timeZone := cf.String("timezone", "", "time zone of -since, -until, the times in the query (e.g. \"last week\") and the results (default: the user's or the timezone config)")
+	recency := cf.Bool("recency", false, "favour recent memories")
+	halfLife := cf.Float64("half-life", 0, "days for the recency of -recency to halve (default: recency.half_life_days)")
+	args, err := cf.parse(args)
+	if err != nil {
+		return err
+	}
+	query, err := readInput(args, *file)
+	if err != nil {
+		return err
+	}
+	var scoreThreshold *float32
+	if *threshold > 0 {
+		scoreThreshold = float32Ptr(float32(*threshold))
+	}
+
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	if *rerank {
+		m = m.WithRerank(RerankOptions{Model: *rerankModel, Cutoff: *rerankCutoff})
+	}
+	if m, err = withWhere(m, *where); err != nil {
+		return err
+	}
+	if *timeZone != "" {
+		loc, err := time.LoadLocation(*timeZone)
+		if err != nil {
+			return fmt.Errorf("invalid -timezone: %w", err)
+		}
+		m = m.WithTimeZone(loc)
+	}
+	window, err := searchTimeWindow(query, *since, *until, m.displayLocation(cf.userID))
+	if err != nil {
+		return err
+	}
+	m = m.WithTimeWindow(window)
+	if *recency {
+		m = m.WithRecency(RecencyOptions{HalfLife: time.Duration(*halfLife * 24 * float64(time.Hour))})
+	}
+	userID, agentID, runID := cf.scope()
+	var results []map[string]interface{}
+	if *hybrid {
+		results, err = m.HybridSearch(query, userID, agentID, runID, *limit, filters, HybridOptions{VectorWeight: *vectorWeight, KeywordWeight: *keywordWeight})
+	} else {
+		results, err = m.Search(query, userID, agentID, runID, *limit, filters, scoreThreshold)
+	}
+	if err != nil {
+		return err
+	}
+	results = normalizeIDs(results)
+	return cf.print(w, results, searchColumns, results)
+}
+
+// withWhere applies the filter expression of a -where flag
+func withWhere(m *Memory, where string) (*Memory, error) {
+	if where == "" {
+		return m, nil
+	}
+	f, err := ParseFilter([]byte(where))
+	if err != nil {
+		return nil, err
+	}
+	return m.WithFilter(f), nil
+}
+
+func chatCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("chat", true)
+	file := cf.String("file", "", "read the question from a file, - for stdin")
+	limit := cf.Int("limit", 5, "memories retrieved")
+	remember := cf.Bool("remember", false, "add the exchange to the memory")
+	args, err := cf.parse(args)
+	if err != nil {
+		return err
+	}
+	query, err := readInput(args, *file)
+	if err != nil {
+		return err
+	}
+	if !cf.hasScope() {
+		return errors.New("chat requires -user, -agent or -run")
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+
+	opts := ChatOptions{Limit: *limit, Remember: *remember}
+	opts.UserID, opts.AgentID, opts.RunID = cf.scope()
+	if cf.output == "table" {
+		opts.OnToken = func(token string) error {
+			_, err := io.WriteString(w, token)
+			return err
+		}
+	}
+	response, err := m.Chat(context.Background(), query, opts)
+	if err != nil {
+		return err
+	}
+	if cf.output == "json" {
+		return printJSON(w, response)
+	}
+	fmt.Fprintln(w)
+	if len(response.MemoryIDs) > 0 {
+		fmt.Fprintf(os.Stderr, "\nmemories: %s\n", strings.Join(response.MemoryIDs, ", "))
+	}
+	return nil
+}
+
+func getCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("get", false)
+	ids, err := cf.parse(args)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return errors.New("get requires at least one memory_id")
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+
+	memories := []map[string]interface{}{}
+	for _, id := range ids {
+		memory, err := m.Get(plainPointID(id))
+		if err != nil {
+			return err
+		}
+		memories = append(memories, memory)
+	}
+	memories = normalizeIDs(memories)
+
+	if cf.output == "json" {
+		if len(memories) == 1 {
+			return printJSON(w, memories[0])
+		}
+		return printJSON(w, memories)
+	}
+	for i, memory := range memories {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if err := printFields(w, memory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("list", true)
+	limit := cf.Int("limit", 100, "maximum number of memories, 0 for all")
+	where := cf.String("where", "", "filter expression as JSON, see search")
+	expired := cf.Bool("expired", false, "also list the expired memories not swept yet")
+	if _, err := cf.parse(args); err != nil {
+		return err
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	if m, err = withWhere(m, *where); err != nil {
+		return err
+	}
+	if *expired {
+		m = m.WithExpired()
+	}
+	userID, agentID, runID := cf.scope()
+	memories, err := m.GetAll(userID, agentID, runID, *limit)
+	if err != nil {
+		return err
+	}
+	memories = normalizeIDs(memories)
+	if memories == nil {
+		memories = []map[string]interface{}{}
+	}
+	return cf.print(w, memories, memoryColumns, memories)
+}
+
+func updateCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("update", false)
+	file := cf.String("file", "", "read the new text from a file, - for stdin")
+	args, err := cf.parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("update requires a memory_id")
+	}
+	text, err := readInput(args[1:], *file)
+	if err != nil {
+		return err
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	result, err := m.Update(plainPointID(args[0]), text, nil)
+	if err != nil {
+		return err
+	}
+	return printMessage(w, cf, result)
+}
+
+func deleteCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("delete", false)
+	ids, err := cf.parse(args)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return errors.New("delete requires at least one memory_id")
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	var result map[string]interface{}
+	for _, id := range ids {
+		if result, err = m.Delete(plainPointID(id)); err != nil {
+			return fmt.Errorf("error deleting memory %s: %w", id, err)
+		}
+	}
+	return printMessage(w, cf, result)
+}
+
+func deleteAllCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("delete-all", true)
+	yes := cf.Bool("yes", false, "confirm the deletion")
+	if _, err := cf.parse(args); err != nil {
+		return err
+	}
+	if !cf.hasScope() {
+		return errors.New("delete-all requires -user, -agent or -run, use reset to delete everything")
+	}
+	if !*yes {
+		return errors.New("delete-all deletes every memory of the scope, confirm with -yes")
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	userID, agentID, runID := cf.scope()
+	result, err := m.DeleteAll(userID, agentID, runID)
+	if err != nil {
+		return err
+	}
+	return printMessage(w, cf, result)
+}
+
+func historyCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("history", false)
+	args, err := cf.parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("history requires one memory_id")
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	history, err := m.History(plainPointID(args[0]))
+	if err != nil {
+		return err
+	}
+	if history == nil {
+		history = []map[string]interface{}{}
+	}
+	return cf.print(w, history, historyColumns, history)
+}
+
+func resetCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("reset", false)
+	yes := cf.Bool("yes", false, "confirm the reset")
+	if _, err := cf.parse(args); err != nil {
+		return err
+	}
+	if !*yes {
+		return errors.New("reset deletes every memory and the history, confirm with -yes")
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	if err := m.Reset(); err != nil {
+		return err
+	}
+	return printMessage(w, cf, map[string]interface{}{"message": "Memory reset successfully!"})
+}
+
+func exportCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("export", true)
+	file := cf.String("file", "", "write to a file instead of stdout")
+	withVectors := cf.Bool("vectors", false, "include the vectors")
+	if _, err := cf.parse(args); err != nil {
+		return err
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+
+	out := w
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return fmt.Errorf("error creating export file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	filters := map[string]interface{}{}
+	for key, value := range map[string]string{"user_id": cf.userID, "agent_id": cf.agentID, "run_id": cf.runID} {
+		if value != "" {
+			filters[key] = value
+		}
+	}
+	count, err := m.Export(filters, out, *withVectors)
+	fmt.Fprintf(os.Stderr, "Exported %d memories\n", count)
+	return err
+}
+
+func importCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("import", false)
+	file := cf.String("file", "", "read from a file, - for stdin")
+	mode := cf.String("mode", "skip", "existing memories: skip, overwrite or merge")
+	args, err := cf.parse(args)
+	if err != nil {
+		return err
+	}
+	importMode, err := ParseImportMode(*mode)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if *file == "" && len(args) > 0 {
+		*file = args[0]
+	}
+	if *file != "" && *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return fmt.Errorf("error opening import file: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	report, err := m.Import(in, importMode)
+	if report != nil {
+		if cf.output == "json" {
+			printJSON(w, report)
+		} else {
+			printFields(w, map[string]interface{}{
+				"created": report.Created, "overwritten": report.Overwritten, "merged": report.Merged,
+				"skipped": report.Skipped, "failed": report.Failed,
+			})
+			for _, e := range report.Errors {
+				fmt.Fprintln(os.Stderr, e)
+			}
+		}
+	}
+	return err
+}
+
+// ingestCommand implements `memgo ingest`: adds a WhatsApp export or JSONL archive with
+// Memory.Ingest. Ctrl-C pauses it, running the same command again resumes it.
+func ingestCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("ingest", false)
+	format := cf.String("format", "", "archive format: whatsapp or jsonl (default: detected)")
+	agentID := cf.String("agent", "", "agent_id of the memories, the user_id is the speaker")
+	runID := cf.String("run", "", "run_id of the memories")
+	source := cf.String("source", "", "checkpoint name (default: the file name)")
+	gap := cf.Duration("gap", 5*time.Minute, "a longer silence starts a new window")
+	maxMessages := cf.Int("max-messages", 20, "maximum messages per window")
+	concurrency := cf.Int("concurrency", 4, "windows added in parallel")
+	timezone := cf.String("timezone", "", "time zone of WhatsApp timestamps (default: local)")
+	restart := cf.Bool("restart", false, "discard the checkpoint and start over")
+	args, err := cf.parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("ingest requires one archive file")
+	}
+	loc := time.Local
+	if *timezone != "" {
+		if loc, err = time.LoadLocation(*timezone); err != nil {
+			return fmt.Errorf("invalid -timezone: %w", err)
+		}
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("error opening archive: %w", err)
+	}
+	messages, err := ParseChatArchive(f, *format, loc)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if *source == "" {
+		*source = filepath.Base(args[0])
+	}
+
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	report, err := m.Ingest(ctx, messages, IngestOptions{
+		Source:            *source,
+		AgentID:           *agentID,
+		RunID:             *runID,
+		WindowGap:         *gap,
+		MaxWindowMessages: *maxMessages,
+		Concurrency:       *concurrency,
+		Restart:           *restart,
+	})
+	if report != nil {
+		if cf.output == "json" {
+			printJSON(w, report)
+		} else {
+			fields := map[string]interface{}{}
+			reportBytes, _ := json.Marshal(report)
+			json.Unmarshal(reportBytes, &fields)
+			delete(fields, "errors")
+			printFields(w, fields)
+			for _, e := range report.Errors {
+				fmt.Fprintln(os.Stderr, e)
+			}
+		}
+		if report.Paused {
+			fmt.Fprintf(os.Stderr, "\nPaused: run the same command again to resume %s.\n", report.Source)
+		}
+	}
+	return err
+}
+
+func serveCommand(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("MEMGO_CONFIG"), "path to a YAML, JSON or TOML config file")
+	addr := fs.String("addr", "", "address to listen on (default: server.addr)")
+	grpcAddr := fs.String("grpc-addr", "", "address of the gRPC API (default: server.grpc_addr)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	if *addr != "" {
+		config.Server.Addr = *addr
+	}
+	if *grpcAddr != "" {
+		config.Server.GRPCAddr = *grpcAddr
+	}
+	fmt.Fprint(w, config.Report())
+
+	StartServer(NewMemory(config))
+	return nil
+}
+
+// mcpCommand implements `memgo mcp`: an MCP server reading JSON-RPC messages from stdin
+// and answering on stdout, one per line. -user, -agent and -run override the mcp config.
+func mcpCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("mcp", true)
+	if _, err := cf.parse(args); err != nil {
+		return err
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+
+	server := newMCPServer(m)
+	for _, override := range []struct{ flag, config *string }{
+		{&cf.userID, &server.config.UserID},
+		{&cf.agentID, &server.config.AgentID},
+		{&cf.runID, &server.config.RunID},
+	} {
+		if *override.flag != "" {
+			*override.config = *override.flag
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return server.serveStdio(ctx, os.Stdin, w)
+}
+
+// reindexCommand implements `memgo reindex`, see Memory.RebuildKeywordIndex
+func reindexCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("reindex", false)
+	graph := cf.Bool("graph", false, "also extract the knowledge graph of every memory again, with the LLM")
+	if _, err := cf.parse(args); err != nil {
+		return err
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	count, err := m.RebuildKeywordIndex()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d memories indexed\n", count)
+	if *graph {
+		if count, err = m.RebuildGraph(); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%d memories added to the knowledge graph\n", count)
+	}
+	return nil
+}
+
+// graphCommand implements `memgo graph`, see Memory.GraphNeighbourhood
+func graphCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("graph", true)
+	depth := cf.Int("depth", 0, "hops from the entity (default: graph.depth)")
+	args, err := cf.parse(args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("graph requires an entity")
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	userID, agentID, runID := cf.scope()
+	relations, err := m.GraphNeighbourhood(args[0], userID, agentID, runID, *depth)
+	if err != nil {
+		return err
+	}
+	rows := make([]map[string]interface{}, len(relations))
+	for i, relation := range relations {
+		rows[i] = map[string]interface{}{"hops": relation.Hops, "relation": describeRelation(relation), "memory_id": relation.MemoryID}
+	}
+	return cf.print(w, relations, []string{"hops", "relation", "memory_id"}, rows)
+}
+
+// forgetCommand implements `memgo forget`, see Memory.Forget
+func forgetCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("forget", false)
+	dryRun := cf.Bool("dry-run", false, "only list the memories that would be forgotten")
+	if _, err := cf.parse(args); err != nil {
+		return err
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	forgotten, err := m.Forget(*dryRun)
+	if err != nil {
+		return err
+	}
+	rows := make([]map[string]interface{}, len(forgotten))
+	for i, f := range forgotten {
+		rows[i] = map[string]interface{}{"id": f.ID, "memory": f.Memory, "agent_id": f.AgentID, "retention": fmt.Sprintf("%.3f", f.Retention), "action": f.Action}
+	}
+	return cf.print(w, forgotten, []string{"id", "action", "retention", "agent_id", "memory"}, rows)
+}
+
+// consolidateCommand implements `memgo consolidate`, see Memory.Consolidate
+func consolidateCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("consolidate", true)
+	dryRun := cf.Bool("dry-run", false, "only list the memories that would be written")
+	if _, err := cf.parse(args); err != nil {
+		return err
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	userID, agentID, runID := cf.scope()
+	consolidations, err := m.Consolidate(userID, agentID, runID, *dryRun)
+	if err != nil {
+		return err
+	}
+	rows := make([]map[string]interface{}, len(consolidations))
+	for i, consolidation := range consolidations {
+		rows[i] = map[string]interface{}{"id": consolidation.ID, "kind": consolidation.Kind, "memory": consolidation.Memory, "derived_from": strings.Join(consolidation.DerivedFrom, ",")}
+	}
+	return cf.print(w, consolidations, []string{"id", "kind", "memory", "derived_from"}, rows)
+}
+
+// sweepCommand implements `memgo sweep`, see Memory.SweepExpired
+func sweepCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("sweep", false)
+	if _, err := cf.parse(args); err != nil {
+		return err
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	deleted, err := m.SweepExpired()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d expired memories deleted\n", len(deleted))
+	return nil
+}
+
+// migrateTimestampsCommand implements `memgo migrate-timestamps`, see Memory.MigrateTimestamps
+func migrateTimestampsCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("migrate-timestamps", false)
+	if _, err := cf.parse(args); err != nil {
+		return err
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	count, err := m.MigrateTimestamps()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d memories migrated\n", count)
+	return nil
+}
+
+// timezoneCommand implements `memgo timezone`, see Memory.SetUserTimeZone
+func timezoneCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("timezone", true)
+	unset := cf.Bool("unset", false, "use the timezone config for the user again")
+	args, err := cf.parse(args)
+	if err != nil {
+		return err
+	}
+	if cf.userID == "" || len(args) > 1 {
+		return errors.New("timezone requires -user and at most one time zone")
+	}
+	m, err := cf.memory()
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 || *unset {
+		zone := ""
+		if !*unset {
+			zone = args[0]
+		}
+		if err := m.SetUserTimeZone(cf.userID, zone); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(w, m.displayLocation(cf.userID))
+	return nil
+}
+
+// reembedCommand implements `memgo reembed`: rebuilds the vectors of the active
+// collection with another embedder, see Memory.Reembed
+func reembedCommand(w io.Writer, args []string) error {
+	cf := newCommandFlags("reembed", false)
+	provider := cf.String("provider", "", "embedder provider to re-embed with (default: the configured one)")
+	model := cf.String("model", "", "embedding model to re-embed with")
+	target := cf.String("target", "", "collection to write to (default: <collection_name>_<model>)")
+	batchSize := cf.Int("batch-size", 64, "memories embedded and written per batch")
+	noSwap := cf.Bool("no-swap", false, "don't make the new collection the active one")
+	embedderOpts := keyValueFlags{}
+	cf.Var(embedderOpts, "embedder-opt", "extra embedder config as key=value, repeatable (e.g. base_url=http://localhost:11434)")
+	if _, err := cf.parse(args); err != nil {
+		return err
+	}
+
+	config, err := LoadConfig(cf.configPath)
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+
+	embedderConfig := EmbedderConfig{Provider: config.Embedder.Provider, Config: map[string]interface{}{}}
+	if *provider != "" && *provider != config.Embedder.Provider {
+		embedderConfig.Provider = *provider
+	} else {
+		// same provider: keep its credentials and endpoint
+		embedderConfig.Config = utils.MergeMaps(config.Embedder.Config, nil)
+	}
+	if *model != "" {
+		embedderConfig.Config["model"] = *model
+	}
+	for k, v := range embedderOpts {
+		embedderConfig.Config[k] = v
+	}
+
+	m := NewMemory(config)
+	report, err := m.Reembed(ReembedOptions{
+		Embedder:         embedderConfig,
+		TargetCollection: *target,
+		BatchSize:        *batchSize,
+		NoSwap:           *noSwap,
+	})
+	if report != nil {
+		if cf.output == "json" {
+			printJSON(w, report)
+		} else {
+			fields := map[string]interface{}{}
+			reportBytes, _ := json.Marshal(report)
+			json.Unmarshal(reportBytes, &fields)
+			printFields(w, fields)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if report.Swapped {
+		fmt.Fprintf(os.Stderr, "\n%s is now the active collection for %s, with embedder %s/%s (%d dims).\n",
+			report.Target, m.collectionName, embedderConfig.Provider, report.Model, report.Dims)
+		fmt.Fprintf(os.Stderr, "Restart the running servers: their writes fail until then.\n")
+	}
+	return nil
+}
+
+// printMessage writes the {"message": ...} result of a Memory call
+func printMessage(w io.Writer, cf *commandFlags, result map[string]interface{}) error {
+	if cf.output == "json" {
+		return printJSON(w, result)
+	}
+	_, err := fmt.Fprintln(w, result["message"])
+	return err
+}
+
+// normalizeIDs rewrites the "id" of each row as a plain id, e.g. uuid:"<uuid>" as <uuid>
+func normalizeIDs(rows []map[string]interface{}) []map[string]interface{} {
+	for _, row := range rows {
+		if id, ok := row["id"]; ok && id != nil {
+			row["id"] = plainPointID(fmt.Sprint(id))
+		}
+	}
+	return rows
+}
+
+func printJSON(w io.Writer, value interface{}) error {
+	out, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling output: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+// printTable writes rows as aligned columns, headers are the upper cased column names
+func printTable(w io.Writer, columns []string, rows []map[string]interface{}) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cells[i] = formatCell(row[column])
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+// printFields writes a map as key/value lines, nested maps as parent.key
+func printFields(w io.Writer, fields map[string]interface{}) error {
+	lines := [][2]string{}
+	var flatten func(prefix string, fields map[string]interface{})
+	flatten = func(prefix string, fields map[string]interface{}) {
+		for k, v := range fields {
+			if nested, ok := v.(map[string]interface{}); ok {
+				flatten(prefix+k+".", nested)
+				continue
+			}
+			lines = append(lines, [2]string{prefix + k, formatCell(v)})
+		}
+	}
+	flatten("", fields)
+	sort.Slice(lines, func(i, j int) bool { return lines[i][0] < lines[j][0] })
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, line := range lines {
+		fmt.Fprintf(tw, "%s:\t%s\n", line[0], line[1])
+	}
+	return tw.Flush()
+}
+
+func formatCell(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case *string:
+		if v == nil {
+			return ""
+		}
+		s = *v
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', 4, 64)
+	case float32:
+		s = strconv.FormatFloat(float64(v), 'f', 4, 32)
+	case []string:
+		s = strings.Join(v, ", ")
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatCell(item)
+		}
+		s = strings.Join(items, ", ")
+	default:
+		s = fmt.Sprint(v)
+	}
+	// keep each row on a single line
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/qdrant/go-client/qdrant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCLIFlagsAndOutput(t *testing.T) {
+	cf := newCommandFlags("search", true)
+	limit := cf.Int("limit", 5, "")
+	args, err := cf.parse([]string{"what", "-user", "Blas", "does", "--limit", "3", "-output", "json"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"what", "does"}, args)
+	assert.Equal(t, 3, *limit)
+	assert.Equal(t, "json", cf.output)
+	userID, agentID, _ := cf.scope()
+	assert.Equal(t, "Blas", *userID)
+	assert.Nil(t, agentID)
+
+	_, err = newCommandFlags("list", true).parse([]string{"-output", "yaml"})
+	assert.Error(t, err)
+
+	rows := normalizeIDs([]map[string]interface{}{
+		{"id": `uuid:"4d3c1f0e-5b8a-4f44-9d3e-2a1b0c9d8e7f"`, "memory": "likes\ncoffee", "score": 0.91234, "user_id": "Blas"},
+	})
+	var out bytes.Buffer
+	assert.NoError(t, printTable(&out, []string{"id", "score", "memory", "user_id", "agent_id"}, rows))
+	assert.Equal(t, "ID                                    SCORE   MEMORY        USER_ID  AGENT_ID\n"+
+		"4d3c1f0e-5b8a-4f44-9d3e-2a1b0c9d8e7f  0.9123  likes coffee  Blas     \n", out.String())
+}
+
+// fakeVectorStore - an in-memory VectorStore for the command tests, scored by cosine similarity
+type fakeVectorStore struct {
+	points map[string]SearchResult
+	order  []string
+}
+
+// matching returns the points with the values of filters and matching their filter expression
+func (s *fakeVectorStore) matching(filters map[string]interface{}) []SearchResult {
+	results := []SearchResult{}
+	for _, id := range s.order {
+		point, ok := s.points[id]
+		if !ok {
+			continue
+		}
+		matches := true
+		for key, value := range filters {
+			if f, ok := value.(*Filter); ok {
+				matches = matches && f.Matches(point.Payload)
+			} else {
+				matches = matches && fmt.Sprint(point.Payload[key]) == fmt.Sprint(value)
+			}
+		}
+		if matches {
+			results = append(results, point)
+		}
+	}
+	return results
+}
+
+func (s *fakeVectorStore) Insert(vectors [][]float64, ids []string, payloads []map[string]interface{}) error {
+	for i, id := range ids {
+		vector := make([]float32, len(vectors[i]))
+		for j, v := range vectors[i] {
+			vector[j] = float32(v)
+		}
+		if _, ok := s.points[id]; !ok {
+			s.order = append(s.order, id)
+		}
+		if err := s.Update(id, vector, payloads[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeVectorStore) Search(query []float32, limit int, filters map[string]interface{}) ([]SearchResult, error) {
+	return s.SearchWithThreshold(query, limit, filters, 0)
+}
+
+func (s *fakeVectorStore) SearchWithThreshold(query []float32, limit int, filters map[string]interface{}, scoreThreshold float32) ([]SearchResult, error) {
+	results := []SearchResult{}
+	for _, point := range s.matching(filters) {
+		point.Score = cosineSimilarity(query, point.Vector)
+		if point.Score >= float64(scoreThreshold) {
+			point.Vector = nil
+			results = append(results, point)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (s *fakeVectorStore) Get(vectorID string) (*qdrant.RetrievedPoint, error) {
+	point, ok := s.points[vectorID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMemoryNotFound, vectorID)
+	}
+	return &qdrant.RetrievedPoint{Id: qdrant.NewID(vectorID), Payload: qdrant.NewValueMap(point.Payload)}, nil
+}
+
+func (s *fakeVectorStore) List(filters map[string]interface{}, limit int) ([][]SearchResult, error) {
+	results := s.matching(filters)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return [][]SearchResult{results}, nil
+}
+
+func (s *fakeVectorStore) Update(vectorID string, vector []float32, payload map[string]interface{}) error {
+	// stored as qdrant would return it: numbers as float64, lists as []interface{}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	point := SearchResult{ID: vectorID, Vector: s.points[vectorID].Vector}
+	if err := json.Unmarshal(data, &point.Payload); err != nil {
+		return err
+	}
+	if vector != nil {
+		point.Vector = vector
+	}
+	s.points[vectorID] = point
+	return nil
+}
+
+func (s *fakeVectorStore) Delete(vectorID string) error {
+	delete(s.points, vectorID)
+	return nil
+}
+
+func (s *fakeVectorStore) DeleteCol() error {
+	s.points, s.order = map[string]SearchResult{}, nil
+	return nil
+}
+
+func (s *fakeVectorStore) VectorSize() (int, error) { return 26, nil }
+
+func (s *fakeVectorStore) Scroll(filters map[string]interface{}, limit int, offset string, withVectors bool) ([]SearchResult, string, error) {
+	results := s.matching(filters)
+	start, _ := strconv.Atoi(offset)
+	end, next := len(results), ""
+	if limit > 0 {
+		end = min(start+limit, len(results))
+	}
+	if end < len(results) {
+		next = strconv.Itoa(end)
+	}
+	page := results[start:end]
+	if !withVectors {
+		for i := range page {
+			page[i].Vector = nil
+		}
+	}
+	return page, next, nil
+}
+
+func (s *fakeVectorStore) Count() (int, error) { return len(s.points), nil }
+
+// letterEmbedder embeds a text as the counts of its letters
+type letterEmbedder struct{}
+
+func (letterEmbedder) Embed(text string) ([]float64, []float32, error) {
+	vector, vector32 := make([]float64, 26), make([]float32, 26)
+	for _, r := range strings.ToLower(text) {
+		if r >= 'a' && r <= 'z' {
+			vector[r-'a']++
+			vector32[r-'a']++
+		}
+	}
+	return vector, vector32, nil
+}
+
+func (letterEmbedder) Model() string { return "letters" }
+
+// useFakeMemory makes the commands run on a fakeVectorStore, letterEmbedder and a temporary history
+func useFakeMemory(t *testing.T) *fakeVectorStore {
+	db, err := sqlitemanager.NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+	store := &fakeVectorStore{points: map[string]SearchResult{}}
+	t.Setenv("MEMGO_CONFIG", "")
+	t.Setenv("OPENAI_API_KEY", "unused")
+	newMemory := newCLIMemory
+	newCLIMemory = func(config MemoryConfig) *Memory {
+		config.Usage.Enabled = false
+		return &Memory{config: config, vectorStore: store, embeddingModel: letterEmbedder{}, db: db, scopeLocks: newScopeLocks()}
+	}
+	t.Cleanup(func() { newCLIMemory = newMemory })
+	return store
+}
+
+func TestCLICommands(t *testing.T) {
+	store := useFakeMemory(t)
+	file := filepath.Join(t.TempDir(), "memories.jsonl")
+	assert.NoError(t, os.WriteFile(file, []byte(
+		`{"id":"4d3c1f0e-5b8a-4f44-9d3e-2a1b0c9d8e7f","text":"Likes black coffee","user_id":"Blas","created_at":"2025-01-10T10:00:00Z"}
+{"id":"0b7e6d5c-4a39-4281-9f70-e6d5c4b3a291","text":"Lives in Rosario","user_id":"Blas","created_at":"2025-01-11T10:00:00Z"}
+{"id":"9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d","text":"Plays chess","user_id":"Ana"}
+not json
+`), 0o644))
+
+	var out bytes.Buffer
+	assert.NoError(t, importCommand(&out, []string{file, "-output", "json"}))
+	var report ImportReport
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, 3, report.Created)
+	assert.Equal(t, 1, report.Failed)
+	assert.Len(t, store.points, 3)
+
+	out.Reset()
+	assert.NoError(t, importCommand(&out, []string{"-file", file}))
+	assert.Contains(t, out.String(), "skipped:      3")
+
+	out.Reset()
+	assert.NoError(t, searchCommand(&out, []string{"coffee", "-user", "Blas", "-limit", "1"}))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "ID "))
+	assert.Contains(t, lines[1], "4d3c1f0e-5b8a-4f44-9d3e-2a1b0c9d8e7f")
+	assert.Contains(t, lines[1], "Likes black coffee")
+
+	out.Reset()
+	assert.NoError(t, searchCommand(&out, []string{"chess", "-user", "Blas", "-output", "json"}))
+	var results []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &results))
+	assert.Len(t, results, 2)
+	assert.NotContains(t, out.String(), "Plays chess")
+
+	out.Reset()
+	assert.NoError(t, exportCommand(&out, []string{"-user", "Blas"}))
+	lines = strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 2)
+	var record ExportRecord
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "Likes black coffee", record.Text)
+	assert.Equal(t, "ADD", record.History[0]["event"])
+
+	// failures are returned, main exits 1 with them
+	assert.EqualError(t, addCommand(&out, []string{"likes tea"}), "add requires -user, -agent or -run")
+	assert.Error(t, addCommand(&out, []string{"likes tea", "-user", "Blas", "-ttl", "soon"}))
+	assert.Error(t, searchCommand(&out, []string{"coffee", "-where", `{"and": []}`}))
+	assert.Error(t, importCommand(&out, []string{file, "-mode", "replace"}))
+	assert.Error(t, runCLI([]string{"remember"}))
+	assert.NoError(t, runCLI([]string{"export", "-h"}))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/matigumma/memGo/utils"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix of the environment variables overriding the config,
+// e.g. MEMGO_LLM_PROVIDER or MEMGO_VECTOR_STORE_CONFIG_COLLECTION_NAME
+const envPrefix = "MEMGO"
+
+// LoadConfig builds the effective MemoryConfig: struct tag defaults and NewMemoryConfig,
+// then the YAML/JSON/TOML file at path (if not empty), then MEMGO_* environment overrides.
+// The result is validated.
+func LoadConfig(path string) (MemoryConfig, error) {
+	config := NewMemoryConfig()
+
+	if path != "" {
+		fileConfig, err := decodeConfigFile(path)
+		if err != nil {
+			return config, err
+		}
+		configBytes, err := json.Marshal(fileConfig)
+		if err != nil {
+			return config, fmt.Errorf("error marshaling config file %s: %w", path, err)
+		}
+		if err := json.Unmarshal(configBytes, &config); err != nil {
+			return config, fmt.Errorf("error decoding config file %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnvOverrides(&config, os.Environ()); err != nil {
+		return config, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return config, nil
+}
+
+// decodeConfigFile reads a YAML, JSON or TOML file into a generic map, based on its extension
+func decodeConfigFile(path string) (map[string]interface{}, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	config := map[string]interface{}{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &config)
+	case ".json":
+		err = json.Unmarshal(content, &config)
+	case ".toml":
+		err = toml.Unmarshal(content, &config)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q, use .yaml, .json or .toml", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// applyEnvOverrides sets config fields from MEMGO_* variables. The variable name is the
+// upper cased path of json tags, e.g. MEMGO_SERVER_ADDR for server.addr.
+// Provider config maps accept any key: MEMGO_LLM_CONFIG_MODEL sets llm.config["model"].
+func applyEnvOverrides(config *MemoryConfig, environ []string) error {
+	env := map[string]string{}
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, envPrefix+"_") {
+			env[k] = v
+		}
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	return applyEnvToStruct(reflect.ValueOf(config).Elem(), envPrefix, env)
+}
+
+func applyEnvToStruct(v reflect.Value, prefix string, env map[string]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := jsonFieldName(field)
+		if name == "" {
+			continue
+		}
+		envName := prefix + "_" + strings.ToUpper(name)
+		fv := v.Field(i)
+
+		switch {
+		case fv.Kind() == reflect.Struct:
+			if err := applyEnvToStruct(fv, envName, env); err != nil {
+				return err
+			}
+		case fv.Kind() == reflect.Map && fv.Type().Elem().Kind() == reflect.Interface:
+			// free form provider config: MEMGO_LLM_CONFIG_API_KEY -> config["api_key"]
+			for k, val := range env {
+				if key, ok := strings.CutPrefix(k, envName+"_"); ok {
+					if fv.IsNil() {
+						fv.Set(reflect.MakeMap(fv.Type()))
+					}
+					fv.SetMapIndex(reflect.ValueOf(strings.ToLower(key)), reflect.ValueOf(utils.ParseScalar(val)))
+				}
+			}
+		default:
+			val, ok := env[envName]
+			if !ok {
+				continue
+			}
+			if err := utils.SetFromString(fv, val); err != nil {
+				return fmt.Errorf("invalid value for %s: %w", envName, err)
+			}
+		}
+	}
+	return nil
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	tag := field.Tag.Get("json")
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// Report returns a human readable listing of the effective configuration with secrets redacted
+func (mc MemoryConfig) Report() string {
+	configBytes, err := json.Marshal(mc)
+	if err != nil {
+		return fmt.Sprintf("error marshaling config: %v", err)
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return fmt.Sprintf("error unmarshaling config: %v", err)
+	}
+
+	lines := []string{}
+	flattenConfig("", config, &lines)
+	sort.Strings(lines)
+
+	var sb strings.Builder
+	sb.WriteString("memGo effective configuration:\n")
+	for _, line := range lines {
+		sb.WriteString("  " + line + "\n")
+	}
+	return sb.String()
+}
+
+func flattenConfig(prefix string, value interface{}, lines *[]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && prefix != "" {
+			*lines = append(*lines, prefix+" = {}")
+		}
+		for k, item := range v {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flattenConfig(key, item, lines)
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			*lines = append(*lines, prefix+" = []")
+		}
+		for i, item := range v {
+			flattenConfig(fmt.Sprintf("%s[%d]", prefix, i), item, lines)
+		}
+	default:
+		if isSecretKey(prefix) && fmt.Sprint(v) != "" {
+			v = "****"
+		}
+		*lines = append(*lines, fmt.Sprintf("%s = %v", prefix, v))
+	}
+}
+
+func isSecretKey(key string) bool {
+	last := strings.ToLower(key[strings.LastIndex(key, ".")+1:])
+	for _, s := range []string{"key", "secret", "password", "token"} {
+		if strings.HasSuffix(last, s) {
+			return true
+		}
+	}
+	return false
+}
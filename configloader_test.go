@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memgo.yaml")
+	err := os.WriteFile(path, []byte(`
+llm:
+  config:
+    api_key: sk-test
+embedder:
+  provider: ollama
+  config:
+    model: nomic-embed-text
+vector_store:
+  config:
+    collection_name: memGo-ollama
+usage:
+  enabled: false
+`), 0o600)
+	assert.NoError(t, err)
+
+	// ollama embeddings have 768 dims, the default collection 1536
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, "embedding_model_dims is 1536")
+
+	t.Setenv("MEMGO_VECTOR_STORE_CONFIG_EMBEDDING_MODEL_DIMS", "768")
+	t.Setenv("MEMGO_SERVER_ADDR", ":9090")
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, ":9090", config.Server.Addr)
+	assert.Equal(t, "memGo-ollama", config.VectorStore.Config["collection_name"])
+	assert.False(t, config.Usage.Enabled)
+	assert.Equal(t, "./history.db", config.HistoryDBPath)
+	assert.Equal(t, "tenant_id", config.Auth.JWT.TenantClaim)
+	assert.NotContains(t, config.Report(), "sk-test")
+}
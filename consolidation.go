@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/matigumma/memGo/chains"
+)
+
+// Memory events of Consolidate, in the history and for webhooks
+const (
+	EventConsolidate = "CONSOLIDATE" // a memory written by Consolidate
+	EventMerge       = "MERGE"       // a memory replaced by a merged one, archived
+)
+
+// ConsolidationConfig - the consolidation job, see Memory.Consolidate
+type ConsolidationConfig struct {
+	Enabled         bool    `json:"enabled"`                         // run Consolidate periodically in the server
+	IntervalMinutes int     `json:"interval_minutes" default:"1440"` // between runs
+	Similarity      float64 `json:"similarity" default:"0.85"`       // cosine similarity from which memories are clustered
+	MaxClusterSize  int     `json:"max_cluster_size" default:"12"`   // memories sent to the LLM at once
+	MinClusterSize  int     `json:"min_cluster_size" default:"2"`    // smaller clusters are left as they are
+}
+
+func (cc ConsolidationConfig) validate() []error {
+	errs := []error{}
+	if cc.IntervalMinutes < 1 {
+		errs = append(errs, errors.New("consolidation.interval_minutes must be at least 1"))
+	}
+	if cc.Similarity <= 0 || cc.Similarity > 1 {
+		errs = append(errs, errors.New("consolidation.similarity must be greater than 0 and at most 1"))
+	}
+	if cc.MinClusterSize < 2 || cc.MaxClusterSize < cc.MinClusterSize {
+		errs = append(errs, errors.New("consolidation.min_cluster_size must be at least 2 and at most max_cluster_size"))
+	}
+	return errs
+}
+
+// Consolidation - a memory written by Consolidate from the memories it derives from
+type Consolidation struct {
+	ID          string   `json:"id,omitempty"` // empty on a dry run
+	Kind        string   `json:"kind"`         // merge, replacing the memories it derives from, or summary
+	Memory      string   `json:"memory"`
+	DerivedFrom []string `json:"derived_from"`
+	UserID      string   `json:"user_id,omitempty"`
+	AgentID     string   `json:"agent_id,omitempty"`
+	RunID       string   `json:"run_id,omitempty"`
+}
+
+// cosineSimilarity of two vectors of the same length, 0 if either is zero
+func cosineSimilarity(a []float32, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// clusterMemories groups the vectors by similarity: each cluster starts at the first vector
+// left and takes the following ones at least threshold similar to it, up to maxSize. Returns
+// the indices of the clusters of at least minSize vectors.
+func clusterMemories(vectors [][]float32, threshold float64, minSize int, maxSize int) [][]int {
+	clustered := make([]bool, len(vectors))
+	clusters := [][]int{}
+	for i := range vectors {
+		if clustered[i] {
+			continue
+		}
+		clustered[i] = true
+		cluster := []int{i}
+		for j := i + 1; j < len(vectors) && len(cluster) < maxSize; j++ {
+			if !clustered[j] && len(vectors[j]) == len(vectors[i]) && cosineSimilarity(vectors[i], vectors[j]) >= threshold {
+				clustered[j] = true
+				cluster = append(cluster, j)
+			}
+		}
+		if len(cluster) >= minSize {
+			clusters = append(clusters, cluster)
+		}
+	}
+	return clusters
+}
+
+// consolidationItems returns the texts of a section of MEMORY_CONSOLIDATION with the indices,
+// from 0, of the memories they derive from. Indices out of range or repeated are dropped.
+func consolidationItems(result map[string]interface{}, section string, size int) ([]string, [][]int) {
+	items, _ := result[section].([]interface{})
+	texts := []string{}
+	sources := [][]int{}
+	for _, item := range items {
+		entry, _ := item.(map[string]interface{})
+		text, _ := entry["texto"].(string)
+		numbers, _ := entry["memorias"].([]interface{})
+		seen := map[int]bool{}
+		indices := []int{}
+		for _, number := range numbers {
+			n, ok := number.(float64)
+			if !ok || n < 1 || int(n) > size || seen[int(n)-1] {
+				continue
+			}
+			seen[int(n)-1] = true
+			indices = append(indices, int(n)-1)
+		}
+		if text == "" || len(indices) == 0 {
+			continue
+		}
+		sort.Ints(indices)
+		texts = append(texts, text)
+		sources = append(sources, indices)
+	}
+	return texts, sources
+}
+
+// Consolidate clusters the memories of each user/agent/run scope of the tenant by similarity
+// and asks the LLM to merge the redundant ones and summarize each cluster. Merged memories
+// replace the ones they derive from, which are archived; summaries are added next to them.
+// Both link their originals in derived_from. Clusters whose memories were all consolidated
+// already are skipped. Nil ids consolidate every scope; with dryRun nothing is written.
+func (m *Memory) Consolidate(userID *string, agentID *string, runID *string, dryRun bool) ([]Consolidation, error) {
+	policy := m.config.Consolidation
+	filters := map[string]interface{}{}
+	if userID != nil {
+		filters["user_id"] = *userID
+	}
+	if agentID != nil {
+		filters["agent_id"] = *agentID
+	}
+	if runID != nil {
+		filters["run_id"] = *runID
+	}
+	if err := m.applyTenant(filters); err != nil {
+		return nil, err
+	}
+	filters = m.storeFilters(filters)
+
+	// summaries aren't consolidated again, their originals are
+	scopes := map[string][]SearchResult{}
+	scopeOrder := []string{}
+	offset := ""
+	for {
+		page, next, err := m.vectorStore.Scroll(filters, 256, offset, true)
+		if err != nil {
+			return nil, fmt.Errorf("error listing memories: %w", err)
+		}
+		for _, memory := range page {
+			if kind, _ := memory.Payload["consolidation"].(string); kind == "summary" {
+				continue
+			}
+			key := scopeKey(memory.Payload)
+			if _, ok := scopes[key]; !ok {
+				scopeOrder = append(scopeOrder, key)
+			}
+			scopes[key] = append(scopes[key], memory)
+		}
+		if next == "" {
+			break
+		}
+		offset = next
+	}
+
+	consolidations := []Consolidation{}
+	for _, key := range scopeOrder {
+		memories := scopes[key]
+		vectors := make([][]float32, len(memories))
+		for i, memory := range memories {
+			vectors[i] = memory.Vector
+		}
+		for _, cluster := range clusterMemories(vectors, policy.Similarity, max(policy.MinClusterSize, 2), max(policy.MaxClusterSize, 2)) {
+			members := make([]SearchResult, len(cluster))
+			pending := false
+			for i, index := range cluster {
+				members[i] = memories[index]
+				if members[i].Payload["consolidated_at"] == nil {
+					pending = true
+				}
+			}
+			if !pending {
+				continue
+			}
+			written, err := m.consolidateCluster(members, dryRun)
+			consolidations = append(consolidations, written...)
+			if err != nil {
+				return consolidations, err
+			}
+		}
+	}
+	return consolidations, nil
+}
+
+func (m *Memory) consolidateCluster(members []SearchResult, dryRun bool) ([]Consolidation, error) {
+	scope := map[string]interface{}{}
+	for _, key := range []string{"user_id", "agent_id", "run_id", "tenant_id"} {
+		if value, ok := members[0].Payload[key]; ok {
+			scope[key] = value
+		}
+	}
+	texts := make([]string, len(members))
+	for i, member := range members {
+		texts[i], _ = member.Payload["data"].(string)
+	}
+	result, err := chains.NewChain(m.debug, nil).WithUsage(m.chainUsage(scope)).MEMORY_CONSOLIDATION(texts)
+	if err != nil {
+		return nil, fmt.Errorf("error generating response for MEMORY_CONSOLIDATION: %w", err)
+	}
+
+	// the LLM is called without the scope lock, so the members changed or deleted meanwhile
+	// are left out of the writes
+	stale := make([]bool, len(members))
+	if !dryRun {
+		defer m.lockScope(scope)()
+		members = append([]SearchResult{}, members...)
+		for i, member := range members {
+			payload, err := m.unchangedPayload(member)
+			if err != nil {
+				return nil, err
+			}
+			if payload == nil {
+				stale[i] = true
+				continue
+			}
+			members[i].Payload = payload
+		}
+	}
+
+	userID, _ := scope["user_id"].(string)
+	agentID, _ := scope["agent_id"].(string)
+	runID, _ := scope["run_id"].(string)
+	consolidations := []Consolidation{}
+	merged := make([]bool, len(members))
+	ids := func(indices []int) []string {
+		derivedFrom := make([]string, len(indices))
+		for i, index := range indices {
+			derivedFrom[i] = plainPointID(members[index].ID)
+		}
+		return derivedFrom
+	}
+
+	mergedTexts, mergedSources := consolidationItems(result, "HECHOS", len(members))
+	for i, text := range mergedTexts {
+		// a memory is merged once, and a merge replaces at least two
+		sources := []int{}
+		for _, index := range mergedSources[i] {
+			if !merged[index] && !stale[index] {
+				sources = append(sources, index)
+			}
+		}
+		if len(sources) < 2 {
+			continue
+		}
+		for _, index := range sources {
+			merged[index] = true
+		}
+		consolidation := Consolidation{Kind: "merge", Memory: text, DerivedFrom: ids(sources), UserID: userID, AgentID: agentID, RunID: runID}
+		if !dryRun {
+			importance := -1.0
+			for _, index := range sources {
+				if value, ok := members[index].Payload["importance"].(float64); ok {
+					importance = math.Max(importance, value)
+				}
+			}
+			metadata := consolidationMetadata(scope, "merge", consolidation.DerivedFrom)
+			if importance >= 0 {
+				metadata["importance"] = importance
+			}
+			if consolidation.ID, err = m.createMemory(text, metadata, EventConsolidate); err != nil {
+				return consolidations, err
+			}
+			for _, index := range sources {
+				if err := m.archiveMerged(members[index], consolidation.ID, text); err != nil {
+					return consolidations, err
+				}
+			}
+		}
+		consolidations = append(consolidations, consolidation)
+	}
+
+	summaryTexts, summarySources := consolidationItems(result, "RESUMEN", len(members))
+	for i, text := range summaryTexts {
+		if slices.ContainsFunc(summarySources[i], func(index int) bool { return stale[index] }) {
+			continue
+		}
+		consolidation := Consolidation{Kind: "summary", Memory: text, DerivedFrom: ids(summarySources[i]), UserID: userID, AgentID: agentID, RunID: runID}
+		if !dryRun {
+			if consolidation.ID, err = m.createMemory(text, consolidationMetadata(scope, "summary", consolidation.DerivedFrom), EventConsolidate); err != nil {
+				return consolidations, err
+			}
+		}
+		consolidations = append(consolidations, consolidation)
+	}
+
+	if dryRun {
+		return consolidations, nil
+	}
+	// the members left are marked so that the cluster isn't sent again until it grows
+	consolidatedAt, consolidatedAtTs := timestamp(time.Now())
+	for i, member := range members {
+		if merged[i] || stale[i] {
+			continue
+		}
+		payload := copyPayload(member.Payload)
+		payload["consolidated_at"], payload["consolidated_at_ts"] = consolidatedAt, consolidatedAtTs
+		if err := m.upsertPayload(plainPointID(member.ID), member.Vector, payload); err != nil {
+			return consolidations, err
+		}
+	}
+	return consolidations, nil
+}
+
+// unchangedPayload re-reads the payload of a member of a cluster, nil when the memory was
+// deleted or its data updated since it was listed
+func (m *Memory) unchangedPayload(member SearchResult) (map[string]interface{}, error) {
+	point, err := m.vectorStore.Get(plainPointID(member.ID))
+	if errors.Is(err, ErrMemoryNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting memory %s: %w", member.ID, err)
+	}
+	if point == nil {
+		return nil, nil
+	}
+	payload := convertQdrantPayload(point.Payload)
+	for _, key := range []string{"hash", "updated_at"} {
+		if fmt.Sprint(payload[key]) != fmt.Sprint(member.Payload[key]) {
+			return nil, nil
+		}
+	}
+	return payload, nil
+}
+
+// consolidationMetadata returns the payload of a memory written by Consolidate
+func consolidationMetadata(scope map[string]interface{}, kind string, derivedFrom []string) map[string]interface{} {
+	metadata := copyPayload(scope)
+	metadata["consolidation"] = kind
+	metadata["derived_from"] = derivedFrom
+	metadata["consolidated_at"], metadata["consolidated_at_ts"] = timestamp(time.Now())
+	return metadata
+}
+
+// archiveMerged archives a memory replaced by the merged memory mergedID, see Consolidate
+func (m *Memory) archiveMerged(memory SearchResult, mergedID string, mergedData string) error {
+	memoryID := plainPointID(memory.ID)
+	payload := copyPayload(memory.Payload)
+	payload["archived"] = true
+	payload["archived_at"], payload["archived_at_ts"] = timestamp(time.Now())
+	payload["merged_into"] = mergedID
+	if err := m.upsertPayload(memoryID, memory.Vector, payload); err != nil {
+		return err
+	}
+
+	data, _ := payload["data"].(string)
+	now := payload["archived_at"].(string)
+	if err := m.db.AddHistory(memoryID, payloadTenant(payload), &data, mergedData, EventMerge, &now, &now, 0); err != nil {
+		log.Printf("Error adding history: %v", err) // Non-critical error
+	}
+	m.emitMemoryEvent(EventMerge, memoryID, mergedData, data, payload)
+	return nil
+}
+
+func copyPayload(payload map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(payload)+4)
+	for k, v := range payload {
+		copied[k] = v
+	}
+	return copied
+}
+
+// upsertPayload rewrites the payload of a stored memory, keeping its vector
+func (m *Memory) upsertPayload(memoryID string, vector32 []float32, payload map[string]interface{}) error {
+	if err := m.checkActiveCollection(); err != nil {
+		return err
+	}
+	vector := make([]float64, len(vector32))
+	for i, v := range vector32 {
+		vector[i] = float64(v)
+	}
+	if err := m.vectorStore.Insert([][]float64{vector}, []string{memoryID}, []map[string]interface{}{payload}); err != nil {
+		return fmt.Errorf("error rewriting memory %s: %w", memoryID, err)
+	}
+	return nil
+}
+
+// StartConsolidation runs Consolidate over every scope every consolidation.interval_minutes
+// when consolidation.enabled
+func (m *Memory) StartConsolidation(ctx context.Context) {
+	if !m.config.Consolidation.Enabled {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(max(m.config.Consolidation.IntervalMinutes, 1)) * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			consolidations, err := m.systemScope().Consolidate(nil, nil, nil, false)
+			if err != nil {
+				log.Printf("Error consolidating memories: %v", err)
+			}
+			if len(consolidations) > 0 {
+				log.Printf("Consolidated memories into %d merged and summary memories", len(consolidations))
+			}
+		}
+	}()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsolidationClusters(t *testing.T) {
+	policy := NewMemoryConfig().Consolidation
+	assert.Empty(t, policy.validate())
+	assert.False(t, policy.Enabled)
+
+	vectors := [][]float32{
+		{1, 0, 0},      // juega al fútbol los martes
+		{0, 1, 0},      // vive en Córdoba
+		{0.95, 0.1, 0}, // juega al fútbol con amigos
+		{0, 0.9, 0.2},  // se mudó a Córdoba
+		{0, 0, 1},      // tiene un perro
+		{0.9, 0, 0.1},  // juega al fútbol los jueves
+	}
+	assert.Equal(t, [][]int{{0, 2, 5}, {1, 3}}, clusterMemories(vectors, policy.Similarity, 2, 12))
+	assert.Equal(t, [][]int{{0, 2}, {1, 3}}, clusterMemories(vectors, policy.Similarity, 2, 2))
+	assert.Equal(t, [][]int{{0, 2, 5}}, clusterMemories(vectors, policy.Similarity, 3, 12))
+	assert.InDelta(t, 1, cosineSimilarity([]float32{1, 2}, []float32{2, 4}), 1e-9)
+	assert.Zero(t, cosineSimilarity([]float32{0, 0}, []float32{1, 1}))
+
+	result := map[string]interface{}{
+		"HECHOS": []interface{}{
+			map[string]interface{}{"texto": "Juega al fútbol los martes y jueves", "memorias": []interface{}{3.0, 1.0, 1.0, 9.0}},
+			map[string]interface{}{"texto": "", "memorias": []interface{}{2.0}},
+		},
+		"RESUMEN": []interface{}{
+			map[string]interface{}{"texto": "El deporte es parte de su semana", "memorias": []interface{}{1.0, 2.0, 3.0}},
+		},
+	}
+	texts, sources := consolidationItems(result, "HECHOS", 3)
+	assert.Equal(t, []string{"Juega al fútbol los martes y jueves"}, texts)
+	assert.Equal(t, [][]int{{0, 2}}, sources)
+	texts, sources = consolidationItems(result, "RESUMEN", 3)
+	assert.Equal(t, []string{"El deporte es parte de su semana"}, texts)
+	assert.Equal(t, [][]int{{0, 1, 2}}, sources)
+
+	metadata := consolidationMetadata(map[string]interface{}{"user_id": "Blas"}, "summary", []string{"a", "b"})
+	assert.Equal(t, "Blas", metadata["user_id"])
+	assert.Equal(t, "summary", metadata["consolidation"])
+	assert.Equal(t, []string{"a", "b"}, metadata["derived_from"])
+	assert.NotNil(t, metadata["consolidated_at_ts"])
+}
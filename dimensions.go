@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// DimensionMismatchError is returned at startup when the embedder output size
+// doesn't match the vector size of the collection
+type DimensionMismatchError struct {
+	Collection     string
+	CollectionDims int
+	EmbedderModel  string
+	EmbedderDims   int
+	Configured     bool // true if CollectionDims comes from embedding_model_dims, not from an existing collection
+}
+
+func (e *DimensionMismatchError) Error() string {
+	if e.Configured {
+		return fmt.Sprintf(
+			"embedder %q produces %d-dimensional vectors but vector_store.config.embedding_model_dims for collection %q is %d: "+
+				"set embedding_model_dims to %d",
+			e.EmbedderModel, e.EmbedderDims, e.Collection, e.CollectionDims, e.EmbedderDims)
+	}
+	return fmt.Sprintf(
+		"embedder %q produces %d-dimensional vectors but collection %q stores %d-dimensional vectors: "+
+			"switch back to the embedder the collection was built with, point vector_store.config.collection_name to a new collection "+
+			"(it will be created with %d dims), or re-embed the existing memories into a new collection",
+		e.EmbedderModel, e.EmbedderDims, e.Collection, e.CollectionDims, e.EmbedderDims)
+}
+
+// embeddingDims returns the output size of an embedder: the declared dims of its config,
+// otherwise the size of a probe embedding (recorded in the usage ledger)
+func (m *Memory) embeddingDims(embedder Embedder, config EmbedderConfig) (int, error) {
+	if dims, ok := config.Dims(); ok {
+		return dims, nil
+	}
+	_, vector, err := m.embedWith(embedder, "dimension probe", "dimension_probe", nil)
+	if err != nil {
+		return 0, fmt.Errorf("can't determine the dimensions of embedder %q: %w", embedder.Model(), err)
+	}
+	return len(vector), nil
+}
+
+// checkConfiguredDims verifies, before the vector store is created, that the dims a new
+// collection would be created with match the embedder. Missing dims are set from the embedder.
+func checkConfiguredDims(config *VectorStoreConfig, embedderModel string, embedderDims int) error {
+	if config.Config == nil {
+		config.Config = make(map[string]interface{})
+	}
+	collection, _ := config.Config["collection_name"].(string)
+	dims, ok := configInt(config.Config, "embedding_model_dims")
+	if !ok {
+		config.Config["embedding_model_dims"] = embedderDims
+		return nil
+	}
+	if dims != embedderDims {
+		return &DimensionMismatchError{Collection: collection, CollectionDims: dims, EmbedderModel: embedderModel, EmbedderDims: embedderDims, Configured: true}
+	}
+	return nil
+}
+
+// checkCollectionDims verifies that the existing collection stores vectors of the embedder size
+func checkCollectionDims(vectorStore VectorStore, collection string, embedderModel string, embedderDims int) error {
+	dims, err := vectorStore.VectorSize()
+	if err != nil {
+		log.Printf("Skipping collection dimensions check: %v", err)
+		return nil
+	}
+	if dims != embedderDims {
+		return &DimensionMismatchError{Collection: collection, CollectionDims: dims, EmbedderModel: embedderModel, EmbedderDims: embedderDims}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/stretchr/testify/assert"
+)
+
+// probeEmbedder returns zero vectors of dims and counts its calls
+type probeEmbedder struct{ dims, calls int }
+
+func (e *probeEmbedder) Embed(text string) ([]float64, []float32, error) {
+	e.calls++
+	return make([]float64, e.dims), make([]float32, e.dims), nil
+}
+
+func (e *probeEmbedder) Model() string { return "probe-model" }
+
+// sizedStore is a VectorStore whose collection stores vectors of dims
+type sizedStore struct {
+	VectorStore
+	dims int
+	err  error
+}
+
+func (s sizedStore) VectorSize() (int, error) { return s.dims, s.err }
+
+func TestEmbeddingDims(t *testing.T) {
+	db, err := sqlitemanager.NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+	m := &Memory{config: NewMemoryConfig(), db: db}
+	embedder := &probeEmbedder{dims: 384}
+
+	// declared dims are used without calling the embedder
+	dims, err := m.embeddingDims(embedder, EmbedderConfig{Provider: "openai", Config: map[string]interface{}{"embedding_dims": 256}})
+	assert.NoError(t, err)
+	assert.Equal(t, 256, dims)
+	assert.Equal(t, 0, embedder.calls)
+
+	// unknown models are probed, and the probe is recorded as usage
+	dims, err = m.embeddingDims(embedder, EmbedderConfig{Provider: "ollama", Config: map[string]interface{}{"model": "unknown-model"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 384, dims)
+	assert.Equal(t, 1, embedder.calls)
+	totals, err := m.Usage(sqlitemanager.UsageQuery{GroupBy: []string{"model"}})
+	assert.NoError(t, err)
+	assert.Len(t, totals, 1)
+	assert.Equal(t, "probe-model", totals[0].Group["model"])
+	assert.Equal(t, 1, totals[0].Calls)
+}
+
+func TestCheckConfiguredDims(t *testing.T) {
+	config := VectorStoreConfig{Provider: "qdrant", Config: map[string]interface{}{"collection_name": "memgo"}}
+	assert.NoError(t, checkConfiguredDims(&config, "probe-model", 384))
+	assert.Equal(t, 384, config.Config["embedding_model_dims"])
+
+	config.Config["embedding_model_dims"] = 1536
+	err := checkConfiguredDims(&config, "probe-model", 384)
+	var mismatch *DimensionMismatchError
+	assert.ErrorAs(t, err, &mismatch)
+	assert.True(t, mismatch.Configured)
+	assert.Equal(t, 1536, mismatch.CollectionDims)
+	assert.Equal(t, 384, mismatch.EmbedderDims)
+}
+
+func TestCheckCollectionDims(t *testing.T) {
+	assert.NoError(t, checkCollectionDims(sizedStore{dims: 384}, "memgo", "probe-model", 384))
+
+	err := checkCollectionDims(sizedStore{dims: 1536}, "memgo", "probe-model", 384)
+	var mismatch *DimensionMismatchError
+	assert.ErrorAs(t, err, &mismatch)
+	assert.False(t, mismatch.Configured)
+	assert.Equal(t, "memgo", mismatch.Collection)
+
+	// collections not created yet are checked by checkConfiguredDims
+	assert.NoError(t, checkCollectionDims(sizedStore{err: errors.New("collection not found")}, "memgo", "probe-model", 384))
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ImportMode - how Memory.Import handles a record whose id already exists
+type ImportMode string
+
+const (
+	ImportSkip      ImportMode = "skip"      // keep the existing memory
+	ImportOverwrite ImportMode = "overwrite" // replace the memory and its history
+	ImportMerge     ImportMode = "merge"     // the newest text wins, metadata lists are joined, history rows are added
+)
+
+// ParseImportMode validates an import mode, "" is ImportSkip
+func ParseImportMode(mode string) (ImportMode, error) {
+	switch ImportMode(mode) {
+	case "":
+		return ImportSkip, nil
+	case ImportSkip, ImportOverwrite, ImportMerge:
+		return ImportMode(mode), nil
+	default:
+		return "", fmt.Errorf("invalid import mode %q, use skip, overwrite or merge", mode)
+	}
+}
+
+// ExportRecord - a memory in the portable JSONL format of Memory.Export and Memory.Import
+type ExportRecord struct {
+	ID        string `json:"id"`
+	Text      string `json:"text"`
+	Hash      string `json:"hash,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+	AgentID   string `json:"agent_id,omitempty"`
+	RunID     string `json:"run_id,omitempty"`
+	// deduced metadata (scope, sentiment, related_entities, related_events, tags) and any other payload key
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// only reused on import when the embedding model is the same
+	Vector         []float32                `json:"vector,omitempty"`
+	EmbeddingModel string                   `json:"embedding_model,omitempty"`
+	History        []map[string]interface{} `json:"history,omitempty"`
+}
+
+// ImportReport - result of Memory.Import
+type ImportReport struct {
+	Created     int      `json:"created"`
+	Overwritten int      `json:"overwritten"`
+	Merged      int      `json:"merged"`
+	Skipped     int      `json:"skipped"`
+	Failed      int      `json:"failed"`
+	Errors      []string `json:"errors,omitempty"` // the first failures as "line N: error"
+}
+
+const maxImportErrors = 100
+
+func (r *ImportReport) fail(line int, err error) {
+	r.Failed++
+	if len(r.Errors) < maxImportErrors {
+		r.Errors = append(r.Errors, fmt.Sprintf("line %d: %v", line, err))
+	}
+}
+
+// payload keys with a dedicated ExportRecord field
+// (the epoch fields are derived from created_at and updated_at)
+var exportRecordKeys = map[string]bool{"data": true, "hash": true, "created_at": true, "updated_at": true, "created_at_ts": true, "updated_at_ts": true, "user_id": true, "agent_id": true, "run_id": true}
+
+// newExportRecord builds the record of a vector store payload
+func newExportRecord(id string, payload map[string]interface{}) ExportRecord {
+	str := func(key string) string {
+		s, _ := payload[key].(string)
+		return s
+	}
+	record := ExportRecord{
+		ID:        plainPointID(id),
+		Text:      str("data"),
+		Hash:      str("hash"),
+		CreatedAt: str("created_at"),
+		UpdatedAt: str("updated_at"),
+		UserID:    str("user_id"),
+		AgentID:   str("agent_id"),
+		RunID:     str("run_id"),
+		Metadata:  map[string]interface{}{},
+	}
+	for k, v := range payload {
+		if !exportRecordKeys[k] && v != nil {
+			record.Metadata[k] = v
+		}
+	}
+	return record
+}
+
+// payload returns the vector store payload of the record
+func (r ExportRecord) payload() map[string]interface{} {
+	payload := make(map[string]interface{}, len(r.Metadata)+7)
+	for k, v := range r.Metadata {
+		payload[k] = v
+	}
+	payload["data"] = r.Text
+	hash := r.Hash
+	if hash == "" {
+		sum := md5.Sum([]byte(r.Text))
+		hash = hex.EncodeToString(sum[:])
+	}
+	payload["hash"] = hash
+	for key, value := range map[string]string{"created_at": r.CreatedAt, "updated_at": r.UpdatedAt, "user_id": r.UserID, "agent_id": r.AgentID, "run_id": r.RunID} {
+		if value != "" {
+			payload[key] = value
+		}
+	}
+	payload, _ = migratePayloadTimes(payload)
+	return payload
+}
+
+// lastModified returns updated_at, or created_at for memories never updated
+func (r ExportRecord) lastModified() time.Time {
+	if r.UpdatedAt != "" {
+		return recordTime(r.UpdatedAt)
+	}
+	return recordTime(r.CreatedAt)
+}
+
+// recordTime parses an RFC3339 timestamp, the zero time if invalid
+func recordTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
+
+// mergeExportRecords merges an imported record into the existing one: the most recently
+// modified text wins, the earliest created_at is kept and list metadata (entities, events,
+// tags) are joined
+func mergeExportRecords(existing ExportRecord, imported ExportRecord) ExportRecord {
+	older, newer := existing, imported
+	if imported.lastModified().Before(existing.lastModified()) {
+		older, newer = imported, existing
+	}
+
+	merged := newer
+	if older.CreatedAt != "" && (merged.CreatedAt == "" || recordTime(older.CreatedAt).Before(recordTime(merged.CreatedAt))) {
+		merged.CreatedAt = older.CreatedAt
+	}
+	for _, field := range []struct{ merged, older *string }{
+		{&merged.UserID, &older.UserID}, {&merged.AgentID, &older.AgentID}, {&merged.RunID, &older.RunID},
+	} {
+		if *field.merged == "" {
+			*field.merged = *field.older
+		}
+	}
+
+	merged.Metadata = map[string]interface{}{}
+	for k, v := range older.Metadata {
+		merged.Metadata[k] = v
+	}
+	for k, v := range newer.Metadata {
+		merged.Metadata[k] = joinLists(merged.Metadata[k], v)
+	}
+
+	merged.History = imported.History
+	merged.Vector, merged.EmbeddingModel = nil, ""
+	if merged.Text == imported.Text {
+		merged.Vector, merged.EmbeddingModel = imported.Vector, imported.EmbeddingModel
+	}
+	return merged
+}
+
+// joinLists returns the union of two lists keeping their order, or b if either isn't a list
+func joinLists(a interface{}, b interface{}) interface{} {
+	listA, okA := a.([]interface{})
+	listB, okB := b.([]interface{})
+	if !okA || !okB {
+		return b
+	}
+	seen := map[string]bool{}
+	joined := []interface{}{}
+	for _, item := range append(append([]interface{}{}, listA...), listB...) {
+		key := fmt.Sprint(item)
+		if !seen[key] {
+			seen[key] = true
+			joined = append(joined, item)
+		}
+	}
+	return joined
+}
+
+// Export writes the memories matching filters (user_id, agent_id, run_id or any payload key)
+// to w as JSONL, one ExportRecord with its history per line. Vectors are included when
+// withVectors is true. Returns the number of memories written.
+func (m *Memory) Export(filters map[string]interface{}, w io.Writer, withVectors bool) (int, error) {
+	if filters == nil {
+		filters = make(map[string]interface{})
+	}
+	if err := m.applyTenant(filters); err != nil {
+		return 0, err
+	}
+
+	encoder := json.NewEncoder(w)
+	model := m.embeddingModel.Model()
+	count := 0
+	offset := ""
+	for {
+		points, next, err := m.vectorStore.Scroll(filters, 100, offset, withVectors)
+		if err != nil {
+			return count, fmt.Errorf("error listing memories: %w", err)
+		}
+		for _, point := range points {
+			record := newExportRecord(point.ID, point.Payload)
+			if record.History, err = m.db.GetHistory(record.ID); err != nil {
+				return count, err
+			}
+			if withVectors && len(point.Vector) > 0 {
+				record.Vector = point.Vector
+				record.EmbeddingModel = model
+			}
+			if err := encoder.Encode(record); err != nil {
+				return count, fmt.Errorf("error writing export: %w", err)
+			}
+			count++
+		}
+		if next == "" {
+			return count, nil
+		}
+		offset = next
+	}
+}
+
+// Import reads memories in the JSONL format of Export. Records whose id already exists are
+// handled according to mode. Invalid records are counted as failed and don't stop the import.
+// Vectors are reused when they come from the configured embedding model, otherwise the
+// text is embedded again.
+func (m *Memory) Import(r io.Reader, mode ImportMode) (*ImportReport, error) {
+	mode, err := ParseImportMode(string(mode))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.checkActiveCollection(); err != nil {
+		return nil, err
+	}
+	report := &ImportReport{}
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		content, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(content)) > 0 {
+			var record ExportRecord
+			if err := json.Unmarshal(content, &record); err != nil {
+				report.fail(line, fmt.Errorf("invalid record: %w", err))
+			} else if err := m.importRecord(record, mode, report); err != nil {
+				report.fail(line, err)
+			}
+		}
+		if readErr == io.EOF {
+			return report, nil
+		}
+		if readErr != nil {
+			return report, fmt.Errorf("error reading import: %w", readErr)
+		}
+	}
+}
+
+func (m *Memory) importRecord(record ExportRecord, mode ImportMode, report *ImportReport) error {
+	if record.ID == "" || record.Text == "" {
+		return errors.New("record requires id and text")
+	}
+	record.ID = plainPointID(record.ID)
+
+	existing, err := m.vectorStore.Get(record.ID)
+	if err != nil && !errors.Is(err, ErrMemoryNotFound) {
+		return fmt.Errorf("error getting memory %s: %w", record.ID, err)
+	}
+	exists := err == nil && existing != nil
+	if exists {
+		existingPayload := convertQdrantPayload(existing.Payload)
+		if err := m.checkTenant(record.ID, existingPayload); err != nil {
+			return err
+		}
+		if m.filter != nil && !m.filter.Matches(existingPayload) {
+			return fmt.Errorf("memory %s doesn't match the import filter", record.ID)
+		}
+		switch mode {
+		case ImportSkip:
+			report.Skipped++
+			return nil
+		case ImportMerge:
+			record = mergeExportRecords(newExportRecord(record.ID, existingPayload), record)
+		}
+	}
+
+	payload := record.payload()
+	if err := m.applyTenant(payload); err != nil {
+		return err
+	}
+	if m.filter != nil && !m.filter.Matches(payload) {
+		return fmt.Errorf("memory %s doesn't match the import filter", record.ID)
+	}
+	defer m.lockScope(payload)()
+
+	var vector []float64
+	if len(record.Vector) > 0 && record.EmbeddingModel == m.embeddingModel.Model() {
+		vector = make([]float64, len(record.Vector))
+		for i, v := range record.Vector {
+			vector[i] = float64(v)
+		}
+	} else if vector, _, err = m.embed(record.Text, "import", payload); err != nil {
+		return fmt.Errorf("error embedding memory %s: %w", record.ID, err)
+	}
+
+	if err := m.vectorStore.Insert([][]float64{vector}, []string{record.ID}, []map[string]interface{}{payload}); err != nil {
+		return fmt.Errorf("error inserting memory %s: %w", record.ID, err)
+	}
+	m.indexKeywords(record.ID, payload)
+
+	if exists && mode == ImportOverwrite {
+		if err := m.db.DeleteHistory(record.ID); err != nil {
+			return err
+		}
+	}
+	for _, row := range record.History {
+		row["memory_id"] = record.ID
+		row["tenant_id"] = payloadTenant(payload)
+	}
+	if len(record.History) == 0 && !exists {
+		createdAt := record.CreatedAt
+		if err := m.db.AddHistory(record.ID, payloadTenant(payload), nil, record.Text, "ADD", &createdAt, nil, 0); err != nil {
+			return err
+		}
+	} else if err := m.db.ImportHistory(record.History); err != nil {
+		return err
+	}
+
+	switch {
+	case !exists:
+		m.trackMemoryCount(payload, 1)
+		report.Created++
+	case mode == ImportOverwrite:
+		report.Overwritten++
+	default:
+		report.Merged++
+	}
+	return nil
+}
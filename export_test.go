@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeExportRecords(t *testing.T) {
+	existing := newExportRecord(`uuid:"4d3c1f0e-5b8a-4f44-9d3e-2a1b0c9d8e7f"`, map[string]interface{}{
+		"data":       "Likes coffee",
+		"created_at": "2024-11-01T10:00:00-03:00",
+		"updated_at": "2024-12-01T10:00:00-03:00",
+		"user_id":    "Blas",
+		"scope":      "personal",
+		"tags":       []interface{}{"coffee"},
+	})
+	assert.Equal(t, "4d3c1f0e-5b8a-4f44-9d3e-2a1b0c9d8e7f", existing.ID)
+	assert.Equal(t, "Likes coffee", existing.Text)
+
+	imported := ExportRecord{
+		ID:             existing.ID,
+		Text:           "Likes black coffee",
+		CreatedAt:      "2024-11-05T10:00:00-03:00",
+		UpdatedAt:      "2025-01-10T10:00:00-03:00",
+		AgentID:        "whatsapp",
+		Metadata:       map[string]interface{}{"tags": []interface{}{"coffee", "drinks"}},
+		Vector:         []float32{0.1, 0.2},
+		EmbeddingModel: "text-embedding-3-small",
+	}
+
+	merged := mergeExportRecords(existing, imported)
+	assert.Equal(t, "Likes black coffee", merged.Text)
+	assert.Equal(t, "2024-11-01T10:00:00-03:00", merged.CreatedAt)
+	assert.Equal(t, "Blas", merged.UserID)
+	assert.Equal(t, "whatsapp", merged.AgentID)
+	assert.Equal(t, "personal", merged.Metadata["scope"])
+	assert.Equal(t, []interface{}{"coffee", "drinks"}, merged.Metadata["tags"])
+	assert.Equal(t, imported.Vector, merged.Vector)
+
+	// an older import keeps the existing text, its vector can't be reused
+	imported.UpdatedAt = "2024-11-20T10:00:00-03:00"
+	merged = mergeExportRecords(existing, imported)
+	assert.Equal(t, "Likes coffee", merged.Text)
+	assert.Nil(t, merged.Vector)
+	assert.NotEmpty(t, merged.payload()["hash"])
+}
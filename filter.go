@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/matigumma/memGo/utils"
+)
+
+// filterExprKey - key of the filters map passed to the VectorStore holding the *Filter of WithFilter
+const filterExprKey = "$filter"
+
+// Filter - a filter expression over the memory payload, e.g. as JSON:
+//
+//	{"and": [
+//	  {"field": "tags", "any": ["chatbot", "whatsapp"]},
+//	  {"field": "created_at", "range": {"gte": "2025-01-01"}},
+//	  {"not": {"field": "sentiment", "eq": "negative"}}
+//	]}
+//
+// A node sets one of and, or, not, or a field with one condition.
+type Filter struct {
+	And []Filter `json:"and,omitempty"`
+	Or  []Filter `json:"or,omitempty"`
+	Not *Filter  `json:"not,omitempty"`
+
+	Field  string        `json:"field,omitempty"`
+	Eq     interface{}   `json:"eq,omitempty"`
+	In     []interface{} `json:"in,omitempty"`  // the value is one of these
+	Any    []interface{} `json:"any,omitempty"` // the list (e.g. tags) has one of these
+	Range  *FilterRange  `json:"range,omitempty"`
+	Exists *bool         `json:"exists,omitempty"`  // the field is set and not empty
+	IsNull *bool         `json:"is_null,omitempty"` // the field is set to null
+}
+
+// FilterRange - bounds of a range condition: numbers, or for created_at and updated_at
+// RFC3339 timestamps or YYYY-MM-DD dates (UTC)
+type FilterRange struct {
+	Gt  interface{} `json:"gt,omitempty"`
+	Gte interface{} `json:"gte,omitempty"`
+	Lt  interface{} `json:"lt,omitempty"`
+	Lte interface{} `json:"lte,omitempty"`
+}
+
+// dateFields are compared as timestamps by range conditions
+var dateFields = map[string]bool{"created_at": true, "updated_at": true}
+
+// ParseFilter reads a filter expression from JSON and validates it
+func ParseFilter(data []byte) (*Filter, error) {
+	var f Filter
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid filter: %w", err)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Validate checks that every node sets exactly one operator with valid operands
+func (f Filter) Validate() error {
+	operators := 0
+	for _, set := range []bool{f.And != nil, f.Or != nil, f.Not != nil, f.Eq != nil, f.In != nil, f.Any != nil, f.Range != nil, f.Exists != nil, f.IsNull != nil} {
+		if set {
+			operators++
+		}
+	}
+	if operators != 1 {
+		return errors.New("invalid filter: every node needs exactly one of and, or, not, eq, in, any, range, exists or is_null")
+	}
+	isCondition := f.And == nil && f.Or == nil && f.Not == nil
+	if isCondition && f.Field == "" {
+		return errors.New("invalid filter: conditions need a field")
+	}
+	if !isCondition && f.Field != "" {
+		return errors.New("invalid filter: and, or and not don't take a field")
+	}
+	if (f.And != nil && len(f.And) == 0) || (f.Or != nil && len(f.Or) == 0) {
+		return errors.New("invalid filter: and and or need at least one condition")
+	}
+	for _, child := range append(append([]Filter{}, f.And...), f.Or...) {
+		if err := child.Validate(); err != nil {
+			return err
+		}
+	}
+	if f.Not != nil {
+		return f.Not.Validate()
+	}
+	if f.Range != nil {
+		bounds := 0
+		for _, bound := range []interface{}{f.Range.Gt, f.Range.Gte, f.Range.Lt, f.Range.Lte} {
+			if bound == nil {
+				continue
+			}
+			bounds++
+			if _, err := f.rangeBound(bound); err != nil {
+				return err
+			}
+		}
+		if bounds == 0 {
+			return fmt.Errorf("invalid filter: range on %s needs a bound", f.Field)
+		}
+	}
+	return nil
+}
+
+// rangeBound returns a range bound as a float64, dates as Unix seconds
+func (f Filter) rangeBound(bound interface{}) (float64, error) {
+	if dateFields[f.Field] {
+		s, _ := bound.(string)
+		t, err := parseFilterTime(s)
+		if err != nil {
+			return 0, err
+		}
+		return float64(t.Unix()), nil
+	}
+	n, ok := filterNumber(bound)
+	if !ok {
+		return 0, fmt.Errorf("invalid filter: range on %s needs numbers", f.Field)
+	}
+	return n, nil
+}
+
+// parseFilterTime accepts RFC3339 timestamps and YYYY-MM-DD dates
+func parseFilterTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid filter: %q is not an RFC3339 timestamp or YYYY-MM-DD date", s)
+	}
+	return t, nil
+}
+
+func filterNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// WithFilter returns a copy of the Memory whose Search, HybridSearch and GetAll only
+// return the memories matching f, Forget only forgets them and Import only writes them
+func (m *Memory) WithFilter(f *Filter) *Memory {
+	scoped := *m
+	scoped.filter = f
+	return &scoped
+}
+
+// WithArchived returns a copy of the Memory whose Search, HybridSearch and GetAll also return
+// the memories archived by Forget
+func (m *Memory) WithArchived() *Memory {
+	scoped := *m
+	scoped.includeArchived = true
+	return &scoped
+}
+
+// filterExpr returns the filter of WithFilter, excluding the archived memories unless
+// WithArchived and the expired ones unless WithExpired; nil for none
+func (m *Memory) filterExpr() *Filter {
+	conditions := []Filter{}
+	if m.filter != nil {
+		conditions = append(conditions, *m.filter)
+	}
+	if !m.includeArchived {
+		conditions = append(conditions, Filter{Not: &Filter{Field: "archived", Eq: true}})
+	}
+	if !m.includeExpired {
+		expired := expiredFilter(time.Now())
+		conditions = append(conditions, Filter{Not: &expired})
+	}
+	switch len(conditions) {
+	case 0:
+		return nil
+	case 1:
+		return &conditions[0]
+	}
+	return &Filter{And: conditions}
+}
+
+// storeFilters returns filters with the filter expression of the Memory, for the vector store
+func (m *Memory) storeFilters(filters map[string]interface{}) map[string]interface{} {
+	expr := m.filterExpr()
+	if expr == nil {
+		return filters
+	}
+	return utils.MergeMaps(filters, map[string]interface{}{filterExprKey: expr})
+}
+
+// Matches evaluates the filter on a memory payload, for the memories not read through
+// the vector store (e.g. keyword hits of HybridSearch)
+func (f Filter) Matches(payload map[string]interface{}) bool {
+	switch {
+	case f.And != nil:
+		for _, child := range f.And {
+			if !child.Matches(payload) {
+				return false
+			}
+		}
+		return true
+	case f.Or != nil:
+		for _, child := range f.Or {
+			if child.Matches(payload) {
+				return true
+			}
+		}
+		return false
+	case f.Not != nil:
+		return !f.Not.Matches(payload)
+	}
+
+	value, set := payload[f.Field]
+	values := payloadValues(value)
+	switch {
+	case f.Exists != nil:
+		return *f.Exists == (set && value != nil && len(values) > 0)
+	case f.IsNull != nil:
+		return *f.IsNull == (set && value == nil)
+	case f.Eq != nil:
+		return containsFilterValue(values, f.Eq)
+	case f.In != nil, f.Any != nil:
+		for _, expected := range append(append([]interface{}{}, f.In...), f.Any...) {
+			if containsFilterValue(values, expected) {
+				return true
+			}
+		}
+		return false
+	case f.Range != nil:
+		if len(values) == 0 {
+			return false
+		}
+		var n float64
+		if dateFields[f.Field] {
+			s, _ := values[0].(string)
+			t, err := parseFilterTime(s)
+			if err != nil {
+				return false
+			}
+			n = float64(t.Unix())
+		} else if number, ok := filterNumber(values[0]); ok {
+			n = number
+		} else {
+			return false
+		}
+		check := func(bound interface{}, ok func(b float64) bool) bool {
+			if bound == nil {
+				return true
+			}
+			b, err := f.rangeBound(bound)
+			return err == nil && ok(b)
+		}
+		return check(f.Range.Gt, func(b float64) bool { return n > b }) &&
+			check(f.Range.Gte, func(b float64) bool { return n >= b }) &&
+			check(f.Range.Lt, func(b float64) bool { return n < b }) &&
+			check(f.Range.Lte, func(b float64) bool { return n <= b })
+	}
+	return false
+}
+
+// payloadValues returns a payload value as a list, lists as they are
+func payloadValues(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	case []string:
+		values := make([]interface{}, len(v))
+		for i, s := range v {
+			values[i] = s
+		}
+		return values
+	}
+	return []interface{}{value}
+}
+
+func containsFilterValue(values []interface{}, expected interface{}) bool {
+	for _, value := range values {
+		if a, ok := filterNumber(value); ok {
+			if b, ok := filterNumber(expected); ok && math.Abs(a-b) < 1e-9 {
+				return true
+			}
+			continue
+		}
+		if fmt.Sprint(value) == fmt.Sprint(expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the filter as JSON
+func (f Filter) String() string {
+	data, _ := json.Marshal(f)
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterMatches(t *testing.T) {
+	f, err := ParseFilter([]byte(`{"and": [
+		{"field": "tags", "any": ["chatbot", "whatsapp"]},
+		{"field": "created_at", "range": {"gte": "2025-01-01"}},
+		{"not": {"field": "sentiment", "eq": "negative"}},
+		{"or": [{"field": "priority", "range": {"gt": 2}}, {"field": "pinned", "exists": true}]}
+	]}`))
+	assert.NoError(t, err)
+
+	payload := map[string]interface{}{
+		"tags":       []interface{}{"whatsapp", "ventas"},
+		"created_at": "2025-03-10T12:00:00-03:00",
+		"sentiment":  "positive",
+		"priority":   3.0,
+	}
+	assert.True(t, f.Matches(payload))
+
+	payload["sentiment"] = "negative"
+	assert.False(t, f.Matches(payload))
+	payload["sentiment"] = "positive"
+
+	payload["created_at"] = "2024-12-31T23:00:00-03:00"
+	assert.True(t, f.Matches(payload)) // 2025-01-01T02:00:00Z
+	payload["created_at"] = "2024-12-30T10:00:00-03:00"
+	assert.False(t, f.Matches(payload))
+	payload["created_at"] = "2025-03-10T12:00:00-03:00"
+
+	payload["priority"] = 1.0
+	assert.False(t, f.Matches(payload))
+	payload["pinned"] = true
+	assert.True(t, f.Matches(payload))
+
+	for _, invalid := range []string{
+		`{"field": "tags"}`,
+		`{"eq": "x"}`,
+		`{"field": "tags", "eq": "x", "in": ["y"]}`,
+		`{"field": "created_at", "range": {"gte": "last week"}}`,
+		`{"field": "priority", "range": {}}`,
+		`{"and": [{"field": "priority", "range": {"gt": "high"}}]}`,
+		`{"and": []}`,
+		`{"not": {"or": []}}`,
+	} {
+		_, err := ParseFilter([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestFilterTranslations(t *testing.T) {
+	f, err := ParseFilter([]byte(`{"or": [
+		{"field": "tags", "in": ["chatbot", "whatsapp"]},
+		{"not": {"field": "priority", "range": {"gte": 2, "lt": 5}}}
+	]}`))
+	assert.NoError(t, err)
+
+	qf := (&Qdrant{})._createFilter(map[string]interface{}{"user_id": "Blas", filterExprKey: f})
+	assert.Len(t, qf.Must, 2)
+	expr := qdrantFilter(*f)
+	assert.Len(t, expr.Should, 2)
+	assert.Equal(t, []string{"chatbot", "whatsapp"}, expr.Should[0].GetFilter().Must[0].GetField().Match.GetKeywords().Strings)
+	assert.NotNil(t, expr.Should[1].GetFilter().MustNot[0].GetFilter().Must[0].GetField().Range)
+
+	where, err := chromaWhere(map[string]interface{}{"user_id": "Blas", filterExprKey: f})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"$and": []map[string]interface{}{
+		{"$or": []map[string]interface{}{
+			{"tags": map[string]interface{}{"$in": []interface{}{"chatbot", "whatsapp"}}},
+			{"$or": []map[string]interface{}{
+				{"priority": map[string]interface{}{"$lt": 2.0}},
+				{"priority": map[string]interface{}{"$gte": 5.0}},
+			}},
+		}},
+		{"user_id": map[string]interface{}{"$eq": "Blas"}},
+	}}, where)
+
+	sql, args, err := pgvectorWhere(map[string]interface{}{"user_id": "Blas", filterExprKey: f})
+	assert.NoError(t, err)
+	assert.Equal(t, `(COALESCE(payload->$1 @> $2::jsonb OR payload->$1 @> $3::jsonb, FALSE) OR NOT COALESCE((payload->>$4)::numeric >= $5 AND (payload->>$4)::numeric < $6, FALSE)) AND COALESCE(payload->$7 @> $8::jsonb, FALSE)`, sql)
+	assert.Equal(t, []interface{}{"tags", `"chatbot"`, `"whatsapp"`, "priority", 2.0, 5.0, "user_id", `"Blas"`}, args)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// Memory events of Forget, in the history and for webhooks
+const (
+	EventArchive = "ARCHIVE"
+	EventForget  = "FORGET"
+)
+
+// ForgettingConfig - the forgetting policy, see Memory.Forget
+type ForgettingConfig struct {
+	Enabled           bool               `json:"enabled"`                          // run Forget periodically in the server
+	IntervalMinutes   int                `json:"interval_minutes" default:"1440"`  // between runs
+	Action            string             `json:"action" default:"archive"`         // archive or delete
+	Threshold         float64            `json:"threshold" default:"0.05"`         // retention below which memories are forgotten
+	AgentThresholds   map[string]float64 `json:"agent_thresholds,omitempty"`       // threshold per agent_id
+	HalfLifeDays      float64            `json:"half_life_days" default:"60"`      // without accesses, retention halves every half life
+	DefaultImportance float64            `json:"default_importance" default:"0.5"` // of memories stored without an importance
+}
+
+func (fc ForgettingConfig) validate() []error {
+	errs := []error{}
+	if fc.Action != "archive" && fc.Action != "delete" {
+		errs = append(errs, fmt.Errorf("forgetting.action must be archive or delete, got %q", fc.Action))
+	}
+	if fc.IntervalMinutes < 1 {
+		errs = append(errs, errors.New("forgetting.interval_minutes must be at least 1"))
+	}
+	if fc.HalfLifeDays <= 0 {
+		errs = append(errs, errors.New("forgetting.half_life_days must be positive"))
+	}
+	for name, threshold := range map[string]float64{"threshold": fc.Threshold, "default_importance": fc.DefaultImportance} {
+		if threshold < 0 || threshold > 1 {
+			errs = append(errs, fmt.Errorf("forgetting.%s must be between 0 and 1", name))
+		}
+	}
+	for agentID, threshold := range fc.AgentThresholds {
+		if threshold < 0 || threshold > 1 {
+			errs = append(errs, fmt.Errorf("forgetting.agent_thresholds.%s must be between 0 and 1", agentID))
+		}
+	}
+	return errs
+}
+
+// ForgottenMemory - a memory archived or deleted by Forget
+type ForgottenMemory struct {
+	ID        string  `json:"id"`
+	Memory    string  `json:"memory"`
+	AgentID   string  `json:"agent_id,omitempty"`
+	Retention float64 `json:"retention"`
+	Action    string  `json:"action"` // archive or delete
+}
+
+// retention returns the decayed importance of a memory: its importance halves every half
+// life since it was last accessed (or updated, or created), and every access extends the
+// half life by another one
+func (fc ForgettingConfig) retention(payload map[string]interface{}, accesses int, lastAccessed time.Time, now time.Time) float64 {
+	importance, ok := payload["importance"].(float64)
+	if !ok {
+		importance = fc.DefaultImportance
+	}
+	last := lastAccessed
+	for _, key := range []string{"updated_at", "created_at"} {
+		if epoch, ok := epochOf(payload[key]); ok && time.Unix(epoch, 0).After(last) {
+			last = time.Unix(epoch, 0)
+		}
+	}
+	if last.IsZero() {
+		return importance
+	}
+	age := math.Max(now.Sub(last).Hours()/24, 0)
+	return importance * math.Pow(0.5, age/(fc.HalfLifeDays*float64(1+accesses)))
+}
+
+// recordAccess counts an access to the memories returned by Search and Get, see Forget
+func (m *Memory) recordAccess(memories ...map[string]interface{}) {
+	ids := make([]string, 0, len(memories))
+	for _, memory := range memories {
+		ids = append(ids, plainPointID(fmt.Sprint(memory["id"])))
+	}
+	if err := m.db.RecordAccess(ids); err != nil {
+		log.Printf("Error recording memory access: %v", err)
+	}
+}
+
+// Forget archives (or deletes, per forgetting.action) the memories of the tenant whose
+// retention fell below the threshold of their agent, recording it in their history. Archived
+// memories are left out of Search and GetAll, see WithArchived. With dryRun nothing changes.
+func (m *Memory) Forget(dryRun bool) ([]ForgottenMemory, error) {
+	policy := m.config.Forgetting
+	filters := map[string]interface{}{}
+	if err := m.applyTenant(filters); err != nil {
+		return nil, err
+	}
+	expr := &Filter{Not: &Filter{Field: "archived", Eq: true}}
+	if m.filter != nil {
+		expr = &Filter{And: []Filter{*expr, *m.filter}}
+	}
+	filters[filterExprKey] = expr
+
+	now := time.Now()
+	forgotten := []ForgottenMemory{}
+	offset := ""
+	for {
+		page, next, err := m.vectorStore.Scroll(filters, 256, offset, policy.Action == "archive")
+		if err != nil {
+			return forgotten, fmt.Errorf("error listing memories: %w", err)
+		}
+		ids := make([]string, len(page))
+		for i, memory := range page {
+			ids[i] = plainPointID(memory.ID)
+		}
+		accesses, err := m.db.GetAccess(ids)
+		if err != nil {
+			return forgotten, err
+		}
+
+		for i, memory := range page {
+			agentID, _ := memory.Payload["agent_id"].(string)
+			threshold, ok := policy.AgentThresholds[agentID]
+			if !ok {
+				threshold = policy.Threshold
+			}
+			access := accesses[ids[i]]
+			retention := policy.retention(memory.Payload, access.Count, access.LastAccessed, now)
+			if retention >= threshold {
+				continue
+			}
+			data, _ := memory.Payload["data"].(string)
+			if !dryRun {
+				ok, err := m.forgetMemory(ids[i], memory, policy.Action)
+				if err != nil {
+					return forgotten, err
+				}
+				if !ok {
+					continue
+				}
+			}
+			forgotten = append(forgotten, ForgottenMemory{ID: ids[i], Memory: data, AgentID: agentID, Retention: retention, Action: policy.Action})
+		}
+		if next == "" {
+			return forgotten, nil
+		}
+		offset = next
+	}
+}
+
+// forgetMemory archives or deletes a memory listed by Forget under the lock of its scope.
+// A memory updated, deleted or archived since it was listed is left alone (false).
+func (m *Memory) forgetMemory(memoryID string, memory SearchResult, action string) (bool, error) {
+	defer m.lockScope(memory.Payload)()
+	current, err := m.unchangedPayload(memory)
+	if err != nil || current == nil || current["archived"] == true {
+		return false, err
+	}
+	if action == "delete" {
+		return true, m.deleteMemory(memoryID, EventForget)
+	}
+
+	payload := copyPayload(current)
+	payload["archived"] = true
+	payload["archived_at"], payload["archived_at_ts"] = timestamp(time.Now())
+	if err := m.upsertPayload(memoryID, memory.Vector, payload); err != nil {
+		return false, err
+	}
+
+	data, _ := payload["data"].(string)
+	now := payload["archived_at"].(string)
+	if err := m.db.AddHistory(memoryID, payloadTenant(payload), &data, data, EventArchive, &now, &now, 0); err != nil {
+		log.Printf("Error adding history: %v", err) // Non-critical error
+	}
+	m.emitMemoryEvent(EventArchive, memoryID, data, data, payload)
+	return true, nil
+}
+
+// StartForgetting runs Forget every forgetting.interval_minutes when forgetting.enabled
+func (m *Memory) StartForgetting(ctx context.Context) {
+	if !m.config.Forgetting.Enabled {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(max(m.config.Forgetting.IntervalMinutes, 1)) * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			forgotten, err := m.systemScope().Forget(false)
+			if err != nil {
+				log.Printf("Error forgetting memories: %v", err)
+			}
+			if len(forgotten) > 0 {
+				log.Printf("Forgot %d memories (%s)", len(forgotten), m.config.Forgetting.Action)
+			}
+		}
+	}()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForgettingRetention(t *testing.T) {
+	policy := NewMemoryConfig().Forgetting
+	assert.Empty(t, policy.validate())
+	assert.Equal(t, "archive", policy.Action)
+
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	trivia := map[string]interface{}{"data": "Dijo buen día", "importance": 0.1, "created_at": "2025-04-02T00:00:00Z"}
+	assert.InDelta(t, 0.05, policy.retention(trivia, 0, time.Time{}, now), 1e-9) // one half life
+	assert.InDelta(t, 0.1*0.7071067811865476, policy.retention(trivia, 1, time.Time{}, now), 1e-9)
+	assert.InDelta(t, 0.1, policy.retention(trivia, 1, now, now), 1e-9)
+
+	phone := map[string]interface{}{"data": "Su número es 11 5555-1234", "created_at": "2025-04-02T00:00:00Z"}
+	assert.InDelta(t, 0.25, policy.retention(phone, 0, time.Time{}, now), 1e-9) // default importance
+
+	db, err := sqlitemanager.NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+	m := &Memory{config: NewMemoryConfig(), db: db}
+	m1, m2 := "a039176a-3aae-43e1-ab55-e5cfda3c6777", "0b54783e-8048-4f56-950b-b711ba40eb64"
+	m.recordAccess(map[string]interface{}{"id": `uuid:"` + m1 + `"`}, map[string]interface{}{"id": m2})
+	m.recordAccess(map[string]interface{}{"id": m1})
+	accesses, err := db.GetAccess([]string{m1, m2, "m3"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, accesses[m1].Count)
+	assert.Equal(t, 1, accesses[m2].Count)
+	assert.NotContains(t, accesses, "m3")
+
+	expr := m.filterExpr()
+	assert.True(t, expr.Matches(map[string]interface{}{"data": "x"}))
+	assert.False(t, expr.Matches(map[string]interface{}{"data": "x", "archived": true}))
+	assert.True(t, m.WithArchived().filterExpr().Matches(map[string]interface{}{"data": "x", "archived": true}))
+}
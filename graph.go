@@ -0,0 +1,350 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/matigumma/memGo/chains"
+	"github.com/matigumma/memGo/sqlitemanager"
+)
+
+// GraphConfig - the knowledge graph of entities and relations extracted from the memories
+type GraphConfig struct {
+	Enabled          bool    `json:"enabled"`                         // extract triples from every memory stored, and merge graph hits into Search
+	EntitySimilarity float64 `json:"entity_similarity" default:"0.9"` // similarity of names from which two entities are the same one
+	Depth            int     `json:"depth" default:"1"`               // hops from the entities named in a query
+	MaxResults       int     `json:"max_results" default:"3"`         // memories added to Search by the graph
+	Weight           float64 `json:"weight" default:"0.5"`            // score of a graph hit one hop away, halved per extra hop
+}
+
+func (gc GraphConfig) validate() []error {
+	errs := []error{}
+	if gc.EntitySimilarity <= 0 || gc.EntitySimilarity > 1 {
+		errs = append(errs, errors.New("graph.entity_similarity must be greater than 0 and at most 1"))
+	}
+	if gc.Depth < 1 {
+		errs = append(errs, errors.New("graph.depth must be at least 1"))
+	}
+	if gc.MaxResults < 0 {
+		errs = append(errs, errors.New("graph.max_results can't be negative"))
+	}
+	if gc.Weight < 0 || gc.Weight > 1 {
+		errs = append(errs, errors.New("graph.weight must be between 0 and 1"))
+	}
+	return errs
+}
+
+// graphTriple - a triple of GRAPH_EXTRACTION
+type graphTriple struct {
+	Source, SourceType, Relation, Target, TargetType string
+}
+
+// graphTriples returns the triples of GRAPH_EXTRACTION with their relations as
+// lowercase_words, dropping the incomplete ones and those relating an entity to itself
+func graphTriples(result map[string]interface{}) []graphTriple {
+	items, _ := result["triples"].([]interface{})
+	triples := []graphTriple{}
+	for _, item := range items {
+		entry, _ := item.(map[string]interface{})
+		str := func(key string) string {
+			s, _ := entry[key].(string)
+			return strings.TrimSpace(s)
+		}
+		triple := graphTriple{Source: str("source"), SourceType: str("source_type"), Target: str("target"), TargetType: str("target_type")}
+		triple.Relation = strings.Join(strings.Fields(strings.ToLower(str("relation"))), "_")
+		if triple.Source == "" || triple.Relation == "" || triple.Target == "" || foldText(triple.Source) == foldText(triple.Target) {
+			continue
+		}
+		triples = append(triples, triple)
+	}
+	return triples
+}
+
+// entityWords returns text folded with every run of non alphanumeric characters as a space
+func entityWords(text string) string {
+	return strings.Join(strings.FieldsFunc(foldText(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// graphMentions returns the entities whose name appears in query, as whole words
+func graphMentions(query string, entities []sqlitemanager.GraphEntity) []sqlitemanager.GraphEntity {
+	text := " " + entityWords(query) + " "
+	mentioned := []sqlitemanager.GraphEntity{}
+	for _, entity := range entities {
+		if name := entityWords(entity.Name); name != "" && strings.Contains(text, " "+name+" ") {
+			mentioned = append(mentioned, entity)
+		}
+	}
+	return mentioned
+}
+
+// mostSimilarEntity returns the id of the entity whose name embedding is the most similar to
+// embedding, at least threshold similar; "" for none
+func mostSimilarEntity(entities []sqlitemanager.GraphEntity, embedding []float32, threshold float64) string {
+	bestID, best := "", threshold
+	for _, entity := range entities {
+		if len(entity.Embedding) != len(embedding) {
+			continue
+		}
+		if similarity := cosineSimilarity(entity.Embedding, embedding); similarity >= best {
+			bestID, best = entity.ID, similarity
+		}
+	}
+	return bestID
+}
+
+// describeRelation returns a triple as "source -relation-> target"
+func describeRelation(relation sqlitemanager.GraphRelation) string {
+	return fmt.Sprintf("%s -%s-> %s", relation.Source, relation.Relation, relation.Target)
+}
+
+// indexGraph extracts the triples of a memory into the knowledge graph when graph.enabled.
+// Errors are logged: the memory is stored anyway and RebuildGraph repairs the graph.
+func (m *Memory) indexGraph(memoryID string, payload map[string]interface{}) {
+	if !m.config.Graph.Enabled {
+		return
+	}
+	memoryID = plainPointID(memoryID)
+	if err := m.extractGraph(memoryID, payload); err != nil {
+		log.Printf("Error extracting the graph of memory %s: %v", memoryID, err)
+	}
+}
+
+func (m *Memory) unindexGraph(memoryID string) {
+	if err := m.db.DeleteGraphRelations(plainPointID(memoryID)); err != nil {
+		log.Printf("Error removing the graph of memory %s: %v", memoryID, err)
+	}
+}
+
+// extractGraph replaces the triples of a memory by the ones the LLM extracts from its data.
+// Entities are those of the scope of the memory with the same or a similar name, or new ones.
+func (m *Memory) extractGraph(memoryID string, payload map[string]interface{}) error {
+	if err := m.db.DeleteGraphRelations(memoryID); err != nil {
+		return err
+	}
+	data, _ := payload["data"].(string)
+	speaker, _ := payload["user_id"].(string)
+	if speaker == "" {
+		speaker, _ = payload["agent_id"].(string)
+	}
+	hints := []string{}
+	switch entities := payload["related_entities"].(type) {
+	case []string:
+		hints = entities
+	case []interface{}:
+		for _, entity := range entities {
+			hints = append(hints, fmt.Sprint(entity))
+		}
+	}
+	result, err := chains.NewChain(m.debug, nil).WithUsage(m.chainUsage(payload)).GRAPH_EXTRACTION(data, speaker, hints)
+	if err != nil {
+		return fmt.Errorf("error generating response for GRAPH_EXTRACTION: %w", err)
+	}
+	triples := graphTriples(result)
+	if len(triples) == 0 {
+		return nil
+	}
+
+	scope := keywordScope(payload)
+	stored, err := m.db.GraphEntities(scope)
+	if err != nil {
+		return err
+	}
+	// the scope of a query matches any value of its empty fields, entities are those of this one
+	entities := []sqlitemanager.GraphEntity{}
+	for _, entity := range stored {
+		if entity.Scope == scope {
+			entities = append(entities, entity)
+		}
+	}
+	resolve := func(name string, entityType string) (string, error) {
+		for _, entity := range entities {
+			if foldText(entity.Name) == foldText(name) {
+				return entity.ID, nil
+			}
+		}
+		_, embedding, err := m.embed(name, "graph.entity", payload)
+		if err != nil {
+			return "", fmt.Errorf("error embedding entity: %w", err)
+		}
+		if id := mostSimilarEntity(entities, embedding, m.config.Graph.EntitySimilarity); id != "" {
+			return id, nil
+		}
+		entity := sqlitemanager.GraphEntity{ID: uuid.New().String(), Name: name, Type: entityType, Scope: scope, Embedding: embedding}
+		if err := m.db.AddGraphEntity(entity); err != nil {
+			return "", err
+		}
+		entities = append(entities, entity)
+		return entity.ID, nil
+	}
+
+	for _, triple := range triples {
+		sourceID, err := resolve(triple.Source, triple.SourceType)
+		if err != nil {
+			return err
+		}
+		targetID, err := resolve(triple.Target, triple.TargetType)
+		if err != nil {
+			return err
+		}
+		if sourceID == targetID {
+			continue
+		}
+		relation := sqlitemanager.GraphRelation{ID: uuid.New().String(), SourceID: sourceID, Relation: triple.Relation, TargetID: targetID, MemoryID: memoryID}
+		if err := m.db.AddGraphRelation(relation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildGraph extracts again the triples of every memory of the tenant (all of them without
+// one), e.g. for memories stored before graph.enabled. Returns how many memories.
+func (m *Memory) RebuildGraph() (int, error) {
+	filters := map[string]interface{}{}
+	if err := m.applyTenant(filters); err != nil {
+		return 0, err
+	}
+	if m.tenantID == "" {
+		if err := m.db.ClearGraph(); err != nil {
+			return 0, err
+		}
+	}
+	count := 0
+	offset := ""
+	for {
+		page, next, err := m.vectorStore.Scroll(filters, 256, offset, false)
+		if err != nil {
+			return count, fmt.Errorf("error listing memories: %w", err)
+		}
+		for _, memory := range page {
+			if err := m.extractGraph(plainPointID(memory.ID), memory.Payload); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if next == "" {
+			return count, nil
+		}
+		offset = next
+	}
+}
+
+// GraphNeighbourhood returns the triples within depth hops of the entities of the scope named
+// entity, or with the most similar name, nearest first
+func (m *Memory) GraphNeighbourhood(entity string, userID *string, agentID *string, runID *string, depth int) ([]sqlitemanager.GraphRelation, error) {
+	scope := map[string]interface{}{}
+	for key, value := range map[string]*string{"user_id": userID, "agent_id": agentID, "run_id": runID} {
+		if value != nil {
+			scope[key] = *value
+		}
+	}
+	if err := m.applyTenant(scope); err != nil {
+		return nil, err
+	}
+	if depth <= 0 {
+		depth = m.config.Graph.Depth
+	}
+	entities, err := m.db.GraphEntities(keywordScope(scope))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, candidate := range entities {
+		if foldText(candidate.Name) == foldText(entity) {
+			ids = append(ids, candidate.ID)
+		}
+	}
+	if len(ids) == 0 && len(entities) > 0 {
+		_, embedding, err := m.embed(entity, "graph.search", scope)
+		if err != nil {
+			return nil, fmt.Errorf("error embedding entity: %w", err)
+		}
+		if id := mostSimilarEntity(entities, embedding, m.config.Graph.EntitySimilarity); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return []sqlitemanager.GraphRelation{}, nil
+	}
+	return m.db.GraphNeighbourhood(ids, depth)
+}
+
+// mergeGraphResults adds to the results of Search the triples relating them to the entities
+// named in query, as "graph", and appends up to graph.max_results other memories within
+// graph.depth hops of those entities, scored graph.weight halved per extra hop. Search sorts
+// them with its own results before keeping its limit.
+func (m *Memory) mergeGraphResults(query string, filters map[string]interface{}, results []map[string]interface{}) []map[string]interface{} {
+	policy := m.config.Graph
+	entities, err := m.db.GraphEntities(keywordScope(filters))
+	if err != nil {
+		log.Printf("Error reading graph entities: %v", err)
+		return results
+	}
+	mentioned := graphMentions(query, entities)
+	if len(mentioned) == 0 {
+		return results
+	}
+	ids := make([]string, len(mentioned))
+	for i, entity := range mentioned {
+		ids[i] = entity.ID
+	}
+	relations, err := m.db.GraphNeighbourhood(ids, max(policy.Depth, 1))
+	if err != nil {
+		log.Printf("Error reading graph neighbourhood: %v", err)
+		return results
+	}
+
+	byMemory := map[string][]sqlitemanager.GraphRelation{}
+	order := []string{}
+	for _, relation := range relations {
+		if _, ok := byMemory[relation.MemoryID]; !ok {
+			order = append(order, relation.MemoryID)
+		}
+		byMemory[relation.MemoryID] = append(byMemory[relation.MemoryID], relation)
+	}
+	describe := func(relations []sqlitemanager.GraphRelation) []string {
+		descriptions := make([]string, len(relations))
+		for i, relation := range relations {
+			descriptions[i] = describeRelation(relation)
+		}
+		return descriptions
+	}
+
+	found := map[string]bool{}
+	for _, result := range results {
+		id := plainPointID(fmt.Sprint(result["id"]))
+		found[id] = true
+		if relations, ok := byMemory[id]; ok {
+			result["graph"] = describe(relations)
+		}
+	}
+	// relations come nearest first, so do their memories
+	added := 0
+	for _, memoryID := range order {
+		if added >= policy.MaxResults {
+			break
+		}
+		if found[memoryID] {
+			continue
+		}
+		memory := m.getMatching(memoryID, filters)
+		if memory == nil {
+			continue
+		}
+		hops := byMemory[memoryID][0].Hops
+		memory["id"] = memoryID
+		memory["graph"] = describe(byMemory[memoryID])
+		memory["graph_score"] = policy.Weight / float64(int(1)<<(hops-1))
+		memory["score"] = memory["graph_score"]
+		results = append(results, memory)
+		added++
+	}
+	return results
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraph(t *testing.T) {
+	assert.Empty(t, NewMemoryConfig().Graph.validate())
+
+	triples := graphTriples(map[string]interface{}{"triples": []interface{}{
+		map[string]interface{}{"source": "Blas", "source_type": "persona", "relation": "Trabaja en", "target": " ITR ", "target_type": "organizacion"},
+		map[string]interface{}{"source": "Blas", "relation": "es", "target": "blas"},
+		map[string]interface{}{"source": "ITR", "relation": "", "target": "chatbot"},
+	}})
+	assert.Equal(t, []graphTriple{{Source: "Blas", SourceType: "persona", Relation: "trabaja_en", Target: "ITR", TargetType: "organizacion"}}, triples)
+
+	entities := []sqlitemanager.GraphEntity{
+		{ID: "blas", Name: "Blas", Embedding: []float32{1, 0}},
+		{ID: "itr", Name: "ITR", Embedding: []float32{0, 1}},
+		{ID: "cordoba", Name: "Córdoba", Embedding: []float32{0.7, 0.7}},
+	}
+	mentioned := graphMentions("¿qué hace Blas en ITR, en cordoba?", entities)
+	assert.Len(t, mentioned, 3)
+	assert.Empty(t, graphMentions("itrs y blasfemias", entities))
+
+	assert.Equal(t, "itr", mostSimilarEntity(entities, []float32{0.1, 1}, 0.9))
+	assert.Equal(t, "", mostSimilarEntity(entities, []float32{1, -1}, 0.9))
+
+	db, err := sqlitemanager.NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+	blas := sqlitemanager.GraphScope{UserID: "Blas"}
+	assert.NoError(t, db.AddGraphEntity(sqlitemanager.GraphEntity{ID: "blas", Name: "Blas", Scope: blas}))
+	assert.NoError(t, db.AddGraphEntity(sqlitemanager.GraphEntity{ID: "itr", Name: "ITR", Scope: blas}))
+	m1 := "a039176a-3aae-43e1-ab55-e5cfda3c6777"
+	assert.NoError(t, db.AddGraphRelation(sqlitemanager.GraphRelation{ID: "r1", SourceID: "blas", Relation: "trabaja_en", TargetID: "itr", MemoryID: m1}))
+
+	m := &Memory{config: NewMemoryConfig(), db: db}
+	results := []map[string]interface{}{{"id": m1, "memory": "Trabaja en ITR", "score": 0.8}}
+	results = m.mergeGraphResults("¿dónde trabaja? ITR", map[string]interface{}{"user_id": "Blas"}, results)
+	assert.Len(t, results, 1)
+	assert.Equal(t, []string{"Blas -trabaja_en-> ITR"}, results[0]["graph"])
+
+	results = m.mergeGraphResults("nada que ver", map[string]interface{}{"user_id": "Blas"}, []map[string]interface{}{{"id": m1}})
+	assert.Nil(t, results[0]["graph"])
+}
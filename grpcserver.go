@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/matigumma/memGo/memorypb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// grpcServer implements memorypb.MemoryServiceServer with the same Memory as the REST server
+type grpcServer struct {
+	memorypb.UnimplementedMemoryServiceServer
+	m *Memory
+}
+
+type grpcPrincipalKey struct{}
+
+// grpcAuth authenticates the x-api-key or authorization metadata like authMiddleware
+func grpcAuth(ctx context.Context, a *Authenticator) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	token := ""
+	if values := md.Get("x-api-key"); len(values) > 0 {
+		token = values[0]
+	} else if values := md.Get("authorization"); len(values) > 0 {
+		token = strings.TrimPrefix(values[0], "Bearer ")
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing credentials")
+	}
+	principal, err := a.Authenticate(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return context.WithValue(ctx, grpcPrincipalKey{}, principal), nil
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authenticatedStream) Context() context.Context { return s.ctx }
+
+// NewGRPCServer creates the gRPC server of the MemoryService, with server reflection
+func NewGRPCServer(m *Memory) (*grpc.Server, error) {
+	opts := []grpc.ServerOption{}
+	if m.config.Auth.Enabled {
+		authenticator, err := NewAuthenticator(m.config.Auth)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				ctx, err := grpcAuth(ctx, authenticator)
+				if err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				ctx, err := grpcAuth(ss.Context(), authenticator)
+				if err != nil {
+					return err
+				}
+				return handler(srv, authenticatedStream{ss, ctx})
+			}),
+		)
+	}
+	server := grpc.NewServer(opts...)
+	memorypb.RegisterMemoryServiceServer(server, &grpcServer{m: m})
+	reflection.Register(server)
+	return server, nil
+}
+
+// StartGRPCServer serves the MemoryService on server.grpc_addr in the background
+func StartGRPCServer(m *Memory) {
+	addr := m.config.Server.GRPCAddr
+	if addr == "" {
+		return
+	}
+	server, err := NewGRPCServer(m)
+	if err != nil {
+		log.Fatalf("Error initializing gRPC authentication: %v", err)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Error listening for gRPC on %s: %v", addr, err)
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Printf("gRPC server stopped: %v", err)
+		}
+	}()
+}
+
+// memory returns the Memory of the caller's tenant and checks that it may act as agentID
+func (s *grpcServer) memory(ctx context.Context, agentID string) (*Memory, error) {
+	principal, _ := ctx.Value(grpcPrincipalKey{}).(*Principal)
+	if principal == nil {
+		return s.m, nil
+	}
+	if !principal.AllowsAgent(agentID) {
+		return nil, status.Errorf(codes.PermissionDenied, "agent_id %q not allowed", agentID)
+	}
+	return s.m.WithTenant(principal.Tenant), nil
+}
+
+// memoryOf returns the Memory of the caller's tenant and checks the agent memoryID belongs to
+func (s *grpcServer) memoryOf(ctx context.Context, memoryID string) (*Memory, error) {
+	if memoryID == "" {
+		return nil, status.Error(codes.InvalidArgument, "memory_id is required")
+	}
+	principal, _ := ctx.Value(grpcPrincipalKey{}).(*Principal)
+	if principal == nil {
+		return s.m, nil
+	}
+	m := s.m.WithTenant(principal.Tenant)
+	memory, err := m.Get(memoryID)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if memory == nil {
+		return nil, status.Errorf(codes.NotFound, "memory with ID %s not found", memoryID)
+	}
+	if agentID, _ := memory["agent_id"].(string); !principal.AllowsAgent(agentID) {
+		return nil, status.Errorf(codes.PermissionDenied, "agent_id %q not allowed", agentID)
+	}
+	return m, nil
+}
+
+// grpcError maps the Memory errors to gRPC status codes
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var quotaErr *QuotaExceededError
+	switch {
+	case errors.As(err, &quotaErr):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, ErrTenantRequired):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case strings.Contains(err.Error(), "not found"):
+		return status.Error(codes.NotFound, err.Error())
+	case strings.Contains(err.Error(), "missing parameters"), strings.Contains(err.Error(), "is required"), strings.Contains(err.Error(), "not allowed"):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// scopeIDs returns the ids of a Scope, nil when not set
+func scopeIDs(scope *memorypb.Scope) (userID, agentID, runID *string) {
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+	return optional(scope.GetUserId()), optional(scope.GetAgentId()), optional(scope.GetRunId())
+}
+
+// toStruct converts a memory map to a Struct, through JSON so []string and friends are accepted
+func toStruct(value map[string]interface{}) *structpb.Struct {
+	if len(value) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var plain map[string]interface{}
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return nil
+	}
+	result, err := structpb.NewStruct(plain)
+	if err != nil {
+		return nil
+	}
+	return result
+}
+
+// toMemoryItem converts a memory as returned by Get, GetAll or Search
+func toMemoryItem(memory map[string]interface{}) *memorypb.MemoryItem {
+	str := func(key string) string {
+		if memory[key] == nil {
+			return ""
+		}
+		return fmt.Sprint(memory[key])
+	}
+	item := &memorypb.MemoryItem{
+		Id:        plainPointID(str("id")),
+		Memory:    str("memory"),
+		Hash:      str("hash"),
+		CreatedAt: str("created_at"),
+		UpdatedAt: str("updated_at"),
+		UserId:    str("user_id"),
+		AgentId:   str("agent_id"),
+		RunId:     str("run_id"),
+	}
+	if score, ok := memory["score"].(float64); ok {
+		s := float32(score)
+		item.Score = &s
+	}
+	if metadata, ok := memory["metadata"].(map[string]interface{}); ok {
+		item.Metadata = toStruct(metadata)
+	}
+	return item
+}
+
+func toMemoryItems(memories []map[string]interface{}) []*memorypb.MemoryItem {
+	items := make([]*memorypb.MemoryItem, 0, len(memories))
+	for _, memory := range memories {
+		items = append(items, toMemoryItem(memory))
+	}
+	return items
+}
+
+func messageResponse(result map[string]interface{}) *memorypb.MessageResponse {
+	message, _ := result["message"].(string)
+	return &memorypb.MessageResponse{Message: message}
+}
+
+// Add streams the steps of Memory.Add, see AddProgress
+func (s *grpcServer) Add(req *memorypb.AddRequest, stream memorypb.MemoryService_AddServer) error {
+	if strings.TrimSpace(req.GetData()) == "" {
+		return status.Error(codes.InvalidArgument, "data is required")
+	}
+	m, err := s.memory(stream.Context(), req.GetScope().GetAgentId())
+	if err != nil {
+		return err
+	}
+	stages := map[string]memorypb.AddProgress_Stage{
+		"facts":   memorypb.AddProgress_STAGE_FACTS,
+		"actions": memorypb.AddProgress_STAGE_ACTIONS,
+		"event":   memorypb.AddProgress_STAGE_EVENT,
+	}
+	var sendErr error
+	m = m.WithProgress(func(p AddProgress) {
+		progress := &memorypb.AddProgress{Stage: stages[p.Stage], Message: p.Message}
+		if p.Event != nil {
+			data, _ := p.Event["data"].(string)
+			progress.Event = &memorypb.MemoryEvent{
+				Id:    plainPointID(fmt.Sprint(p.Event["id"])),
+				Event: strings.ToUpper(strings.TrimSuffix(fmt.Sprint(p.Event["event"]), "_")),
+				Data:  data,
+			}
+		}
+		if sendErr == nil {
+			sendErr = stream.Send(progress)
+		}
+	})
+
+	userID, agentID, runID := scopeIDs(req.GetScope())
+	result, err := m.Add(req.GetData(), userID, agentID, runID, req.GetMetadata().AsMap(), req.GetFilters().AsMap(), nil, nil)
+	if err != nil {
+		return grpcError(err)
+	}
+	if sendErr != nil {
+		return sendErr
+	}
+	message, _ := result["message"].(string)
+	if details, ok := result["details"].(string); ok {
+		message += ": " + details
+	}
+	return stream.Send(&memorypb.AddProgress{Stage: memorypb.AddProgress_STAGE_DONE, Message: message})
+}
+
+func (s *grpcServer) Search(ctx context.Context, req *memorypb.SearchRequest) (*memorypb.SearchResponse, error) {
+	if strings.TrimSpace(req.GetQuery()) == "" {
+		return nil, status.Error(codes.InvalidArgument, "query is required")
+	}
+	m, err := s.memory(ctx, req.GetScope().GetAgentId())
+	if err != nil {
+		return nil, err
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = 100
+	}
+	userID, agentID, runID := scopeIDs(req.GetScope())
+	memories, err := m.Search(req.GetQuery(), userID, agentID, runID, limit, req.GetFilters().AsMap(), req.ScoreThreshold)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &memorypb.SearchResponse{Results: toMemoryItems(memories)}, nil
+}
+
+func (s *grpcServer) Get(ctx context.Context, req *memorypb.GetRequest) (*memorypb.MemoryItem, error) {
+	memoryID := plainPointID(req.GetMemoryId())
+	m, err := s.memoryOf(ctx, memoryID)
+	if err != nil {
+		return nil, err
+	}
+	memory, err := m.Get(memoryID)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if memory == nil {
+		return nil, status.Errorf(codes.NotFound, "memory with ID %s not found", memoryID)
+	}
+	return toMemoryItem(memory), nil
+}
+
+func (s *grpcServer) List(ctx context.Context, req *memorypb.ListRequest) (*memorypb.ListResponse, error) {
+	m, err := s.memory(ctx, req.GetScope().GetAgentId())
+	if err != nil {
+		return nil, err
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = 100
+	}
+	userID, agentID, runID := scopeIDs(req.GetScope())
+	memories, err := m.GetAll(userID, agentID, runID, limit)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &memorypb.ListResponse{Results: toMemoryItems(memories)}, nil
+}
+
+func (s *grpcServer) Update(ctx context.Context, req *memorypb.UpdateRequest) (*memorypb.MessageResponse, error) {
+	if strings.TrimSpace(req.GetData()) == "" {
+		return nil, status.Error(codes.InvalidArgument, "data is required")
+	}
+	memoryID := plainPointID(req.GetMemoryId())
+	m, err := s.memoryOf(ctx, memoryID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := m.Update(memoryID, req.GetData(), nil)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return messageResponse(result), nil
+}
+
+func (s *grpcServer) Delete(ctx context.Context, req *memorypb.DeleteRequest) (*memorypb.MessageResponse, error) {
+	memoryID := plainPointID(req.GetMemoryId())
+	m, err := s.memoryOf(ctx, memoryID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := m.Delete(memoryID)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return messageResponse(result), nil
+}
+
+func (s *grpcServer) DeleteAll(ctx context.Context, req *memorypb.DeleteAllRequest) (*memorypb.MessageResponse, error) {
+	m, err := s.memory(ctx, req.GetScope().GetAgentId())
+	if err != nil {
+		return nil, err
+	}
+	userID, agentID, runID := scopeIDs(req.GetScope())
+	if userID == nil && agentID == nil && runID == nil {
+		return nil, status.Error(codes.InvalidArgument, "one of user_id, agent_id or run_id is required")
+	}
+	result, err := m.DeleteAll(userID, agentID, runID)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return messageResponse(result), nil
+}
+
+func (s *grpcServer) History(ctx context.Context, req *memorypb.HistoryRequest) (*memorypb.HistoryResponse, error) {
+	memoryID := plainPointID(req.GetMemoryId())
+	m, err := s.memoryOf(ctx, memoryID)
+	if err != nil {
+		return nil, err
+	}
+	history, err := m.History(memoryID)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	str := func(value interface{}) string {
+		switch v := value.(type) {
+		case string:
+			return v
+		case *string:
+			if v != nil {
+				return *v
+			}
+		}
+		return ""
+	}
+	entries := make([]*memorypb.HistoryEntry, 0, len(history))
+	for _, row := range history {
+		entries = append(entries, &memorypb.HistoryEntry{
+			Id:        str(row["id"]),
+			MemoryId:  str(row["memory_id"]),
+			OldMemory: str(row["old_memory"]),
+			NewMemory: str(row["new_memory"]),
+			Event:     str(row["event"]),
+			CreatedAt: str(row["created_at"]),
+			UpdatedAt: str(row["updated_at"]),
+		})
+	}
+	return &memorypb.HistoryResponse{Results: entries}, nil
+}
+
+// Reset is only allowed to admins, like the other instance wide operations
+func (s *grpcServer) Reset(ctx context.Context, req *memorypb.ResetRequest) (*memorypb.MessageResponse, error) {
+	if principal, _ := ctx.Value(grpcPrincipalKey{}).(*Principal); principal != nil && !principal.Admin {
+		return nil, status.Error(codes.PermissionDenied, "admin credentials required")
+	}
+	if err := s.m.Reset(); err != nil {
+		return nil, grpcError(err)
+	}
+	return &memorypb.MessageResponse{Message: "Memory reset successfully!"}, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/matigumma/memGo/memorypb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCServer(t *testing.T) {
+	server, err := NewGRPCServer(&Memory{config: NewMemoryConfig()})
+	assert.NoError(t, err)
+	listener := bufconn.Listen(1024 * 1024)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := memorypb.NewMemoryServiceClient(conn)
+
+	_, err = client.Get(context.Background(), &memorypb.GetRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err := client.Add(context.Background(), &memorypb.AddRequest{Scope: &memorypb.Scope{UserId: "u"}})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	assert.Equal(t, codes.ResourceExhausted, status.Code(grpcError(&QuotaExceededError{Key: "user_id:u", Limit: "requests_per_minute"})))
+	assert.Equal(t, codes.PermissionDenied, status.Code(grpcError(ErrTenantRequired)))
+}
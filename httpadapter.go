@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/matigumma/memGo/sqlitemanager"
 )
 
 // Mock function to simulate streaming events
@@ -24,9 +30,11 @@ func mockStream(c *gin.Context) {
 // Handler for /v1/memory/add
 func addMemoryHandler(c *gin.Context, m *Memory) {
 	var requestBody struct {
-		Text    string `json:"text"`
-		UserID  string `json:"user_id"`
-		AgentID string `json:"agent_id"`
+		Text      string `json:"text"`
+		UserID    string `json:"user_id"`
+		AgentID   string `json:"agent_id"`
+		ExpiresAt string `json:"expires_at"` // RFC3339 or YYYY-MM-DD, see SweepExpired
+		TTL       string `json:"ttl"`        // duration such as 48h, instead of expires_at
 	}
 
 	if err := c.ShouldBindJSON(&requestBody); err != nil {
@@ -34,6 +42,37 @@ func addMemoryHandler(c *gin.Context, m *Memory) {
 		return
 	}
 
+	m = tenantMemory(c, m, requestBody.AgentID)
+	if m == nil {
+		return
+	}
+
+	var metadata map[string]interface{}
+	if requestBody.ExpiresAt != "" || requestBody.TTL != "" {
+		expiry, err := parseExpiry(requestBody.ExpiresAt, requestBody.TTL, m.displayLocation(requestBody.UserID))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		metadata = map[string]interface{}{}
+		setExpiry(metadata, expiry)
+	}
+
+	if !enforceQuota(c, m, requestBody.UserID, requestBody.AgentID) {
+		return
+	}
+
+	if c.Query("async") == "true" {
+		job, err := m.EnqueueAdd(requestBody.Text, &requestBody.UserID, &requestBody.AgentID, nil, metadata)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Location", "/v1/jobs/"+job.ID)
+		c.JSON(http.StatusAccepted, gin.H{"job_id": job.ID, "status": job.Status})
+		return
+	}
+
 	// Start streaming
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 
@@ -55,13 +94,14 @@ func addMemoryHandler(c *gin.Context, m *Memory) {
 		&requestBody.UserID,  // user_id
 		&requestBody.AgentID, // agent_id
 		nil,                  // run_id
-		nil,                  // metadata
+		metadata,             // metadata
 		nil,                  // filters
 		nil,                  // custom prompt
 		c,                    // gin context
 	)
 	if err != nil {
-		log.Fatalf("Error in Memory.Add: %v", err)
+		respondMemoryError(c, err)
+		return
 	}
 
 	_ = res
@@ -79,22 +119,94 @@ func retrieveMemoryHandler(c *gin.Context, m *Memory) {
 		Query   string `json:"query" binding:"required"`
 		UserID  string `json:"user_id" binding:"required"`
 		AgentID string `json:"agent_id" binding:"required"`
+		// "hybrid" fuses the similarity and keyword rankings with these weights, see HybridSearch
+		Mode          string  `json:"mode"`
+		VectorWeight  float64 `json:"vector_weight"`
+		KeywordWeight float64 `json:"keyword_weight"`
+		// reranks the results, empty fields use the rerank config, see WithRerank
+		Rerank *struct {
+			Provider   string  `json:"provider"`
+			Model      string  `json:"model"`
+			Candidates int     `json:"candidates"`
+			Cutoff     float64 `json:"cutoff"`
+		} `json:"rerank" form:"-"`
+		// restricts the results, see Filter. JSON only: Filter is recursive and can't be bound from a form.
+		Filter *Filter `json:"filter" form:"-"`
+		// creation window as RFC3339 or YYYY-MM-DD, otherwise read from the query (e.g. "last
+		// week"), see ParseTimeWindow. Dates and results are in the IANA timezone, by default
+		// the one of the user, see SetUserTimeZone.
+		Since    string `json:"since"`
+		Until    string `json:"until"`
+		TimeZone string `json:"timezone"`
+		// favours recent memories, empty fields use the recency config, see WithRecency
+		Recency *struct {
+			HalfLifeDays float64 `json:"half_life_days"`
+			Weight       float64 `json:"weight"`
+		} `json:"recency" form:"-"`
 	}
 
-	if err := c.Bind(&json); err != nil {
+	if err := c.ShouldBind(&json); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
+	if json.Filter != nil {
+		if err := json.Filter.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	query := json.Query
 	userID := json.UserID
 	agentID := json.AgentID
 
 	fmt.Printf("Query %s, user_id %s, agent_id %s\n", query, userID, agentID)
 
+	m = tenantMemory(c, m, agentID)
+	if m == nil {
+		return
+	}
+
+	if !enforceQuota(c, m, userID, agentID) {
+		return
+	}
+	if rerank := json.Rerank; rerank != nil {
+		m = m.WithRerank(RerankOptions{Provider: rerank.Provider, Model: rerank.Model, Candidates: rerank.Candidates, Cutoff: rerank.Cutoff})
+	}
+	if json.Filter != nil {
+		m = m.WithFilter(json.Filter)
+	}
+	if json.TimeZone != "" {
+		loc, err := time.LoadLocation(json.TimeZone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid timezone: %v", err)})
+			return
+		}
+		m = m.WithTimeZone(loc)
+	}
+	window, err := searchTimeWindow(query, json.Since, json.Until, m.displayLocation(userID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	m = m.WithTimeWindow(window)
+	if recency := json.Recency; recency != nil {
+		m = m.WithRecency(RecencyOptions{HalfLife: time.Duration(recency.HalfLifeDays * 24 * float64(time.Hour)), Weight: recency.Weight})
+	}
+
 	// declaro busqueda con un threshold  muy permisivo
-	searchResults, err := m.Search(query, &userID, &agentID, nil, 5, nil, float32Ptr(0.8))
+	var searchResults []map[string]interface{}
+	switch json.Mode {
+	case "", "vector":
+		searchResults, err = m.Search(query, &userID, &agentID, nil, 5, nil, float32Ptr(0.8))
+	case "hybrid":
+		searchResults, err = m.HybridSearch(query, &userID, &agentID, nil, 5, nil, HybridOptions{VectorWeight: json.VectorWeight, KeywordWeight: json.KeywordWeight})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be vector or hybrid"})
+		return
+	}
 	if err != nil {
-		log.Fatalf("Error searching memory: %v", err)
+		respondMemoryError(c, err)
+		return
 	}
 	fmt.Printf("Search results for query : %+v\n", searchResults)
 
@@ -118,15 +230,95 @@ func retrieveMemoryHandler(c *gin.Context, m *Memory) {
 	c.JSON(http.StatusOK, gin.H{"thoughts": Thoughts})
 }
 
+// enforceQuota checks the user and agent quotas without consuming them, sets the
+// X-RateLimit-* headers and answers 429 if the quota is exhausted.
+// Returns false if the request must not continue.
+func enforceQuota(c *gin.Context, m *Memory, userID string, agentID string) bool {
+	scope := map[string]interface{}{"user_id": userID, "agent_id": agentID}
+	status, err := m.CheckQuota(scope, false)
+	if status != nil {
+		if status.RequestLimit >= 0 {
+			remaining := status.RequestRemaining
+			if err == nil {
+				remaining-- // this request will consume one
+			}
+			c.Header("X-RateLimit-Limit", strconv.Itoa(status.RequestLimit))
+			c.Header("X-RateLimit-Remaining", strconv.Itoa(max(remaining, 0)))
+			c.Header("X-RateLimit-Reset", strconv.FormatInt(status.RequestReset.Unix(), 10))
+		}
+		if status.TokenLimit >= 0 {
+			c.Header("X-TokenBudget-Limit", strconv.Itoa(status.TokenLimit))
+			c.Header("X-TokenBudget-Remaining", strconv.Itoa(status.TokenRemaining))
+		}
+	}
+	if respondQuotaError(c, err) {
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// respondMemoryError answers a failed Add or Search: 429 for exhausted quotas, 400 for invalid
+// search options and 500 otherwise. Once the add stream started the error is sent as an event.
+func respondMemoryError(c *gin.Context, err error) {
+	if c.Writer.Written() {
+		c.SSEvent("error", err.Error())
+		return
+	}
+	if respondQuotaError(c, err) {
+		return
+	}
+	status := http.StatusInternalServerError
+	if errors.Is(err, ErrInvalidSearch) {
+		status = http.StatusBadRequest
+	}
+	if errors.Is(err, ErrCollectionReplaced) {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// respondQuotaError answers 429 if err is a QuotaExceededError and reports whether it did
+func respondQuotaError(c *gin.Context, err error) bool {
+	var quotaErr *QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	if quotaErr.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(quotaErr.RetryAfter.Seconds())+1))
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": quotaErr.Error(),
+		"key":   quotaErr.Key,
+		"limit": quotaErr.Limit,
+		"max":   quotaErr.Max,
+		"used":  quotaErr.Used,
+	})
+	return true
+}
+
 // StartServer initializes and starts the Gin server
 func StartServer(m *Memory) {
+	// timestamps stored before they were kept in UTC, rewritten before anything else writes
+	m.migrateTimestampsOnce()
+
 	r := gin.Default()
 
-	// Disable CORS
+	// CORS, any origin unless server.cors_allowed_origins is set
+	allowedOrigins := m.config.Server.CORSAllowedOrigins
 	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
+		origin := c.GetHeader("Origin")
+		if len(allowedOrigins) == 0 {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else if slices.Contains(allowedOrigins, origin) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Vary", "Origin")
+		}
 		c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-MemGo-User-Id, X-MemGo-Agent-Id, X-MemGo-Run-Id, Mcp-Session-Id, Mcp-Protocol-Version")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
 			return
@@ -134,6 +326,14 @@ func StartServer(m *Memory) {
 		c.Next()
 	})
 
+	if m.config.Auth.Enabled {
+		authenticator, err := NewAuthenticator(m.config.Auth)
+		if err != nil {
+			log.Fatalf("Error initializing authentication: %v", err)
+		}
+		r.Use(authMiddleware(authenticator))
+	}
+
 	// Define routes
 	r.POST("/v1/memory/add", func(c *gin.Context) {
 		addMemoryHandler(c, m)
@@ -144,9 +344,363 @@ func StartServer(m *Memory) {
 	r.POST("/v1/memory/history", func(c *gin.Context) {
 		historyMemoryHandler(c, m)
 	})
+	r.GET("/v1/usage", func(c *gin.Context) {
+		usageHandler(c, m)
+	})
+	r.GET("/v1/memory/export", func(c *gin.Context) {
+		exportMemoryHandler(c, m)
+	})
+	r.POST("/v1/memory/import", func(c *gin.Context) {
+		importMemoryHandler(c, m)
+	})
+	r.POST("/v1/chat", func(c *gin.Context) {
+		chatHandler(c, m)
+	})
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		chatCompletionsHandler(c, m)
+	})
+	r.GET("/v1/jobs/:id", func(c *gin.Context) {
+		jobHandler(c, m)
+	})
+	r.POST("/v1/memory/forget", func(c *gin.Context) {
+		forgetHandler(c, m)
+	})
+	r.GET("/v1/graph/neighbourhood", func(c *gin.Context) {
+		graphNeighbourhoodHandler(c, m)
+	})
+	r.POST("/v1/memory/consolidate", func(c *gin.Context) {
+		consolidateHandler(c, m)
+	})
+	r.GET("/v1/users/:user_id/timezone", func(c *gin.Context) {
+		userTimeZoneHandler(c, m)
+	})
+	r.POST("/v1/users/:user_id/timezone", func(c *gin.Context) {
+		userTimeZoneHandler(c, m)
+	})
+	r.POST("/mcp", func(c *gin.Context) {
+		mcpHandler(c, m)
+	})
+	r.GET("/mcp", func(c *gin.Context) {
+		mcpHandler(c, m)
+	})
+	ingests := newIngestRunner()
+	r.POST("/v1/ingest", func(c *gin.Context) {
+		startIngestHandler(c, m, ingests)
+	})
+	r.GET("/v1/ingest/:source", func(c *gin.Context) {
+		ingestStatusHandler(c, m, ingests)
+	})
+	r.POST("/v1/ingest/:source/pause", func(c *gin.Context) {
+		pauseIngestHandler(c, ingests)
+	})
+
+	// asynchronous adds, see EnqueueAdd
+	m.StartJobWorkers(context.Background())
+	m.StartWebhookDispatcher(context.Background())
+	m.StartForgetting(context.Background())
+	m.StartExpirySweeper(context.Background())
+	m.StartConsolidation(context.Background())
+
+	// the gRPC API, see memorypb/memory.proto
+	StartGRPCServer(m)
 
 	// Start the server
-	r.Run(":8080")
+	addr := m.config.Server.Addr
+	if addr == "" {
+		addr = ":8080"
+	}
+	r.Run(addr)
+}
+
+// parseUsageTime accepts RFC3339 timestamps or YYYY-MM-DD dates and returns them as UTC RFC3339
+func parseUsageTime(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC().Format(time.RFC3339), nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return "", fmt.Errorf("invalid time %q, expected RFC3339 or YYYY-MM-DD", value)
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// Handler for /v1/usage
+// query params: from, to, user_id, agent_id, run_id, group_by (comma separated)
+func usageHandler(c *gin.Context, m *Memory) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	from, err := parseUsageTime(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseUsageTime(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := sqlitemanager.UsageQuery{
+		From:    from,
+		To:      to,
+		UserID:  c.Query("user_id"),
+		AgentID: c.Query("agent_id"),
+		RunID:   c.Query("run_id"),
+	}
+	if groupBy := c.Query("group_by"); groupBy != "" {
+		query.GroupBy = strings.Split(groupBy, ",")
+	}
+
+	totals, err := m.Usage(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"from": from, "to": to, "totals": totals})
+}
+
+// Handler for /v1/memory/export
+// query params: user_id, agent_id, run_id, vectors (true to include them). Streams JSONL.
+func exportMemoryHandler(c *gin.Context, m *Memory) {
+	agentID := c.Query("agent_id")
+	m = tenantMemory(c, m, agentID)
+	if m == nil {
+		return
+	}
+
+	filters := map[string]interface{}{}
+	for _, key := range []string{"user_id", "agent_id", "run_id"} {
+		if value := c.Query(key); value != "" {
+			filters[key] = value
+		}
+	}
+	withVectors := c.Query("vectors") == "true"
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="memgo-export.jsonl"`)
+	count, err := m.Export(filters, c.Writer, withVectors)
+	if err != nil {
+		if count == 0 && !c.Writer.Written() {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// the status was already sent, the client gets a truncated export
+		log.Printf("Error exporting memories after %d records: %v", count, err)
+	}
+}
+
+// Handler for /v1/memory/import
+// query params: mode (skip, overwrite or merge). The body is the JSONL of /v1/memory/export.
+func importMemoryHandler(c *gin.Context, m *Memory) {
+	if !requireAdmin(c) {
+		return
+	}
+	m = tenantWideMemory(c, m)
+	mode, err := ParseImportMode(c.Query("mode"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := m.Import(c.Request.Body, mode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// Handler for /v1/chat
+// With "stream": true the answer is sent as server-sent "token" events followed by a "done"
+// event with the ChatResponse, or an "error" event.
+func chatHandler(c *gin.Context, m *Memory) {
+	var requestBody struct {
+		Query    string     `json:"query" binding:"required"`
+		UserID   string     `json:"user_id"`
+		AgentID  string     `json:"agent_id"`
+		RunID    string     `json:"run_id"`
+		Limit    int        `json:"limit"`
+		History  []ChatTurn `json:"history"`
+		Remember bool       `json:"remember"`
+		Stream   bool       `json:"stream"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	m = tenantMemory(c, m, requestBody.AgentID)
+	if m == nil {
+		return
+	}
+	if !enforceQuota(c, m, requestBody.UserID, requestBody.AgentID) {
+		return
+	}
+
+	opts := ChatOptions{Limit: requestBody.Limit, History: requestBody.History, Remember: requestBody.Remember}
+	for _, field := range []struct {
+		value string
+		dest  **string
+	}{{requestBody.UserID, &opts.UserID}, {requestBody.AgentID, &opts.AgentID}, {requestBody.RunID, &opts.RunID}} {
+		if field.value != "" {
+			value := field.value
+			*field.dest = &value
+		}
+	}
+
+	if !requestBody.Stream {
+		response, err := m.Chat(c.Request.Context(), requestBody.Query, opts)
+		if respondQuotaError(c, err) {
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	streaming := false
+	startStream := func() {
+		if !streaming {
+			streaming = true
+			c.Writer.Header().Set("Content-Type", "text/event-stream")
+			c.Writer.Header().Set("Cache-Control", "no-cache")
+			c.Writer.Header().Set("Connection", "keep-alive")
+		}
+	}
+	opts.OnToken = func(token string) error {
+		startStream()
+		c.SSEvent("token", token)
+		c.Writer.Flush()
+		return c.Request.Context().Err()
+	}
+	response, err := m.Chat(c.Request.Context(), requestBody.Query, opts)
+	// errors before the first token, e.g. quotas, keep their status code
+	if !streaming && respondQuotaError(c, err) {
+		return
+	}
+	startStream()
+	if err != nil {
+		c.SSEvent("error", err.Error())
+		return
+	}
+	c.SSEvent("done", response)
+}
+
+// Handler for /v1/jobs/:id
+func jobHandler(c *gin.Context, m *Memory) {
+	// any principal of the tenant may poll its jobs, whatever agent_id enqueued them
+	if principal := principalFrom(c); principal != nil {
+		m = m.WithTenant(principal.Tenant)
+	}
+	job, err := m.GetJob(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// Handler for POST /v1/ingest
+// query params: source (required), format (whatsapp or jsonl, detected if empty), agent_id, run_id,
+// gap (e.g. 10m), max_messages, concurrency, timezone (of WhatsApp timestamps), restart (true to
+// discard the checkpoint). The body is the archive. Answers 202 and ingests in the background.
+func startIngestHandler(c *gin.Context, m *Memory, ingests *ingestRunner) {
+	if !requireAdmin(c) {
+		return
+	}
+	opts := IngestOptions{
+		Source:  c.Query("source"),
+		AgentID: c.Query("agent_id"),
+		RunID:   c.Query("run_id"),
+		Restart: c.Query("restart") == "true",
+	}
+	if opts.Source == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source is required"})
+		return
+	}
+	m = tenantMemory(c, m, opts.AgentID)
+	if m == nil {
+		return
+	}
+
+	var err error
+	if gap := c.Query("gap"); gap != "" {
+		if opts.WindowGap, err = time.ParseDuration(gap); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid gap: %v", err)})
+			return
+		}
+	}
+	for param, value := range map[string]*int{"max_messages": &opts.MaxWindowMessages, "concurrency": &opts.Concurrency} {
+		if raw := c.Query(param); raw != "" {
+			if *value, err = strconv.Atoi(raw); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid %s: %v", param, err)})
+				return
+			}
+		}
+	}
+	loc := time.Local
+	if tz := c.Query("timezone"); tz != "" {
+		if loc, err = time.LoadLocation(tz); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid timezone: %v", err)})
+			return
+		}
+	}
+
+	messages, err := ParseChatArchive(c.Request.Body, c.Query("format"), loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !ingests.start(m, messages, opts) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("ingestion of %s is already running", opts.Source)})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"source": opts.Source, "messages": len(messages), "status": sqlitemanager.IngestRunning})
+}
+
+// Handler for GET /v1/ingest/:source
+func ingestStatusHandler(c *gin.Context, m *Memory, ingests *ingestRunner) {
+	if !requireAdmin(c) {
+		return
+	}
+	source := c.Param("source")
+	status, err := m.db.GetIngest(source)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if status == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("no ingestion named %s", source)})
+		return
+	}
+	running, report := ingests.state(source)
+	c.JSON(http.StatusOK, gin.H{"ingest": status, "running": running, "report": report})
+}
+
+// Handler for POST /v1/ingest/:source/pause, resume by posting the archive again
+func pauseIngestHandler(c *gin.Context, ingests *ingestRunner) {
+	if !requireAdmin(c) {
+		return
+	}
+	source := c.Param("source")
+	if !ingests.pause(source) {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("ingestion of %s is not running", source)})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"source": source, "status": sqlitemanager.IngestPaused})
 }
 
 type Message struct {
@@ -212,3 +766,104 @@ func historyMemoryHandler(c *gin.Context, m *Memory) {
 
 	c.JSON(http.StatusOK, gin.H{"messages": messages})
 }
+
+// Handler for GET and POST /v1/users/:user_id/timezone: shows or sets ({"timezone": "..."},
+// "" for the timezone config) the time zone timestamps are shown in to the user
+func userTimeZoneHandler(c *gin.Context, m *Memory) {
+	m = tenantWideMemory(c, m)
+	userID := c.Param("user_id")
+	if c.Request.Method == http.MethodPost {
+		var body struct {
+			TimeZone *string `json:"timezone" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		if err := m.SetUserTimeZone(userID, *body.TimeZone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	timeZone, err := m.UserTimeZone(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "timezone": timeZone, "effective": m.displayLocation(userID).String()})
+}
+
+// Handler for POST /v1/memory/forget[?dry_run=true]: runs the forgetting policy over the
+// tenant now, see Memory.Forget
+func forgetHandler(c *gin.Context, m *Memory) {
+	if !requireAdmin(c) {
+		return
+	}
+	m = tenantWideMemory(c, m)
+	forgotten, err := m.Forget(c.Query("dry_run") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"forgotten": forgotten})
+}
+
+// Handler for POST /v1/memory/consolidate[?user_id=&agent_id=&run_id=&dry_run=true]: runs the
+// consolidation job over a scope now, or over every scope of the tenant for admins, see
+// Memory.Consolidate
+func consolidateHandler(c *gin.Context, m *Memory) {
+	optional := func(key string) *string {
+		if value := c.Query(key); value != "" {
+			return &value
+		}
+		return nil
+	}
+	userID, agentID, runID := optional("user_id"), optional("agent_id"), optional("run_id")
+	if userID == nil && agentID == nil && runID == nil && !requireAdmin(c) {
+		return
+	}
+	m = tenantMemory(c, m, c.Query("agent_id"))
+	if m == nil {
+		return
+	}
+	consolidations, err := m.Consolidate(userID, agentID, runID, c.Query("dry_run") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "consolidations": consolidations})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"consolidations": consolidations})
+}
+
+// Handler for GET /v1/graph/neighbourhood?entity=&user_id=&agent_id=&run_id=&depth=: the
+// knowledge graph triples around an entity, see Memory.GraphNeighbourhood
+func graphNeighbourhoodHandler(c *gin.Context, m *Memory) {
+	entity := c.Query("entity")
+	if entity == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "entity is required"})
+		return
+	}
+	depth := 0
+	if c.Query("depth") != "" {
+		var err error
+		if depth, err = strconv.Atoi(c.Query("depth")); err != nil || depth < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "depth must be a positive integer"})
+			return
+		}
+	}
+	optional := func(key string) *string {
+		if value := c.Query(key); value != "" {
+			return &value
+		}
+		return nil
+	}
+	m = tenantMemory(c, m, c.Query("agent_id"))
+	if m == nil {
+		return
+	}
+	relations, err := m.GraphNeighbourhood(entity, optional("user_id"), optional("agent_id"), optional("run_id"), depth)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entity": entity, "relations": relations})
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/matigumma/memGo/utils"
+	"golang.org/x/text/unicode/norm"
+)
+
+// HybridOptions - weights of the rankings fused by HybridSearch
+type HybridOptions struct {
+	VectorWeight  float64 // weight of the similarity ranking, defaults to 1
+	KeywordWeight float64 // weight of the BM25 ranking, defaults to 1
+	K             int     // reciprocal rank fusion constant, defaults to 60
+	Candidates    int     // results taken from each ranking, defaults to 4 * limit (at least 20)
+}
+
+// keywordTerms splits text in lowercase terms without accents and counts them. Words mixing
+// digits and separators, e.g. phone numbers or product codes, are also indexed joined.
+func keywordTerms(text string) map[string]int {
+	isWordRune := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+	terms := map[string]int{}
+	for _, word := range strings.Fields(foldText(text)) {
+		parts := strings.FieldsFunc(word, func(r rune) bool { return !isWordRune(r) })
+		for _, part := range parts {
+			if len([]rune(part)) > 1 || unicode.IsDigit([]rune(part)[0]) {
+				terms[part]++
+			}
+		}
+		if joined := strings.Join(parts, ""); len(parts) > 1 && strings.IndexFunc(joined, unicode.IsDigit) >= 0 {
+			terms[joined]++
+		}
+	}
+	return terms
+}
+
+// foldText lowercases text and removes its accents
+func foldText(text string) string {
+	var folded strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(text)) {
+		if !unicode.Is(unicode.Mn, r) {
+			folded.WriteRune(r)
+		}
+	}
+	return folded.String()
+}
+
+// keywordText is the text of a memory payload indexed for keyword search: data and tags
+func keywordText(payload map[string]interface{}) string {
+	texts := []string{fmt.Sprint(payload["data"])}
+	switch tags := payload["tags"].(type) {
+	case []string:
+		texts = append(texts, tags...)
+	case []interface{}:
+		for _, tag := range tags {
+			texts = append(texts, fmt.Sprint(tag))
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+// keywordScope returns the ids of a payload or filter map
+func keywordScope(values map[string]interface{}) sqlitemanager.KeywordScope {
+	str := func(key string) string {
+		s, _ := values[key].(string)
+		return s
+	}
+	return sqlitemanager.KeywordScope{TenantID: str("tenant_id"), UserID: str("user_id"), AgentID: str("agent_id"), RunID: str("run_id")}
+}
+
+// indexKeywords adds a memory to the keyword index of HybridSearch. Errors are logged: the
+// memory is stored anyway and RebuildKeywordIndex repairs the index.
+func (m *Memory) indexKeywords(memoryID string, payload map[string]interface{}) {
+	memoryID = plainPointID(memoryID)
+	if err := m.db.IndexKeywords(memoryID, keywordScope(payload), keywordTerms(keywordText(payload))); err != nil {
+		log.Printf("Error indexing keywords of memory %s: %v", memoryID, err)
+	}
+}
+
+func (m *Memory) unindexKeywords(memoryID string) {
+	if err := m.db.DeleteKeywords(plainPointID(memoryID)); err != nil {
+		log.Printf("Error removing keywords of memory %s: %v", memoryID, err)
+	}
+}
+
+// RebuildKeywordIndex indexes every memory of the tenant (all of them without one) for
+// HybridSearch, e.g. for memories stored before the index existed. Returns how many.
+func (m *Memory) RebuildKeywordIndex() (int, error) {
+	filters := map[string]interface{}{}
+	if err := m.applyTenant(filters); err != nil {
+		return 0, err
+	}
+	if m.tenantID == "" {
+		if err := m.db.ClearKeywords(); err != nil {
+			return 0, err
+		}
+	}
+	count := 0
+	offset := ""
+	for {
+		page, next, err := m.vectorStore.Scroll(filters, 256, offset, false)
+		if err != nil {
+			return count, fmt.Errorf("error listing memories: %w", err)
+		}
+		for _, memory := range page {
+			m.indexKeywords(memory.ID, memory.Payload)
+			count++
+		}
+		if next == "" {
+			return count, nil
+		}
+		offset = next
+	}
+}
+
+// HybridSearch ranks the memories of the scope by similarity to query and by BM25 over their
+// data and tags, and fuses both rankings with reciprocal rank fusion:
+// score = VectorWeight/(K+vector rank) + KeywordWeight/(K+keyword rank).
+// Results have the fused "score", and "vector_score" and "keyword_score" when ranked by them.
+func (m *Memory) HybridSearch(query string, userID *string, agentID *string, runID *string, limit int, filters map[string]interface{}, opts HybridOptions) ([]map[string]interface{}, error) {
+	if opts.VectorWeight < 0 || opts.KeywordWeight < 0 {
+		return nil, fmt.Errorf("%w: hybrid search weights can't be negative", ErrInvalidSearch)
+	}
+	if opts.VectorWeight == 0 && opts.KeywordWeight == 0 {
+		opts.VectorWeight, opts.KeywordWeight = 1, 1
+	}
+	if opts.K <= 0 {
+		opts.K = 60
+	}
+	if limit <= 0 {
+		limit = 5
+	}
+	if opts.Candidates <= 0 {
+		opts.Candidates = max(limit*4, 20)
+	}
+
+	filters = utils.MergeMaps(filters, nil) // Search adds the scope to the map
+	vectorResults, err := m.Search(query, userID, agentID, runID, opts.Candidates, filters, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := map[string]interface{}{}
+	for key, value := range map[string]*string{"user_id": userID, "agent_id": agentID, "run_id": runID} {
+		if value != nil {
+			scope[key] = *value
+		}
+	}
+	if err := m.applyTenant(scope); err != nil {
+		return nil, err
+	}
+	terms := []string{}
+	for term := range keywordTerms(query) {
+		terms = append(terms, term)
+	}
+	hits, err := m.db.KeywordSearch(terms, keywordScope(scope), opts.Candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	fused := map[string]map[string]interface{}{}
+	scores := map[string]float64{}
+	for rank, result := range vectorResults {
+		id := plainPointID(fmt.Sprint(result["id"]))
+		result["id"] = id
+		result["vector_score"] = result["score"]
+		fused[id] = result
+		scores[id] += opts.VectorWeight / float64(opts.K+rank+1)
+	}
+	loaded := map[string]bool{} // not returned by Search, so neither localized nor accessed
+	for rank, hit := range hits {
+		result, ok := fused[hit.MemoryID]
+		if !ok {
+			// only matched by keywords: load it, the filters beyond the scope are checked here
+			memory := m.getMatching(hit.MemoryID, filters)
+			if memory == nil {
+				continue
+			}
+			result = memory
+			result["id"] = hit.MemoryID
+			fused[hit.MemoryID] = result
+			loaded[hit.MemoryID] = true
+		}
+		result["keyword_score"] = hit.Score
+		scores[hit.MemoryID] += opts.KeywordWeight / float64(opts.K+rank+1)
+	}
+
+	results := make([]map[string]interface{}, 0, len(fused))
+	for id, result := range fused {
+		result["score"] = scores[id]
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i]["score"] != results[j]["score"] {
+			return results[i]["score"].(float64) > results[j]["score"].(float64)
+		}
+		return fmt.Sprint(results[i]["id"]) < fmt.Sprint(results[j]["id"])
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	accessed := []map[string]interface{}{}
+	for _, result := range results {
+		if loaded[fmt.Sprint(result["id"])] {
+			userID, _ := result["user_id"].(string)
+			localizeTimes(result, m.displayLocation(userID))
+			accessed = append(accessed, result)
+		}
+	}
+	m.recordAccess(accessed...)
+	return results, nil
+}
+
+// getMatching returns a memory as returned by getMemory, nil when it can't be read or doesn't
+// match filters and the filter expression, for the memories not found through the vector store
+func (m *Memory) getMatching(memoryID string, filters map[string]interface{}) map[string]interface{} {
+	memory, err := m.getMemory(memoryID)
+	if err != nil || memory == nil || !matchesFilters(memory, filters) {
+		return nil
+	}
+	if metadata, _ := memory["metadata"].(map[string]interface{}); m.filterExpr() != nil && !m.filterExpr().Matches(utils.MergeMaps(metadata, memory)) {
+		return nil
+	}
+	return memory
+}
+
+// matchesFilters reports whether a memory as returned by Get has the values of filters,
+// looked up at the top level and in its metadata
+func matchesFilters(memory map[string]interface{}, filters map[string]interface{}) bool {
+	metadata, _ := memory["metadata"].(map[string]interface{})
+	for key, expected := range filters {
+		value, ok := memory[key]
+		if !ok {
+			value, ok = metadata[key]
+		}
+		if !ok || fmt.Sprint(value) != fmt.Sprint(expected) {
+			return false
+		}
+	}
+	return true
+}
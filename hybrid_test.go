@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeywordTerms(t *testing.T) {
+	terms := keywordTerms("Reunión con ITR: llamar al +54 11 5555-1234 por el código AB-123")
+	assert.Equal(t, 1, terms["reunion"])
+	assert.Equal(t, 1, terms["itr"])
+	assert.Equal(t, 1, terms["55551234"])
+	assert.Equal(t, 1, terms["ab123"])
+	assert.Equal(t, 1, terms["codigo"])
+	assert.NotContains(t, terms, "+54")
+
+	assert.Equal(t, "chatbot whatsapp negocios", keywordText(map[string]interface{}{"data": "chatbot", "tags": []interface{}{"whatsapp", "negocios"}}))
+}
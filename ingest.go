@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+)
+
+// ChatMessage - a message of a conversation archive
+type ChatMessage struct {
+	Time    time.Time `json:"timestamp"`
+	Speaker string    `json:"speaker"`
+	Text    string    `json:"text"`
+}
+
+// ChatWindow - consecutive messages of one speaker, added to the memory as a single text
+type ChatWindow struct {
+	Index    int
+	Speaker  string
+	Start    time.Time
+	End      time.Time
+	Messages int
+	Text     string
+}
+
+// IngestOptions - options of Memory.Ingest
+type IngestOptions struct {
+	Source            string        // checkpoint name, e.g. the archive file name
+	AgentID           string        // agent_id of the memories, the user_id is the speaker
+	RunID             string        // run_id of the memories, optional
+	WindowGap         time.Duration // a longer silence starts a new window, defaults to 5 minutes
+	MaxWindowMessages int           // defaults to 20
+	MaxWindowChars    int           // defaults to 4000
+	Concurrency       int           // windows added in parallel, defaults to 4
+	Restart           bool          // discard the checkpoint of Source
+}
+
+func (o *IngestOptions) applyDefaults() {
+	if o.WindowGap <= 0 {
+		o.WindowGap = 5 * time.Minute
+	}
+	if o.MaxWindowMessages <= 0 {
+		o.MaxWindowMessages = 20
+	}
+	if o.MaxWindowChars <= 0 {
+		o.MaxWindowChars = 4000
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 4
+	}
+}
+
+// IngestReport - summary of a Memory.Ingest run
+type IngestReport struct {
+	Source      string         `json:"source"`
+	Messages    int            `json:"messages"`
+	Windows     int            `json:"windows"`
+	AlreadyDone int            `json:"already_done"` // windows done by previous runs
+	Processed   int            `json:"processed"`    // windows added by this run
+	Failed      int            `json:"failed"`
+	Events      map[string]int `json:"events"` // memory events returned by Add, e.g. add, update, delete
+	Paused      bool           `json:"paused"`
+	PauseReason string         `json:"pause_reason,omitempty"`
+	Errors      []string       `json:"errors,omitempty"` // the first failures as "window N: error"
+	Duration    string         `json:"duration"`
+}
+
+// ParseChatArchive reads a WhatsApp chat export ("whatsapp") or JSONL messages ("jsonl").
+// An empty format is detected from the first line. WhatsApp timestamps are read in loc.
+func ParseChatArchive(r io.Reader, format string, loc *time.Location) ([]ChatMessage, error) {
+	reader := bufio.NewReader(r)
+	if format == "" {
+		first, _ := reader.Peek(64)
+		format = "whatsapp"
+		if strings.HasPrefix(strings.TrimSpace(string(first)), "{") {
+			format = "jsonl"
+		}
+	}
+	switch format {
+	case "whatsapp":
+		return parseWhatsAppExport(reader, loc)
+	case "jsonl":
+		return parseChatJSONL(reader)
+	default:
+		return nil, fmt.Errorf("unsupported archive format %q, use whatsapp or jsonl", format)
+	}
+}
+
+// parseChatJSONL reads one message per line: {"timestamp": RFC3339, "speaker": "...", "text": "..."}.
+// "sender" and "user_id" are accepted for the speaker, "message" for the text.
+func parseChatJSONL(r *bufio.Reader) ([]ChatMessage, error) {
+	messages := []ChatMessage{}
+	for line := 1; ; line++ {
+		content, readErr := r.ReadBytes('\n')
+		if len(strings.TrimSpace(string(content))) > 0 {
+			var record struct {
+				Timestamp string `json:"timestamp"`
+				Speaker   string `json:"speaker"`
+				Sender    string `json:"sender"`
+				UserID    string `json:"user_id"`
+				Text      string `json:"text"`
+				Message   string `json:"message"`
+			}
+			if err := json.Unmarshal(content, &record); err != nil {
+				return nil, fmt.Errorf("line %d: invalid message: %w", line, err)
+			}
+			t, err := time.Parse(time.RFC3339, record.Timestamp)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid timestamp %q, expected RFC3339", line, record.Timestamp)
+			}
+			message := ChatMessage{
+				Time:    t,
+				Speaker: firstNonEmpty(record.Speaker, record.Sender, record.UserID),
+				Text:    strings.TrimSpace(firstNonEmpty(record.Text, record.Message)),
+			}
+			if message.Speaker == "" || message.Text == "" {
+				return nil, fmt.Errorf("line %d: speaker and text are required", line)
+			}
+			messages = append(messages, message)
+		}
+		if readErr == io.EOF {
+			return messages, nil
+		}
+		if readErr != nil {
+			return nil, fmt.Errorf("error reading archive: %w", readErr)
+		}
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// whatsAppLine matches the header of a message in Android ("31/12/24, 22:15 - Name: text")
+// and iOS ("[31/12/24, 22:15:03] Name: text") exports, with 12 or 24 hour times
+var whatsAppLine = regexp.MustCompile(`^\[?(\d{1,2})[/.-](\d{1,2})[/.-](\d{2,4}),? (\d{1,2}):(\d{2})(?::(\d{2}))?\s?(?:([AaPp])\.?\s?[Mm]\.?)?\]?(?: -)? (.*)$`)
+
+// whatsAppSkipped matches media placeholders and deleted messages
+var whatsAppSkipped = regexp.MustCompile(`(?i)^(<[^>]*omit[^>]*>|.*\b(image|imagen|video|audio|sticker|gif|document|documento)\s+(omitted|omitido|omitida)|this message was deleted|se eliminó este mensaje|eliminaste este mensaje)$`)
+
+// whatsAppMarks removes the direction marks and narrow spaces of recent exports
+var whatsAppMarks = strings.NewReplacer("\u200e", "", "\u200f", "", "\u202f", " ", "\u00a0", " ")
+
+type whatsAppHeader struct {
+	a, b, year, hour, minute, second int
+	pm, am                           bool
+	rest                             string
+}
+
+// parseWhatsAppExport reads a WhatsApp "export chat" text file. Lines without a timestamp
+// continue the previous message; system messages and media placeholders are skipped.
+// Day/month order is detected from the dates, day first if ambiguous.
+func parseWhatsAppExport(r *bufio.Reader, loc *time.Location) ([]ChatMessage, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	type pending struct {
+		header whatsAppHeader
+		text   []string
+	}
+	entries := []*pending{}
+	monthFirst, dayFirst := false, false
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := whatsAppMarks.Replace(scanner.Text())
+		match := whatsAppLine.FindStringSubmatch(line)
+		if match == nil {
+			if len(entries) > 0 {
+				last := entries[len(entries)-1]
+				last.text = append(last.text, line)
+			}
+			continue
+		}
+		atoi := func(s string) int {
+			n, _ := strconv.Atoi(s)
+			return n
+		}
+		h := whatsAppHeader{
+			a: atoi(match[1]), b: atoi(match[2]), year: atoi(match[3]),
+			hour: atoi(match[4]), minute: atoi(match[5]), second: atoi(match[6]),
+			pm: strings.EqualFold(match[7], "p"), am: strings.EqualFold(match[7], "a"),
+		}
+		if h.a > 12 {
+			dayFirst = true
+		}
+		if h.b > 12 {
+			monthFirst = true
+		}
+		speaker, text, ok := strings.Cut(match[8], ": ")
+		if !ok {
+			// system message, e.g. "Blas added Ana"
+			entries = append(entries, &pending{header: h})
+			continue
+		}
+		h.rest = speaker
+		entries = append(entries, &pending{header: h, text: []string{text}})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading archive: %w", err)
+	}
+	if dayFirst && monthFirst {
+		return nil, errors.New("inconsistent dates in the WhatsApp export, both day/month and month/day found")
+	}
+
+	messages := []ChatMessage{}
+	for _, entry := range entries {
+		h := entry.header
+		text := strings.TrimSpace(strings.Join(entry.text, "\n"))
+		if h.rest == "" || text == "" || whatsAppSkipped.MatchString(text) {
+			continue
+		}
+		day, month := h.a, h.b
+		if monthFirst {
+			day, month = h.b, h.a
+		}
+		year := h.year
+		if year < 100 {
+			year += 2000
+		}
+		hour := h.hour
+		if h.pm && hour < 12 {
+			hour += 12
+		} else if h.am && hour == 12 {
+			hour = 0
+		}
+		messages = append(messages, ChatMessage{
+			Time:    time.Date(year, time.Month(month), day, hour, h.minute, h.second, 0, loc),
+			Speaker: strings.TrimSpace(h.rest),
+			Text:    text,
+		})
+	}
+	return messages, nil
+}
+
+// WindowMessages groups consecutive messages of the same speaker. A window ends when the
+// speaker changes, after a silence longer than gap, or when it reaches maxMessages or maxChars.
+func WindowMessages(messages []ChatMessage, gap time.Duration, maxMessages int, maxChars int) []ChatWindow {
+	windows := []ChatWindow{}
+	var current *ChatWindow
+	var lines []string
+	var last time.Time
+	chars := 0
+
+	flush := func() {
+		if current != nil {
+			current.Text = fmt.Sprintf("%s (%s):\n%s", current.Speaker, current.Start.Format("2006-01-02 15:04"), strings.Join(lines, "\n"))
+			windows = append(windows, *current)
+		}
+		current, lines, chars = nil, nil, 0
+	}
+
+	for _, message := range messages {
+		if current != nil && (message.Speaker != current.Speaker ||
+			message.Time.Sub(last) > gap ||
+			current.Messages >= maxMessages ||
+			chars+len(message.Text) > maxChars) {
+			flush()
+		}
+		if current == nil {
+			current = &ChatWindow{Index: len(windows), Speaker: message.Speaker, Start: message.Time}
+		}
+		current.End = message.Time
+		current.Messages++
+		lines = append(lines, message.Text)
+		chars += len(message.Text)
+		last = message.Time
+	}
+	flush()
+	return windows
+}
+
+// ingestFingerprint identifies the archive and the window options of a checkpoint
+func ingestFingerprint(windows []ChatWindow, opts IngestOptions) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s|%d|%d|%d|%s|%s|", opts.WindowGap, opts.MaxWindowMessages, opts.MaxWindowChars, len(windows), opts.AgentID, opts.RunID)
+	for _, window := range windows {
+		fmt.Fprintf(hash, "%s|%d|", window.Start.UTC().Format(time.RFC3339), window.Messages)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+const maxIngestErrors = 100
+
+// Ingest adds a conversation archive to the memory: messages are grouped in windows by
+// speaker and time (see WindowMessages) and each window goes through Memory.Add with the
+// speaker as user_id. Windows are processed opts.Concurrency at a time and checkpointed in
+// the history database, so cancelling ctx pauses the ingestion and running it again with the
+// same Source resumes it. Failed windows are retried on the next run.
+func (m *Memory) Ingest(ctx context.Context, messages []ChatMessage, opts IngestOptions) (*IngestReport, error) {
+	opts.applyDefaults()
+	if opts.Source == "" {
+		return nil, errors.New("ingest requires a source name for its checkpoint")
+	}
+	started := time.Now()
+
+	windows := WindowMessages(messages, opts.WindowGap, opts.MaxWindowMessages, opts.MaxWindowChars)
+	report := &IngestReport{Source: opts.Source, Messages: len(messages), Windows: len(windows), Events: map[string]int{}}
+
+	if opts.Restart {
+		if err := m.db.DeleteIngest(opts.Source); err != nil {
+			return nil, err
+		}
+	}
+	done, err := m.db.StartIngest(opts.Source, ingestFingerprint(windows, opts), len(messages), len(windows))
+	if err != nil {
+		return nil, err
+	}
+	report.AlreadyDone = len(done)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.Concurrency)
+
+	pause := func(reason string) {
+		mu.Lock()
+		if !report.Paused {
+			report.Paused, report.PauseReason = true, reason
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	for _, window := range windows {
+		if done[window.Index] {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(window ChatWindow) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result, err := m.addIngestWindow(ctx, window, opts)
+			var quotaErr *QuotaExceededError
+			switch {
+			case errors.As(err, &quotaErr):
+				pause(quotaErr.Error())
+				return
+			case ctx.Err() != nil && (err != nil || result == nil):
+				// interrupted, the window is added again on resume. Once Add returned it is
+				// stored and marked done even if the ingest was cancelled meanwhile.
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			status, errMsg := sqlitemanager.IngestDone, ""
+			if err != nil {
+				status, errMsg = sqlitemanager.IngestFailed, err.Error()
+				report.Failed++
+				if len(report.Errors) < maxIngestErrors {
+					report.Errors = append(report.Errors, fmt.Sprintf("window %d: %v", window.Index, err))
+				}
+			} else {
+				report.Processed++
+				details, _ := result["details"].([]map[string]interface{})
+				for _, detail := range details {
+					event := strings.TrimSuffix(fmt.Sprint(detail["event"]), "_")
+					report.Events[event]++
+				}
+			}
+			if err := m.db.MarkIngestWindow(opts.Source, window.Index, status, errMsg); err != nil {
+				log.Printf("Error saving ingest checkpoint: %v", err)
+			}
+			if (report.Processed+report.Failed)%100 == 0 {
+				log.Printf("Ingest %s: %d/%d windows", opts.Source, report.AlreadyDone+report.Processed, report.Windows)
+			}
+		}(window)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil && !report.Paused {
+		report.Paused, report.PauseReason = true, "cancelled"
+	}
+	status := sqlitemanager.IngestDone
+	switch {
+	case report.Paused:
+		status = sqlitemanager.IngestPaused
+	case report.Failed > 0:
+		status = sqlitemanager.IngestFailed
+	}
+	if err := m.db.SetIngestStatus(opts.Source, status); err != nil {
+		return report, err
+	}
+	report.Duration = time.Since(started).Round(time.Second).String()
+	return report, nil
+}
+
+// addIngestWindow adds a window, waiting when the requests per minute quota is exhausted
+func (m *Memory) addIngestWindow(ctx context.Context, window ChatWindow, opts IngestOptions) (map[string]interface{}, error) {
+	userID := window.Speaker
+	var agentID, runID *string
+	if opts.AgentID != "" {
+		agentID = &opts.AgentID
+	}
+	if opts.RunID != "" {
+		runID = &opts.RunID
+	}
+	for {
+		metadata := map[string]interface{}{"source": opts.Source, "window_start": window.Start.Format(time.RFC3339)}
+		result, err := m.Add(window.Text, &userID, agentID, runID, metadata, nil, nil, nil)
+		var quotaErr *QuotaExceededError
+		if !errors.As(err, &quotaErr) || quotaErr.Limit != "requests_per_minute" {
+			return result, err
+		}
+		select {
+		case <-time.After(quotaErr.RetryAfter):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// ingestRunner tracks the ingestions started by the HTTP server so they can be paused
+type ingestRunner struct {
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+	reports map[string]*IngestReport // last report of each finished run
+}
+
+func newIngestRunner() *ingestRunner {
+	return &ingestRunner{running: map[string]context.CancelFunc{}, reports: map[string]*IngestReport{}}
+}
+
+// start runs the ingestion in the background, false if source is already running
+func (ir *ingestRunner) start(m *Memory, messages []ChatMessage, opts IngestOptions) bool {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	if _, ok := ir.running[opts.Source]; ok {
+		return false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ir.running[opts.Source] = cancel
+	delete(ir.reports, opts.Source)
+
+	go func() {
+		report, err := m.Ingest(ctx, messages, opts)
+		if err != nil {
+			log.Printf("Error ingesting %s: %v", opts.Source, err)
+		}
+		ir.mu.Lock()
+		defer ir.mu.Unlock()
+		delete(ir.running, opts.Source)
+		if report != nil {
+			ir.reports[opts.Source] = report
+		}
+		cancel()
+	}()
+	return true
+}
+
+// pause cancels a running ingestion, false if it isn't running
+func (ir *ingestRunner) pause(source string) bool {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	cancel, ok := ir.running[source]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// state returns whether source is running and the report of its last finished run
+func (ir *ingestRunner) state(source string) (bool, *IngestReport) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	_, running := ir.running[source]
+	return running, ir.reports[source]
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWhatsAppExportAndWindows(t *testing.T) {
+	archive := strings.Join([]string{
+		"13/01/25, 09:00 - Messages and calls are end-to-end encrypted.",
+		"13/01/25, 09:01 - Blas: Hola, buen dia",
+		"13/01/25, 09:02 - Blas: Mañana viajo a Córdoba",
+		"por trabajo",
+		"13/01/25, 09:03 - Ana: <Media omitted>",
+		"13/01/25, 09:04 - Ana: Que bueno! Cuantos días?",
+		"13/01/25, 11:30 - Ana: Avisame cuando llegues",
+	}, "\n")
+
+	messages, err := ParseChatArchive(strings.NewReader(archive), "", time.UTC)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 4)
+	assert.Equal(t, "Blas", messages[1].Speaker)
+	assert.Equal(t, "Mañana viajo a Córdoba\npor trabajo", messages[1].Text)
+	assert.Equal(t, time.Date(2025, time.January, 13, 9, 2, 0, 0, time.UTC), messages[1].Time)
+
+	windows := WindowMessages(messages, 5*time.Minute, 20, 4000)
+	assert.Len(t, windows, 3) // Blas, Ana, and Ana again after a silence
+	assert.Equal(t, 2, windows[0].Messages)
+	assert.Equal(t, "Blas (2025-01-13 09:01):\nHola, buen dia\nMañana viajo a Córdoba\npor trabajo", windows[0].Text)
+	assert.Equal(t, 2, windows[2].Index)
+
+	ios := "[1/13/25, 9:01:05 PM] Blas: Hola\n"
+	messages, err = ParseChatArchive(strings.NewReader(ios), "whatsapp", time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, time.January, 13, 21, 1, 5, 0, time.UTC), messages[0].Time)
+}
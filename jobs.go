@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+)
+
+// JobAdd - kind of the jobs created by Memory.EnqueueAdd
+const JobAdd = "add"
+
+// jobPollInterval - how often idle workers look for jobs queued by other processes or due retries
+const jobPollInterval = time.Second
+
+// addJobPayload - arguments of an asynchronous Memory.Add
+type addJobPayload struct {
+	Text     string                 `json:"text"`
+	UserID   *string                `json:"user_id,omitempty"`
+	AgentID  *string                `json:"agent_id,omitempty"`
+	RunID    *string                `json:"run_id,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// JobStatus - a job as returned by Memory.GetJob, with its decoded result
+type JobStatus struct {
+	*sqlitemanager.Job
+	Result interface{} `json:"result,omitempty"`
+}
+
+// EnqueueAdd stores a Memory.Add in the durable job queue and returns the queued job.
+// The job is run by the workers of StartJobWorkers, see GetJob for its status and result.
+func (m *Memory) EnqueueAdd(data string, userID *string, agentID *string, runID *string, metadata map[string]interface{}) (*sqlitemanager.Job, error) {
+	if userID == nil && agentID == nil && runID == nil {
+		return nil, errors.New("error: missing parameters, at least one of userID, agentID, or runID is required")
+	}
+	if err := m.applyTenant(map[string]interface{}{}); err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(addJobPayload{Text: data, UserID: userID, AgentID: agentID, RunID: runID, Metadata: metadata})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling job: %w", err)
+	}
+	job, err := m.db.EnqueueJob(JobAdd, m.tenantID, string(payload))
+	if err != nil {
+		return nil, err
+	}
+	// wake up an idle worker
+	select {
+	case m.jobsNotify <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// GetJob returns a job of the Memory's tenant with its result, nil if it doesn't exist
+func (m *Memory) GetJob(id string) (*JobStatus, error) {
+	job, err := m.db.GetJob(id)
+	if err != nil || job == nil {
+		return nil, err
+	}
+	if m.tenantID != "" && job.Tenant != m.tenantID {
+		return nil, nil
+	}
+	status := &JobStatus{Job: job}
+	if job.Result != "" {
+		if err := json.Unmarshal([]byte(job.Result), &status.Result); err != nil {
+			return nil, fmt.Errorf("error decoding job result: %w", err)
+		}
+	}
+	return status, nil
+}
+
+// StartJobWorkers starts config.Jobs.Workers goroutines processing the job queue until ctx
+// is done. Jobs left running by a previous process are queued again first.
+// The returned WaitGroup is done when every worker stopped.
+func (m *Memory) StartJobWorkers(ctx context.Context) *sync.WaitGroup {
+	if n, err := m.db.RequeueRunningJobs(); err != nil {
+		log.Printf("Error requeuing jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("Requeued %d interrupted jobs", n)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(m.config.Jobs.Workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.jobWorker(ctx)
+		}()
+	}
+	return &wg
+}
+
+func (m *Memory) jobWorker(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for {
+		job, err := m.db.ClaimJob()
+		if err != nil {
+			log.Printf("Error claiming job: %v", err)
+		}
+		if job != nil {
+			m.runJob(job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.jobsNotify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runJob runs a claimed job and records its outcome. Failures are retried with a growing
+// delay up to config.Jobs.MaxAttempts, requests per minute quota errors when the quota resets.
+func (m *Memory) runJob(job *sqlitemanager.Job) {
+	result, err := m.executeJob(job)
+	if err == nil {
+		resultJSON, marshalErr := json.Marshal(result)
+		if marshalErr == nil {
+			err = m.db.CompleteJob(job.ID, string(resultJSON))
+		} else {
+			err = m.db.FailJob(job.ID, fmt.Sprintf("error marshaling result: %v", marshalErr), 0)
+		}
+		if err != nil {
+			log.Printf("Error saving job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	retryAfter := time.Duration(0)
+	var quotaErr *QuotaExceededError
+	switch {
+	case errors.As(err, &quotaErr):
+		if quotaErr.Limit == "requests_per_minute" {
+			retryAfter = quotaErr.RetryAfter
+		}
+	case job.Attempts < m.config.Jobs.MaxAttempts:
+		retryAfter = time.Duration(job.Attempts*job.Attempts) * 5 * time.Second
+	}
+	log.Printf("Job %s attempt %d failed: %v", job.ID, job.Attempts, err)
+	if err := m.db.FailJob(job.ID, err.Error(), retryAfter); err != nil {
+		log.Printf("Error saving job %s: %v", job.ID, err)
+	}
+}
+
+func (m *Memory) executeJob(job *sqlitemanager.Job) (map[string]interface{}, error) {
+	jm := m
+	if job.Tenant != "" {
+		jm = m.WithTenant(job.Tenant)
+	}
+	switch job.Kind {
+	case JobAdd:
+		var args addJobPayload
+		if err := json.Unmarshal([]byte(job.Payload), &args); err != nil {
+			return nil, fmt.Errorf("invalid job payload: %w", err)
+		}
+		return jm.Add(args.Text, args.UserID, args.AgentID, args.RunID, args.Metadata, nil, nil, nil)
+	default:
+		return nil, fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"os"
+	"sort"
 	"strconv"
 	"time"
 
@@ -45,8 +49,15 @@ type SearchResult struct {
 	ID      string                 `json:"id"`
 	Score   float64                `json:"score"`
 	Payload map[string]interface{} `json:"payload"`
+	Vector  []float32              `json:"vector,omitempty"` // only filled when requested, see VectorStore.Scroll
 }
 
+// ErrMemoryNotFound is returned (wrapped) by VectorStore.Get when the id doesn't exist
+var ErrMemoryNotFound = errors.New("memory not found")
+
+// ErrInvalidSearch is returned (wrapped) by Search and HybridSearch when their options are invalid
+var ErrInvalidSearch = errors.New("invalid search")
+
 /*
 class Record(BaseModel):
     """
@@ -69,9 +80,25 @@ type LLM interface {
 	// Add other methods as needed
 }
 
+// StreamingLLM - an LLM that can stream a plain text answer, used by Memory.Chat. options
+// override the configured model, temperature, etc.
+type StreamingLLM interface {
+	LLM
+	GenerateStream(ctx context.Context, messages []llms.MessageContent, onToken func(token string) error, options ...llms.CallOption) (*LLMAnswer, error)
+}
+
+// LLMAnswer - a plain text answer with its token usage
+type LLMAnswer struct {
+	Content          string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+}
+
 // Embedder - Interface for Embedders (already defined, ensuring it's here for context)
 type Embedder interface {
 	Embed(text string) ([]float64, []float32, error)
+	Model() string
 	// Add other methods as needed
 }
 
@@ -79,35 +106,84 @@ type Embedder interface {
 
 // Memory - Corresponds to the Python Memory class
 type Memory struct {
-	config         MemoryConfig
-	embeddingModel Embedder
-	vectorStore    VectorStore
-	telemetry      *telemetry.AnonymousTelemetry
-	llm            LLM
-	db             *sqlitemanager.SQLiteManager
-	collectionName string
-	debug          bool
+	config          MemoryConfig
+	embeddingModel  Embedder
+	vectorStore     VectorStore
+	telemetry       *telemetry.AnonymousTelemetry
+	llm             LLM
+	db              *sqlitemanager.SQLiteManager
+	collectionName  string
+	debug           bool
+	tenantID        string            // set by WithTenant, constrains every read and write
+	jobsNotify      chan struct{}     // wakes up the job workers, see EnqueueAdd
+	scopeLocks      *scopeLocks       // serializes the writes to each scope, shared with WithTenant copies
+	webhookNotify   chan struct{}     // wakes up the webhook dispatcher, see emitMemoryEvent
+	progress        func(AddProgress) // set by WithProgress, receives the steps of Add
+	rerank          *RerankOptions    // set by WithRerank, reranks the results of Search
+	filter          *Filter           // set by WithFilter, restricts Search and GetAll
+	recency         *RecencyOptions   // set by WithRecency, favours recent memories in Search
+	timeZone        *time.Location    // set by WithTimeZone, of the timestamps in results
+	includeArchived bool              // set by WithArchived, see Forget
+	includeExpired  bool              // set by WithExpired, see SweepExpired
+	system          bool              // set by systemScope, skips the tenant check of the background jobs
+	quotaConsumed   bool              // set by Chat, its Search and Add check the quotas without consuming them
+}
+
+// AddProgress - a step of Memory.Add, see WithProgress
+type AddProgress struct {
+	Stage   string                 // facts, actions or event
+	Message string                 // human readable description of the step
+	Event   map[string]interface{} // the change for the event stage: id, event and data
+}
+
+// WithProgress returns a copy of the Memory whose Add reports its steps to fn
+func (m *Memory) WithProgress(fn func(AddProgress)) *Memory {
+	scoped := *m
+	scoped.progress = fn
+	return &scoped
+}
+
+func (m *Memory) reportProgress(p AddProgress) {
+	if m.progress != nil {
+		m.progress(p)
+	}
 }
 
 // NewMemory creates a new Memory instance
 func NewMemory(config MemoryConfig) *Memory {
+	db, err := sqlitemanager.NewSQLiteManager(config.HistoryDBPath)
+	if err != nil {
+		log.Fatalf("Error creating database: %v", err)
+	}
+	// a re-embedding may have replaced the configured collection and embedder, see Memory.Reembed
+	configuredCollection, _ := config.VectorStore.Config["collection_name"].(string)
+	if config, err = resolveReembedded(db, config); err != nil {
+		log.Fatalf("Error resolving active collection: %v", err)
+	}
 	embedder, err := EmbedderFactory{}.Create(config.Embedder.Provider, config.Embedder.Config)
 	if err != nil {
 		log.Fatalf("Error creating embedder: %v", err)
 	}
+	// refuse to start if the embedder doesn't produce vectors of the collection size
+	embedderDims, err := (&Memory{config: config, db: db}).embeddingDims(embedder, config.Embedder)
+	if err != nil {
+		log.Fatalf("Error checking embedder dimensions: %v", err)
+	}
+	if err := checkConfiguredDims(&config.VectorStore, embedder.Model(), embedderDims); err != nil {
+		log.Fatalf("Error checking embedder dimensions: %v", err)
+	}
 	vectorStore, err := VectorStoreFactory{}.Create(config.VectorStore.Provider, config.VectorStore.Config)
 	if err != nil {
 		log.Fatalf("Error creating vector store: %v", err)
 	}
+	collection, _ := config.VectorStore.Config["collection_name"].(string)
+	if err := checkCollectionDims(vectorStore, collection, embedder.Model(), embedderDims); err != nil {
+		log.Fatalf("Error checking embedder dimensions: %v", err)
+	}
 	llm, err := LlmFactory{}.Create(config.Llm.Provider, config.Llm.Config)
 	if err != nil {
 		log.Fatalf("Error creating LLM: %v", err)
 	}
-	db, err := sqlitemanager.NewSQLiteManager(config.HistoryDBPath)
-	if err != nil {
-		log.Fatalf("Error creating database: %v", err)
-	}
-
 	// phtelemetry, pherr := telemetry.NewAnonymousTelemetry("phc_eCRS68Q2koejazio0Umv93pwmGfwCH4uCa0dh1brRsI", "https://us.i.posthog.com", nil, nil)
 	// if pherr != nil {
 	// 	log.Fatalf("Error initializing telemetry: %v", pherr)
@@ -115,19 +191,20 @@ func NewMemory(config MemoryConfig) *Memory {
 
 	m := &Memory{
 		//customPrompt: string //self.config.custom_prompt ?
-		config:         config,      //MemoryConfig
-		embeddingModel: embedder,    //EmbedderFactory
-		vectorStore:    vectorStore, //VectorStoreFactory
-		llm:            llm,         //LlmFactory
-		db:             db,          //SQLiteManager
-		telemetry:      nil,         //*phtelemetry,
-		collectionName: "",
+		config:         config,               //MemoryConfig
+		embeddingModel: embedder,             //EmbedderFactory
+		vectorStore:    vectorStore,          //VectorStoreFactory
+		llm:            llm,                  //LlmFactory
+		db:             db,                   //SQLiteManager
+		telemetry:      nil,                  //*phtelemetry,
+		collectionName: configuredCollection, // the active collection may differ after Reembed
 		debug:          false,
+		jobsNotify:     make(chan struct{}, 1),
+		scopeLocks:     newScopeLocks(),
+		webhookNotify:  make(chan struct{}, 1),
 		// collectionName: config.VectorStore.Config["CollectionName"],
 	}
 
-	//v1.1 MemoryGraph?
-
 	// m.telemetry.CaptureEvent("memGo.init", nil)
 	return m
 }
@@ -140,6 +217,7 @@ func FromConfig(configMap map[string]interface{}) (*Memory, error) {
 	}
 
 	var config MemoryConfig
+	utils.ApplyDefaults(&config)
 	err = json.Unmarshal(configBytes, &config)
 	if err != nil {
 		log.Printf("Configuration validation error: %v", err)
@@ -150,7 +228,7 @@ func FromConfig(configMap map[string]interface{}) (*Memory, error) {
 
 // Add creates a new memory.
 // the system extracts relevant facts and preferences and stores it across data stores:
-// a vector database, a key-value database, and a graph database
+// a vector database, a key-value database, and a graph database (see GraphConfig)
 func (m *Memory) Add(
 	data string, // Messages to store in the memory. TODO: todo ver de manejar como un array de mensajes tambien
 	userID *string, // ID of the user creating the memory. Defaults nil.
@@ -186,20 +264,37 @@ func (m *Memory) Add(
 		filters["run_id"] = *runID
 		metadata["run_id"] = *runID
 	}
+	if err := m.applyTenant(filters, metadata); err != nil {
+		return nil, err
+	}
 
 	// 1. check if at least ONE of userID, agentID, or runID is present
 	if userID == nil && agentID == nil && runID == nil {
 		return nil, errors.New("error: missing parameters, at least one of userID, agentID, or runID is required")
 	}
 
+	// checks requests per minute and daily token budget for the user and agent
+	if _, err := m.CheckQuota(metadata, true); err != nil {
+		return nil, err
+	}
+	if err := m.checkActiveCollection(); err != nil {
+		return nil, err
+	}
+
+	// concurrent adds to the same scope would search the same neighbours and update or
+	// delete them twice: they run one after the other
+	defer m.lockScope(metadata)()
+
 	// en este paso prepara la ejecucion asincrona de la deduccion de la memoria en el vectorstore
+	// (ver EnqueueAdd: la cola de jobs ejecuta este mismo Add en segundo plano)
 
 	utils.DebugPrint("Raw INPUT Data: "+data, m.debug, gc)
 
 	/* ============= chain.MEMORY_DEDUCTION process ============== */
 
 	// Este paso obtiene informacion generalizada relevante de la data de la memoria guardada en el VectorStore
-	deductionChain := chains.NewChain(m.debug, gc)
+	deductionChain := chains.NewChain(m.debug, gc).WithUsage(m.chainUsage(metadata)).
+		WithNow(time.Now().In(m.displayLocation(derefString(userID))))
 
 	/*
 		// PATTERNS_ATTENTION busca patrones en el mensaje y devuelve un json con las clasificaciones
@@ -257,6 +352,7 @@ func (m *Memory) Add(
 	}
 
 	utils.DebugPrint(fmt.Sprintf("# RELEVANT FACTS DEDUCIDOS: %s\n", strconv.Itoa(cantFacts)), m.debug, gc)
+	m.reportProgress(AddProgress{Stage: "facts", Message: fmt.Sprintf("%d relevant facts found", cantFacts)})
 
 	// el tamaño maximo es de la cantidad de relevant_facts * searchs limit de 5
 	acumuladorMemoriasParaEvaluar := make([]models.MemoryItem, 0, len(relevantFacts)*5)
@@ -311,6 +407,20 @@ func (m *Memory) Add(
 			metadata["tags"] = tagList
 			// filterss["tags"] = tagList
 		}
+
+		// importance from 1 to 10 stored from 0 to 1, see Forget
+		if importance, ok := metadataMap["importance"].(float64); ok {
+			metadata["importance"] = math.Min(math.Max(importance, 0), 10) / 10
+		}
+
+		// expiry of time-bound facts, unless given to Add, see SweepExpired
+		if expiresAt, ok := metadataMap["expires_at"].(string); ok && expiresAt != "" && metadata["expires_at"] == nil {
+			if expiry, err := parseExpiry(expiresAt, "", m.displayLocation(derefString(userID))); err == nil {
+				setExpiry(metadata, expiry)
+			} else {
+				utils.DebugPrint(fmt.Sprintf("Ignoring the deduced expires_at: %v", err), m.debug, gc)
+			}
+		}
 	}
 
 	/* ====== SIMILARITY SEARCH FOR EVERY FACT OF DEDUCTIONS =====  */
@@ -321,14 +431,14 @@ func (m *Memory) Add(
 			continue
 		}
 
-		_, embeddings32, err := m.embeddingModel.Embed(factStr)
+		_, embeddings32, err := m.embed(factStr, "add.search", metadata)
 		if err != nil {
 			utils.DebugPrint(fmt.Sprintf("Error embedding fact: %v\n at index: %d \nerr: %v", fact, fact_index, err), m.debug, gc)
 			return nil, fmt.Errorf("error embedding fact")
 		}
 
 		/* ====== SEARCH FOR max(5) EXISTING MEMORIES IN VS WITH Filters ===== */
-		existingMemoriesRaw, err := m.vectorStore.Search(embeddings32, 5, filterss)
+		existingMemoriesRaw, err := m.vectorStore.Search(embeddings32, 5, m.storeFilters(filterss))
 		if err != nil {
 			utils.DebugPrint(fmt.Sprintf("Error searching existing memories for fact: %v\n at index: %d\nerr: %v", fact, fact_index, err), m.debug, gc)
 			return nil, fmt.Errorf("error searching existing memories")
@@ -457,7 +567,7 @@ func (m *Memory) Add(
 
 	/* ============ chain.MEMORY_UPDATER process =============== */
 
-	actionsAgent := chains.NewChain(true, gc)
+	actionsAgent := chains.NewChain(true, gc).WithUsage(m.chainUsage(metadata))
 
 	// 2. generates a prompt using the input messages and sends it to
 	// a Large Language Model (LLM) to retrieve new facts
@@ -469,6 +579,7 @@ func (m *Memory) Add(
 	// split memory updater into little steps
 
 	utils.DebugPrint(fmt.Sprintln("PHASE 2: MEMORY_UPDATER OK"), m.debug, gc)
+	m.reportProgress(AddProgress{Stage: "actions", Message: fmt.Sprintf("%d memory actions decided", len(responseMap.ToolCalls))})
 
 	// 5. processes the LLM's response, which contains actions to add, update, or delete memories
 	toolCalls := responseMap.ToolCalls
@@ -496,6 +607,8 @@ func (m *Memory) Add(
 
 			// Implement the conflict resolution logic here
 			utils.DebugPrint("resolve_memory_conflict logic executed", m.debug, gc)
+			conflict := map[string]interface{}{"memory1": m1, "memory2": m2, "strategy": strategy}
+			m.emitMemoryEvent(EventConflict, "", "", "", utils.MergeMaps(metadata, map[string]interface{}{"conflict": conflict}))
 
 			return "resolved_memory_id", nil
 		},
@@ -552,11 +665,13 @@ func (m *Memory) Add(
 			continue
 		}
 
-		functionResults = append(functionResults, map[string]interface{}{
+		functionResult := map[string]interface{}{
 			"id":    functionResultID,
 			"event": utils.TrimMemorySuffix(functionName),
 			"data":  functionArgs["data"],
-		})
+		}
+		functionResults = append(functionResults, functionResult)
+		m.reportProgress(AddProgress{Stage: "event", Message: fmt.Sprintf("%v %v", functionResult["event"], functionResultID), Event: functionResult})
 
 		// utils.DebugPrint(fmt.Sprintf("Function results: \n%+v\n", functionResults), m.debug)
 		// m.telemetry.CaptureEvent("memGo.add.function_call", map[string]interface{}{"memory_id": functionResultID, "function_name": functionName})
@@ -582,6 +697,18 @@ func (m *Memory) updateMemoryToolWrapper(args map[string]interface{}, gc *gin.Co
 
 // Get retrieves a memory by ID
 func (m *Memory) Get(memoryID string) (map[string]interface{}, error) {
+	memory, err := m.getMemory(memoryID)
+	if err != nil || memory == nil {
+		return memory, err
+	}
+	userID, _ := memory["user_id"].(string)
+	localizeTimes(memory, m.displayLocation(userID))
+	m.recordAccess(memory)
+	return memory, nil
+}
+
+// getMemory reads a memory as returned by Get, without localizing its times nor recording the access
+func (m *Memory) getMemory(memoryID string) (map[string]interface{}, error) {
 	// m.telemetry.CaptureEvent("memGo.get", map[string]interface{}{"memory_id": memoryID})
 	memory, err := m.vectorStore.Get(memoryID)
 	if err != nil {
@@ -590,25 +717,29 @@ func (m *Memory) Get(memoryID string) (map[string]interface{}, error) {
 	if memory == nil {
 		return nil, nil
 	}
+	payload := convertQdrantPayload(memory.Payload)
+	if err := m.checkTenant(memoryID, payload); err != nil {
+		return nil, err
+	}
 
 	filters := make(map[string]interface{})
 	for _, key := range []string{"user_id", "agent_id", "run_id"} {
-		if val, ok := memory.Payload[key]; ok {
+		if val, ok := payload[key]; ok {
 			filters[key] = val
 		}
 	}
 
 	memoryItem := map[string]interface{}{
 		"id":         memory.Id,
-		"memory":     memory.Payload["data"],
-		"hash":       memory.Payload["hash"],
-		"created_at": memory.Payload["created_at"],
-		"updated_at": memory.Payload["updated_at"],
+		"memory":     payload["data"],
+		"hash":       payload["hash"],
+		"created_at": payload["created_at"],
+		"updated_at": payload["updated_at"],
 	}
 
 	additionalMetadata := make(map[string]interface{})
-	excludedKeys := map[string]bool{"user_id": true, "agent_id": true, "run_id": true, "hash": true, "data": true, "created_at": true, "updated_at": true}
-	for k, v := range memory.Payload {
+	excludedKeys := map[string]bool{"user_id": true, "agent_id": true, "run_id": true, "hash": true, "data": true, "created_at": true, "updated_at": true, "created_at_ts": true, "updated_at_ts": true}
+	for k, v := range payload {
 		if !excludedKeys[k] {
 			additionalMetadata[k] = v
 		}
@@ -617,8 +748,7 @@ func (m *Memory) Get(memoryID string) (map[string]interface{}, error) {
 		memoryItem["metadata"] = additionalMetadata
 	}
 
-	result := utils.MergeMaps(memoryItem, filters)
-	return result, nil
+	return utils.MergeMaps(memoryItem, filters), nil
 }
 
 // GetAll lists all memories
@@ -633,15 +763,18 @@ func (m *Memory) GetAll(userID *string, agentID *string, runID *string, limit in
 	if runID != nil {
 		filters["run_id"] = *runID
 	}
+	if err := m.applyTenant(filters); err != nil {
+		return nil, err
+	}
 
 	// m.telemetry.CaptureEvent("memGo.get_all", map[string]interface{}{"filters": len(filters), "limit": limit})
-	memoriesList, err := m.vectorStore.List(filters, limit)
+	memoriesList, err := m.vectorStore.List(m.storeFilters(filters), limit)
 	if err != nil {
 		return nil, fmt.Errorf("error listing memories: %w", err)
 	}
 
 	var allMemories []map[string]interface{}
-	excludedKeys := map[string]bool{"user_id": true, "agent_id": true, "run_id": true, "hash": true, "data": true, "created_at": true, "updated_at": true}
+	excludedKeys := map[string]bool{"user_id": true, "agent_id": true, "run_id": true, "hash": true, "data": true, "created_at": true, "updated_at": true, "created_at_ts": true, "updated_at_ts": true}
 
 	for _, memories := range memoriesList {
 		for _, mem := range memories {
@@ -669,6 +802,10 @@ func (m *Memory) GetAll(userID *string, agentID *string, runID *string, limit in
 			allMemories = append(allMemories, memoryItem)
 		}
 	}
+	loc := m.displayLocation(derefString(userID))
+	for _, memory := range allMemories {
+		localizeTimes(memory, loc)
+	}
 	return allMemories, nil
 }
 
@@ -686,25 +823,47 @@ func (m *Memory) Search(query string, userID *string, agentID *string, runID *st
 	if runID != nil {
 		filters["run_id"] = *runID
 	}
+	if err := m.applyTenant(filters); err != nil {
+		return nil, err
+	}
+	if err := m.validateSearch(); err != nil {
+		return nil, err
+	}
 
 	// m.telemetry.CaptureEvent("memGo.search", map[string]interface{}{"filters": len(filters), "limit": limit})
-	_, embeddings32, err := m.embeddingModel.Embed(query)
+	if _, err := m.CheckQuota(filters, true); err != nil {
+		return nil, err
+	}
+
+	// the rerank and recency stages reorder more candidates than asked for, see WithRerank
+	// and WithRecency
+	rerank := m.rerankSettings()
+	recency := m.recencySettings()
+	resultLimit := limit
+	if rerank != nil {
+		limit = max(limit, rerank.Candidates)
+	}
+	if recency != nil {
+		limit = max(limit, resultLimit*4)
+	}
+
+	_, embeddings32, err := m.embed(query, "search", filters)
 	if err != nil {
 		return nil, fmt.Errorf("error embedding query: %w", err)
 	}
 
 	var memories []SearchResult // Declare memories here
 	if scoreThreshold != nil {
-		memories, err = m.vectorStore.SearchWithThreshold(embeddings32, limit, filters, *scoreThreshold)
+		memories, err = m.vectorStore.SearchWithThreshold(embeddings32, limit, m.storeFilters(filters), *scoreThreshold)
 	} else {
-		memories, err = m.vectorStore.Search(embeddings32, limit, filters)
+		memories, err = m.vectorStore.Search(embeddings32, limit, m.storeFilters(filters))
 	}
 	if err != nil {
 		return nil, fmt.Errorf("error searching vector store: %w", err)
 	}
 
 	var searchResults []map[string]interface{}
-	excludedKeys := map[string]bool{"user_id": true, "agent_id": true, "run_id": true, "hash": true, "data": true, "created_at": true, "updated_at": true}
+	excludedKeys := map[string]bool{"user_id": true, "agent_id": true, "run_id": true, "hash": true, "data": true, "created_at": true, "updated_at": true, "created_at_ts": true, "updated_at_ts": true}
 
 	for _, mem := range memories {
 		memoryItem := map[string]interface{}{
@@ -731,12 +890,39 @@ func (m *Memory) Search(query string, userID *string, agentID *string, runID *st
 		}
 		searchResults = append(searchResults, memoryItem)
 	}
+	if rerank != nil {
+		rerankLimit := resultLimit
+		if recency != nil {
+			rerankLimit = len(searchResults)
+		}
+		if searchResults, err = m.rerankResults(query, searchResults, rerankLimit, *rerank, filters); err != nil {
+			return nil, err
+		}
+	}
+	if recency != nil {
+		applyRecency(searchResults, *recency, time.Now())
+	}
+	if m.config.Graph.Enabled {
+		searchResults = m.mergeGraphResults(query, filters, searchResults)
+		sort.SliceStable(searchResults, func(i, j int) bool {
+			return searchResults[i]["score"].(float64) > searchResults[j]["score"].(float64)
+		})
+	}
+	if len(searchResults) > resultLimit {
+		searchResults = searchResults[:resultLimit]
+	}
+	loc := m.displayLocation(derefString(userID))
+	for _, memory := range searchResults {
+		localizeTimes(memory, loc)
+	}
+	m.recordAccess(searchResults...)
 	return searchResults, nil
 }
 
 // Update updates a memory by ID
 func (m *Memory) Update(memoryID string, data string, gc *gin.Context) (map[string]interface{}, error) {
 	// m.telemetry.CaptureEvent("memGo.update", map[string]interface{}{"memory_id": memoryID})
+	defer m.lockMemoryScope(memoryID)()
 	_, err := m.updateMemoryTool(memoryID, data, gc)
 	if err != nil {
 		utils.DebugPrint("Error updating memory: "+err.Error(), m.debug, gc)
@@ -748,6 +934,7 @@ func (m *Memory) Update(memoryID string, data string, gc *gin.Context) (map[stri
 // Delete deletes a memory by ID
 func (m *Memory) Delete(memoryID string) (map[string]interface{}, error) {
 	// m.telemetry.CaptureEvent("memGo.delete", map[string]interface{}{"memory_id": memoryID})
+	defer m.lockMemoryScope(memoryID)()
 	_, err := m.deleteMemoryTool(map[string]interface{}{"memory_id": memoryID})
 	if err != nil {
 		return nil, err
@@ -771,6 +958,9 @@ func (m *Memory) DeleteAll(userID *string, agentID *string, runID *string) (map[
 	if len(filters) == 0 {
 		return nil, errors.New("at least one filter is required to delete all memories. If you want to delete all memories, use the `Reset()` method")
 	}
+	if err := m.applyTenant(filters); err != nil {
+		return nil, err
+	}
 
 	// m.telemetry.CaptureEvent("memGo.delete_all", map[string]interface{}{"filters": len(filters)})
 	memoriesList, err := m.vectorStore.List(filters, -1) // Get all matching memories
@@ -780,7 +970,9 @@ func (m *Memory) DeleteAll(userID *string, agentID *string, runID *string) (map[
 
 	for _, memories := range memoriesList {
 		for _, memory := range memories {
+			unlock := m.lockScope(memory.Payload)
 			_, err = m.deleteMemoryTool(map[string]interface{}{"memory_id": memory.ID})
+			unlock()
 			if err != nil {
 				log.Printf("Error deleting memory %s: %v", memory.ID, err)
 				// Consider whether to continue or return an error here
@@ -793,7 +985,39 @@ func (m *Memory) DeleteAll(userID *string, agentID *string, runID *string) (map[
 // History gets the history of changes for a memory by ID
 func (m *Memory) History(memoryID string) ([]map[string]interface{}, error) {
 	// m.telemetry.CaptureEvent("memGo.history", map[string]interface{}{"memory_id": memoryID})
-	return m.db.GetHistory(memoryID)
+	if m.tenantID != "" || m.config.Auth.Enabled {
+		payload := map[string]interface{}{}
+		memory, err := m.vectorStore.Get(memoryID)
+		switch {
+		case err == nil && memory != nil:
+			payload = convertQdrantPayload(memory.Payload)
+		case err == nil || errors.Is(err, ErrMemoryNotFound):
+			// deleted memories are checked against the tenant recorded in their history
+			tenantID, err := m.db.GetHistoryTenant(memoryID)
+			if err != nil {
+				return nil, err
+			}
+			payload["tenant_id"] = tenantID
+		default:
+			return nil, fmt.Errorf("error getting memory from vector store: %w", err)
+		}
+		if err := m.checkTenant(memoryID, payload); err != nil {
+			return nil, err
+		}
+	}
+	history, err := m.db.GetHistory(memoryID)
+	if err != nil {
+		return nil, err
+	}
+	userID := "" // deleted memories are shown in the timezone config
+	if memory, err := m.vectorStore.Get(memoryID); err == nil && memory != nil {
+		userID, _ = convertQdrantPayload(memory.Payload)["user_id"].(string)
+	}
+	loc := m.displayLocation(userID)
+	for _, entry := range history {
+		localizeTimes(entry, loc)
+	}
+	return history, nil
 }
 
 func (m *Memory) createMemoryTool(args map[string]interface{}) (string, error) {
@@ -806,11 +1030,24 @@ func (m *Memory) createMemoryTool(args map[string]interface{}) (string, error) {
 	if !ok {
 		metadata = make(map[string]interface{})
 	}
+	return m.createMemory(data, metadata, EventAdd)
+}
+
+// createMemory stores a new memory recording event in its history and for webhooks
+func (m *Memory) createMemory(data string, metadata map[string]interface{}, event string) (string, error) {
 	log.Printf("Creating memory with data=%s", data)
 
+	if err := m.checkActiveCollection(); err != nil {
+		return "", err
+	}
+	if err := m.reserveFact(metadata); err != nil {
+		return "", err
+	}
+
 	// 2. embeds the data using the embeddingModel
-	embeddings, _, err := m.embeddingModel.Embed(data)
+	embeddings, _, err := m.embed(data, "add_memory", metadata)
 	if err != nil {
+		m.releaseFact(metadata)
 		return "", fmt.Errorf("error embedding data: %w", err)
 	}
 
@@ -821,17 +1058,16 @@ func (m *Memory) createMemoryTool(args map[string]interface{}) (string, error) {
 	hasher.Write([]byte(data))
 	metadata["hash"] = hex.EncodeToString(hasher.Sum(nil))
 
-	pacific, err := time.LoadLocation("America/Argentina/Buenos_Aires")
-	if err != nil {
-		return "", fmt.Errorf("error loading timezone: %w", err)
-	}
-	metadata["created_at"] = time.Now().In(pacific).Format(time.RFC3339)
+	metadata["created_at"], metadata["created_at_ts"] = timestamp(time.Now())
 
 	// 3. inserts the embeddings, memoryID, and metadata into the vectorStore
 	err = m.vectorStore.Insert([][]float64{embeddings}, []string{memoryID}, []map[string]interface{}{metadata})
 	if err != nil {
+		m.releaseFact(metadata)
 		return "", fmt.Errorf("error inserting into vector store: %w", err)
 	}
+	m.indexKeywords(memoryID, metadata)
+	m.indexGraph(memoryID, metadata)
 
 	createdAt, ok := metadata["created_at"].(string)
 	if !ok {
@@ -839,10 +1075,11 @@ func (m *Memory) createMemoryTool(args map[string]interface{}) (string, error) {
 	}
 
 	// 4. adds a history entry to the db indicating that a memory with the given memoryID was added
-	err = m.db.AddHistory(memoryID, nil, data, "ADD", &createdAt, nil, 0)
+	err = m.db.AddHistory(memoryID, payloadTenant(metadata), nil, data, event, &createdAt, nil, 0)
 	if err != nil {
 		log.Printf("Error adding history: %v", err) // Non-critical error
 	}
+	m.emitMemoryEvent(event, memoryID, data, "", metadata)
 	return memoryID, nil
 }
 
@@ -850,6 +1087,9 @@ func (m *Memory) updateMemoryTool(memoryID string, data string, gc *gin.Context)
 	utils.DebugPrint(fmt.Sprintf("Updating memory with memoryID = %s\n", memoryID), m.debug, gc)
 	utils.DebugPrint(fmt.Sprintf("with data = %s\n", data), m.debug, gc)
 
+	if err := m.checkActiveCollection(); err != nil {
+		return "", err
+	}
 	existingMemory, err := m.vectorStore.Get(memoryID)
 	if err != nil {
 		return "", fmt.Errorf("error getting existing memory: %w", err)
@@ -862,30 +1102,26 @@ func (m *Memory) updateMemoryTool(memoryID string, data string, gc *gin.Context)
 	prevPayload := existingMemory.Payload
 
 	prevValueMap := convertQdrantPayload(prevPayload)
+	if err := m.checkTenant(memoryID, prevValueMap); err != nil {
+		return "", err
+	}
 
 	prevValue := prevValueMap["data"].(string)
 
 	utils.DebugPrint(fmt.Sprintln("old Data: ", prevValue), m.debug, gc)
 
-	newMetadata := make(map[string]interface{})
+	// the rest of the payload (scope, importance, expiry, tags, consolidation...) is kept
+	newMetadata := copyPayload(prevValueMap)
 	newMetadata["data"] = data
-	newMetadata["hash"] = prevValueMap["hash"]
-	newMetadata["created_at"] = prevValueMap["created_at"]
-
-	hometime, err := time.LoadLocation("America/Argentina/Buenos_Aires")
-	if err != nil {
-		return "", fmt.Errorf("error loading timezone: %w", err)
-	}
-	newMetadata["updated_at"] = time.Now().In(hometime).Format(time.RFC3339)
-
-	for _, key := range []string{"user_id", "agent_id", "run_id"} {
-		if val, ok := prevValueMap[key]; ok {
-			newMetadata[key] = val
-		}
+	sum := md5.Sum([]byte(data))
+	newMetadata["hash"] = hex.EncodeToString(sum[:])
+	if createdAt, ok := epochOf(prevValueMap["created_at"]); ok {
+		newMetadata["created_at"], newMetadata["created_at_ts"] = timestamp(time.Unix(createdAt, 0))
 	}
+	newMetadata["updated_at"], newMetadata["updated_at_ts"] = timestamp(time.Now())
 
 	//
-	_, embeddings, err := m.embeddingModel.Embed(data)
+	_, embeddings, err := m.embed(data, "update_memory", newMetadata)
 	if err != nil {
 		return "", fmt.Errorf("error embedding data: %w", err)
 	}
@@ -895,6 +1131,9 @@ func (m *Memory) updateMemoryTool(memoryID string, data string, gc *gin.Context)
 	if err != nil {
 		return "", fmt.Errorf("error updating vector store: %w", err)
 	}
+	m.indexKeywords(memoryID, newMetadata)
+	m.indexGraph(memoryID, newMetadata)
+	m.emitMemoryEvent(EventUpdate, memoryID, data, prevValue, newMetadata)
 
 	// ESTO HACE UN UPDATE EN LA DB DE SEGUIMIENTO
 	// err = m.db.AddHistory(memoryID, &prevValue, data, "UPDATE", newMetadata["created_at"].(*string), newMetadata["updated_at"].(*string), 0)
@@ -909,43 +1148,60 @@ func (m *Memory) deleteMemoryTool(args map[string]interface{}) (string, error) {
 	if !ok {
 		return "", errors.New("memory_id not found or not a string")
 	}
+	// ids listed from the vector store come as uuid:"<uuid>", the history is keyed by <uuid>
+	return "", m.deleteMemory(plainPointID(memoryID), EventDelete)
+}
+
+// deleteMemory deletes a memory and records event (DELETE, or FORGET for Forget) in its history
+func (m *Memory) deleteMemory(memoryID string, event string) error {
 	log.Printf("Deleting memory with memoryID=%s", memoryID)
+	if err := m.checkActiveCollection(); err != nil {
+		return err
+	}
 
 	existingMemory, err := m.vectorStore.Get(memoryID)
 	if err != nil {
-		return "", fmt.Errorf("error getting existing memory for deletion: %w", err)
+		return fmt.Errorf("error getting existing memory for deletion: %w", err)
 	}
 	if existingMemory == nil {
-		return "", fmt.Errorf("memory with ID %s not found for deletion", memoryID)
+		return fmt.Errorf("memory with ID %s not found for deletion", memoryID)
 	}
 
 	// prevValue := existingMemory.Payload["data"].(string)
 	prevPayload := existingMemory.GetPayload()
 
 	prevValueMap := convertQdrantPayload(prevPayload)
+	if err := m.checkTenant(memoryID, prevValueMap); err != nil {
+		return err
+	}
 
 	prevValue := prevValueMap["data"].(string)
 
 	err = m.vectorStore.Delete(memoryID)
 	if err != nil {
-		return "", fmt.Errorf("error deleting from vector store: %w", err)
+		return fmt.Errorf("error deleting from vector store: %w", err)
 	}
-
-	pacific, err := time.LoadLocation("America/Argentina/Buenos_Aires")
-	if err != nil {
-		return "", fmt.Errorf("error loading timezone: %w", err)
+	m.trackMemoryCount(prevValueMap, -1)
+	m.unindexKeywords(memoryID)
+	m.unindexGraph(memoryID)
+	if err := m.db.DeleteAccess(memoryID); err != nil {
+		log.Printf("Error deleting memory access: %v", err)
 	}
 
-	now := time.Now().In(pacific).Format(time.RFC3339)
-	err = m.db.AddHistory(memoryID, &prevValue, "", "DELETE", &now, &now, 1)
+	now, _ := timestamp(time.Now())
+	err = m.db.AddHistory(memoryID, payloadTenant(prevValueMap), &prevValue, "", event, &now, &now, 1)
 	if err != nil {
 		log.Printf("Error adding history: %v", err) // Non-critical error
 	}
-	return "", nil
+	m.emitMemoryEvent(event, memoryID, "", prevValue, prevValueMap)
+	return nil
 }
 
 // Reset resets the memory store
 func (m *Memory) Reset() error {
+	if m.tenantID != "" {
+		return errors.New("reset is not allowed on a tenant scoped Memory, use DeleteAll")
+	}
 	err := m.vectorStore.DeleteCol()
 	if err != nil {
 		return fmt.Errorf("error deleting vector store collection: %w", err)
@@ -954,26 +1210,22 @@ func (m *Memory) Reset() error {
 	if err != nil {
 		return fmt.Errorf("error resetting database: %w", err)
 	}
+	if err := m.db.ClearKeywords(); err != nil {
+		return fmt.Errorf("error resetting keyword index: %w", err)
+	}
+	if err := m.db.ClearAccess(); err != nil {
+		return fmt.Errorf("error resetting memory access: %w", err)
+	}
+	if err := m.db.ClearGraph(); err != nil {
+		return fmt.Errorf("error resetting knowledge graph: %w", err)
+	}
 	// m.telemetry.CaptureEvent("memGo.reset", nil)
 	return nil
 }
 
-// Chat - Placeholder
-func (m *Memory) Chat(query string) error {
-	return errors.New("chat function not implemented yet")
-}
-
 func main() {
-	MemoryConfig := NewMemoryConfig()
-
-	m := NewMemory(MemoryConfig)
-
-	StartServer(m)
-
-	// search, err := m.Search("hello", &userId, nil, nil, 5, nil)
-	// if err != nil {
-	// 	log.Fatalf("Error searching memory: %v", err)
-	// }
-	// fmt.Printf("Search results: %+v\n", search)
-
+	if err := runCLI(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "memgo: %v\n", err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/matigumma/memGo/models"
+	"github.com/matigumma/memGo/tools"
+)
+
+// MCPConfig - the Model Context Protocol server, see `memgo mcp` and /mcp.
+// The ids are the scope of the tools when the call doesn't set one.
+type MCPConfig struct {
+	UserID  string `json:"user_id,omitempty"`
+	AgentID string `json:"agent_id,omitempty"`
+	RunID   string `json:"run_id,omitempty"`
+}
+
+// MCP protocol versions the server speaks, newest last
+var mcpProtocolVersions = []string{"2024-11-05", "2025-03-26", "2025-06-18"}
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"` // absent for notifications
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// mcpServer answers MCP JSON-RPC messages with the tools in tools.MCP_TOOLS
+type mcpServer struct {
+	m      *Memory
+	config MCPConfig
+	// allowsAgent restricts the agent_id the tools act on, nil allows any
+	allowsAgent func(agentID string) bool
+}
+
+func newMCPServer(m *Memory) *mcpServer {
+	return &mcpServer{m: m, config: m.config.MCP}
+}
+
+// handle answers a message, a single request or a batch. It returns nil when nothing
+// is to be answered, i.e. the message only had notifications.
+func (s *mcpServer) handle(ctx context.Context, raw []byte) []byte {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(raw, &batch); err != nil || len(batch) == 0 {
+			return marshalRPC(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{rpcInvalidRequest, "invalid batch"}})
+		}
+		responses := []rpcResponse{}
+		for _, message := range batch {
+			if response := s.handleOne(ctx, message); response != nil {
+				responses = append(responses, *response)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return marshalRPC(responses)
+	}
+	if response := s.handleOne(ctx, raw); response != nil {
+		return marshalRPC(*response)
+	}
+	return nil
+}
+
+func marshalRPC(value interface{}) []byte {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{-32603, err.Error()}})
+	}
+	return data
+}
+
+func (s *mcpServer) handleOne(ctx context.Context, raw json.RawMessage) *rpcResponse {
+	var request rpcRequest
+	if err := json.Unmarshal(raw, &request); err != nil {
+		return &rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, "parse error"}}
+	}
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		id := request.ID
+		if id == nil {
+			id = json.RawMessage("null")
+		}
+		return &rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{rpcInvalidRequest, "invalid request"}}
+	}
+	if request.ID == nil {
+		// notifications, e.g. notifications/initialized, are not answered
+		return nil
+	}
+
+	response := &rpcResponse{JSONRPC: "2.0", ID: request.ID}
+	switch request.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(request.Params, &params)
+		version := mcpProtocolVersions[len(mcpProtocolVersions)-1]
+		if slices.Contains(mcpProtocolVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		response.Result = gin.H{
+			"protocolVersion": version,
+			"capabilities":    gin.H{"tools": gin.H{}},
+			"serverInfo":      gin.H{"name": "memGo", "version": "1.0.0"},
+		}
+	case "ping":
+		response.Result = gin.H{}
+	case "tools/list":
+		list := []gin.H{}
+		for _, tool := range tools.MCP_TOOLS {
+			list = append(list, gin.H{
+				"name":        tool.Function.Name,
+				"description": tool.Function.Description,
+				"inputSchema": tool.Function.Parameters,
+			})
+		}
+		response.Result = gin.H{"tools": list}
+	case "tools/call":
+		var params struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		if err := json.Unmarshal(request.Params, &params); err != nil || params.Name == "" {
+			response.Error = &rpcError{rpcInvalidParams, "invalid params: name is required"}
+			break
+		}
+		if !slices.ContainsFunc(tools.MCP_TOOLS, func(t models.Tool) bool { return t.Function.Name == params.Name }) {
+			response.Error = &rpcError{rpcInvalidParams, fmt.Sprintf("unknown tool %q", params.Name)}
+			break
+		}
+		// tool failures are results, so the model can see them
+		result, err := s.callTool(ctx, params.Name, params.Arguments)
+		if err != nil {
+			response.Result = gin.H{"content": []gin.H{{"type": "text", "text": err.Error()}}, "isError": true}
+			break
+		}
+		text, _ := json.Marshal(result)
+		response.Result = gin.H{"content": []gin.H{{"type": "text", "text": string(text)}}, "isError": false}
+	default:
+		response.Error = &rpcError{rpcMethodNotFound, fmt.Sprintf("method %q not found", request.Method)}
+	}
+	return response
+}
+
+// scope returns the user_id, agent_id and run_id of the arguments, defaulting to the config
+func (s *mcpServer) scope(args map[string]interface{}) (userID, agentID, runID *string) {
+	value := func(key string, fallback string) *string {
+		if v, ok := args[key].(string); ok && v != "" {
+			return &v
+		}
+		if fallback != "" {
+			return &fallback
+		}
+		return nil
+	}
+	return value("user_id", s.config.UserID), value("agent_id", s.config.AgentID), value("run_id", s.config.RunID)
+}
+
+// checkAgent enforces allowsAgent for agentID, nil meaning no agent
+func (s *mcpServer) checkAgent(agentID *string) error {
+	if s.allowsAgent == nil {
+		return nil
+	}
+	id := ""
+	if agentID != nil {
+		id = *agentID
+	}
+	if !s.allowsAgent(id) {
+		return fmt.Errorf("agent_id %q not allowed", id)
+	}
+	return nil
+}
+
+// memory returns the memory of the memory_id argument, checking the agent it belongs to
+func (s *mcpServer) memory(args map[string]interface{}) (string, map[string]interface{}, error) {
+	memoryID, _ := args["memory_id"].(string)
+	if memoryID == "" {
+		return "", nil, errors.New("memory_id is required")
+	}
+	memoryID = plainPointID(memoryID)
+	memory, err := s.m.Get(memoryID)
+	if err != nil {
+		return "", nil, err
+	}
+	if memory == nil {
+		return "", nil, fmt.Errorf("memory %s not found", memoryID)
+	}
+	agentID, _ := memory["agent_id"].(string)
+	if err := s.checkAgent(&agentID); err != nil {
+		return "", nil, err
+	}
+	return memoryID, memory, nil
+}
+
+func (s *mcpServer) callTool(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	limit := func(fallback int) int {
+		if n, ok := args["limit"].(float64); ok && n > 0 {
+			return int(n)
+		}
+		return fallback
+	}
+
+	switch name {
+	case "add_memory", "search_memory", "list_memories":
+		userID, agentID, runID := s.scope(args)
+		if userID == nil && agentID == nil && runID == nil {
+			return nil, errors.New("one of user_id, agent_id or run_id is required")
+		}
+		if err := s.checkAgent(agentID); err != nil {
+			return nil, err
+		}
+		switch name {
+		case "add_memory":
+			data, _ := args["data"].(string)
+			if data == "" {
+				return nil, errors.New("data is required")
+			}
+			metadata, _ := args["metadata"].(map[string]interface{})
+			return s.m.Add(data, userID, agentID, runID, metadata, nil, nil, nil)
+		case "search_memory":
+			query, _ := args["query"].(string)
+			if query == "" {
+				return nil, errors.New("query is required")
+			}
+			memories, err := s.m.Search(query, userID, agentID, runID, limit(5), nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			return gin.H{"results": normalizeIDs(memories)}, nil
+		default:
+			memories, err := s.m.GetAll(userID, agentID, runID, limit(100))
+			if err != nil {
+				return nil, err
+			}
+			return gin.H{"results": normalizeIDs(memories)}, nil
+		}
+	case "get_memory":
+		_, memory, err := s.memory(args)
+		if err != nil {
+			return nil, err
+		}
+		return normalizeIDs([]map[string]interface{}{memory})[0], nil
+	case "delete_memory":
+		memoryID, _, err := s.memory(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.m.Delete(memoryID)
+	case "memory_history":
+		memoryID, _, err := s.memory(args)
+		if err != nil {
+			return nil, err
+		}
+		history, err := s.m.History(memoryID)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"results": history}, nil
+	}
+	return nil, fmt.Errorf("unknown tool %q", name)
+}
+
+// serveStdio runs the stdio transport: one JSON-RPC message per line until r is closed
+func (s *mcpServer) serveStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() && ctx.Err() == nil {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if response := s.handle(ctx, scanner.Bytes()); response != nil {
+			if _, err := fmt.Fprintf(w, "%s\n", response); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// Handler for /mcp
+// MCP streamable HTTP transport without server initiated streams: every POSTed message is
+// answered with JSON, 202 when it only had notifications. The tools act on the tenant and
+// agents of the credentials.
+func mcpHandler(c *gin.Context, m *Memory) {
+	if c.Request.Method != http.MethodPost {
+		c.Header("Allow", http.MethodPost)
+		c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "only POST is supported"})
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error reading body"})
+		return
+	}
+
+	server := newMCPServer(m)
+	if principal := principalFrom(c); principal != nil {
+		server.m = m.WithTenant(principal.Tenant)
+		server.allowsAgent = principal.AllowsAgent
+	}
+	response := server.handle(c.Request.Context(), body)
+	if response == nil {
+		c.Status(http.StatusAccepted)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", response)
+}
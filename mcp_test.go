@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMCPServer(t *testing.T) {
+	server := newMCPServer(&Memory{config: NewMemoryConfig()})
+	call := func(message string) map[string]interface{} {
+		var response map[string]interface{}
+		assert.NoError(t, json.Unmarshal(server.handle(context.Background(), []byte(message)), &response))
+		return response
+	}
+
+	response := call(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`)
+	result := response["result"].(map[string]interface{})
+	assert.Equal(t, "2025-03-26", result["protocolVersion"])
+	assert.Contains(t, result["capabilities"], "tools")
+
+	assert.Nil(t, server.handle(context.Background(), []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)))
+
+	response = call(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	names := []string{}
+	for _, tool := range response["result"].(map[string]interface{})["tools"].([]interface{}) {
+		names = append(names, tool.(map[string]interface{})["name"].(string))
+	}
+	assert.Equal(t, []string{"add_memory", "search_memory", "get_memory", "list_memories", "delete_memory", "memory_history"}, names)
+
+	// missing scope is a tool error, not a protocol error
+	response = call(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"search_memory","arguments":{"query":"x"}}}`)
+	assert.Equal(t, true, response["result"].(map[string]interface{})["isError"])
+
+	response = call(`{"jsonrpc":"2.0","id":4,"method":"resources/list"}`)
+	assert.Equal(t, float64(rpcMethodNotFound), response["error"].(map[string]interface{})["code"])
+}
@@ -1,24 +1,60 @@
 package main
 
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/matigumma/memGo/utils"
+)
+
 // MemoryConfig - Corresponds to the Python MemoryConfig class
 type MemoryConfig struct {
-	VectorStore   VectorStoreConfig `json:"vector_store"`
-	Llm           LlmConfig         `json:"llm"`
-	Embedder      EmbedderConfig    `json:"embedder"`
-	HistoryDBPath string            `json:"history_db_path" default:"./history.db"`
+	VectorStore   VectorStoreConfig   `json:"vector_store"`
+	Llm           LlmConfig           `json:"llm"`
+	Embedder      EmbedderConfig      `json:"embedder"`
+	HistoryDBPath string              `json:"history_db_path" default:"./history.db"`
+	TimeZone      string              `json:"timezone" default:"UTC"` // IANA time zone timestamps are shown in, see SetUserTimeZone
+	Usage         UsageConfig         `json:"usage"`
+	Quotas        QuotaConfig         `json:"quotas"`
+	Auth          AuthConfig          `json:"auth"`
+	Server        ServerConfig        `json:"server"`
+	Jobs          JobsConfig          `json:"jobs"`
+	Webhooks      WebhooksConfig      `json:"webhooks"`
+	MCP           MCPConfig           `json:"mcp"`
+	Rerank        RerankConfig        `json:"rerank"`
+	Recency       RecencyConfig       `json:"recency"`
+	Forgetting    ForgettingConfig    `json:"forgetting"`
+	Expiry        ExpiryConfig        `json:"expiry"`
+	Consolidation ConsolidationConfig `json:"consolidation"`
+	Graph         GraphConfig         `json:"graph"`
+}
+
+// ServerConfig - configuration of the HTTP server
+type ServerConfig struct {
+	Addr               string   `json:"addr" default:":8080"`
+	CORSAllowedOrigins []string `json:"cors_allowed_origins,omitempty"` // empty allows any origin
+	GRPCAddr           string   `json:"grpc_addr,omitempty"`            // address of the gRPC API, e.g. :9090; empty disables it
+}
+
+// JobsConfig - background job queue, see Memory.EnqueueAdd
+type JobsConfig struct {
+	Workers     int `json:"workers" default:"2"`      // jobs processed in parallel by the server
+	MaxAttempts int `json:"max_attempts" default:"3"` // attempts of a failing job before it is marked as failed
 }
 
 // NewMemoryConfig creates a new MemoryConfig with default values
 func NewMemoryConfig() MemoryConfig {
-	return MemoryConfig{
+	config := MemoryConfig{
 		VectorStore: VectorStoreConfig{
 			// Provider options: "qdrant", "chroma", "pgvector"
 			Provider: "qdrant",
 			Config: map[string]interface{}{
 				"collection_name":      "memGo",
 				"embedding_model_dims": 1536,
-				"Host":                 "localhost",
-				"Port":                 6334,
+				"host":                 "localhost",
+				"port":                 6334,
 			},
 		},
 		Llm: LlmConfig{
@@ -32,10 +68,26 @@ func NewMemoryConfig() MemoryConfig {
 			Config:   map[string]interface{}{},
 		},
 		HistoryDBPath: "./history.db", //Path to the history database
+		Usage: UsageConfig{
+			Enabled: true,
+			Prices:  utils.PriceTable{},
+		},
+		Quotas: QuotaConfig{
+			Enabled: false,
+		},
+		Auth: AuthConfig{
+			Enabled: false,
+		},
+		Server: ServerConfig{
+			Addr: ":8080",
+		},
 	}
+	// fills the remaining zero fields from their `default` struct tags
+	utils.ApplyDefaults(&config)
+	return config
 }
 
-// Validate validates the MemoryConfig
+// Validate validates the MemoryConfig, including provider specific checks
 func (mc *MemoryConfig) Validate() error {
 	if err := mc.Embedder.ValidateConfig(); err != nil {
 		return err
@@ -46,5 +98,91 @@ func (mc *MemoryConfig) Validate() error {
 	if err := mc.VectorStore.ValidateAndCreateConfig(); err != nil {
 		return err
 	}
-	return nil
+
+	errs := []error{}
+
+	// required API keys
+	if err := requireAPIKey("llm", mc.Llm.Provider, mc.Llm.Config); err != nil {
+		errs = append(errs, err)
+	}
+	if err := requireAPIKey("embedder", mc.Embedder.Provider, mc.Embedder.Config); err != nil {
+		errs = append(errs, err)
+	}
+
+	// the vector collection must have the dimensions of the embedder
+	if mc.VectorStore.Provider == "qdrant" {
+		if name, _ := mc.VectorStore.Config["collection_name"].(string); name == "" {
+			errs = append(errs, errors.New("vector_store.config.collection_name is required for qdrant"))
+		}
+	}
+	dims, ok := configInt(mc.VectorStore.Config, "embedding_model_dims")
+	if !ok || dims <= 0 {
+		errs = append(errs, errors.New("vector_store.config.embedding_model_dims must be a positive integer"))
+	} else if embedderDims, known := mc.Embedder.Dims(); known && embedderDims != dims {
+		errs = append(errs, fmt.Errorf("vector_store.config.embedding_model_dims is %d but embedder %s/%s produces %d dimensions", dims, mc.Embedder.Provider, mc.Embedder.Model(), embedderDims))
+	}
+
+	if mc.HistoryDBPath == "" {
+		errs = append(errs, errors.New("history_db_path is required"))
+	}
+
+	if mc.Auth.Enabled {
+		if len(mc.Auth.APIKeys) == 0 && mc.Auth.JWT.HMACSecret == "" && mc.Auth.JWT.RSAPublicKeyPath == "" {
+			errs = append(errs, errors.New("auth is enabled but no auth.api_keys, auth.jwt.hmac_secret or auth.jwt.rsa_public_key_path is configured"))
+		}
+		for i, key := range mc.Auth.APIKeys {
+			if key.Key == "" || key.Tenant == "" {
+				errs = append(errs, fmt.Errorf("auth.api_keys[%d] requires key and tenant", i))
+			}
+		}
+	}
+
+	if mc.Jobs.Workers < 1 || mc.Jobs.MaxAttempts < 1 {
+		errs = append(errs, errors.New("jobs.workers and jobs.max_attempts must be at least 1"))
+	}
+
+	errs = append(errs, mc.Webhooks.validate()...)
+	errs = append(errs, mc.Rerank.validate()...)
+	errs = append(errs, mc.Recency.validate()...)
+	errs = append(errs, mc.Forgetting.validate()...)
+	errs = append(errs, mc.Expiry.validate()...)
+	errs = append(errs, mc.Consolidation.validate()...)
+	errs = append(errs, mc.Graph.validate()...)
+	if _, err := time.LoadLocation(mc.TimeZone); err != nil {
+		errs = append(errs, fmt.Errorf("invalid timezone: %w", err))
+	}
+
+	for id, limits := range mc.Quotas.allLimits() {
+		if limits.RequestsPerMinute < 0 || limits.MaxFactsPerDay < 0 || limits.MaxMemories < 0 || limits.DailyTokenBudget < 0 {
+			errs = append(errs, fmt.Errorf("quotas %s: limits can't be negative", id))
+		}
+		if mc.Quotas.Enabled && limits.DailyTokenBudget > 0 && !mc.Usage.Enabled {
+			errs = append(errs, fmt.Errorf("quotas %s: daily_token_budget requires usage.enabled", id))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// apiKeyEnvVars - environment variable holding the API key of each provider that needs one
+var apiKeyEnvVars = map[string]string{
+	"openai":       "OPENAI_API_KEY",
+	"azure_openai": "AZURE_OPENAI_API_KEY",
+	"groq":         "GROQ_API_KEY",
+	"together":     "TOGETHER_API_KEY",
+}
+
+// requireAPIKey checks that a provider needing an API key has it in its config or environment
+func requireAPIKey(section string, provider string, config map[string]interface{}) error {
+	envVar, ok := apiKeyEnvVars[provider]
+	if !ok {
+		return nil
+	}
+	if key, _ := config["api_key"].(string); key != "" {
+		return nil
+	}
+	if os.Getenv(envVar) != "" {
+		return nil
+	}
+	return fmt.Errorf("%s provider %s requires %s.config.api_key or the %s environment variable", section, provider, section, envVar)
 }
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/qdrant/go-client/qdrant"
 )
@@ -42,3 +46,135 @@ func (p *PGVector) Delete(vectorID string) error {
 func (p *PGVector) DeleteCol() error {
 	return errors.New("PGVector.DeleteCol not implemented")
 }
+func (p *PGVector) VectorSize() (int, error) {
+	return 0, errors.New("PGVector.VectorSize not implemented")
+}
+func (p *PGVector) Scroll(filters map[string]interface{}, limit int, offset string, withVectors bool) ([]SearchResult, string, error) {
+	return nil, "", errors.New("PGVector.Scroll not implemented")
+}
+func (p *PGVector) Count() (int, error) {
+	return 0, errors.New("PGVector.Count not implemented")
+}
+
+// pgvectorWhere translates the filters of a VectorStore call to a SQL condition over the
+// JSONB payload column and its $n arguments, numbered from 1. Values are matched with
+// containment, so that a list field (e.g. tags) matches any of its elements, and ranges cast
+// created_at and updated_at to timestamptz and other fields to numeric.
+func pgvectorWhere(filters map[string]interface{}) (string, []interface{}, error) {
+	w := &pgvectorWhereBuilder{}
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	conditions := []string{}
+	for _, key := range keys {
+		f, ok := filters[key].(*Filter)
+		if !ok {
+			f = &Filter{Field: key, Eq: filters[key]}
+		}
+		condition, err := w.condition(*f)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	if len(conditions) == 0 {
+		return "TRUE", nil, nil
+	}
+	return strings.Join(conditions, " AND "), w.args, nil
+}
+
+type pgvectorWhereBuilder struct {
+	args []interface{}
+}
+
+// arg adds an argument and returns its placeholder
+func (w *pgvectorWhereBuilder) arg(value interface{}) string {
+	w.args = append(w.args, value)
+	return fmt.Sprintf("$%d", len(w.args))
+}
+
+func (w *pgvectorWhereBuilder) join(operator string, filters []Filter) (string, error) {
+	conditions := make([]string, len(filters))
+	for i, f := range filters {
+		condition, err := w.condition(f)
+		if err != nil {
+			return "", err
+		}
+		conditions[i] = condition
+	}
+	return "(" + strings.Join(conditions, " "+operator+" ") + ")", nil
+}
+
+func (w *pgvectorWhereBuilder) condition(f Filter) (string, error) {
+	switch {
+	case f.And != nil:
+		return w.join("AND", f.And)
+	case f.Or != nil:
+		return w.join("OR", f.Or)
+	case f.Not != nil:
+		condition, err := w.condition(*f.Not)
+		return "NOT " + condition, err
+	}
+
+	field := w.arg(f.Field)
+	switch {
+	case f.Exists != nil:
+		condition := fmt.Sprintf(`COALESCE(payload->%s NOT IN ('null'::jsonb, '""'::jsonb, '[]'::jsonb), FALSE)`, field)
+		if !*f.Exists {
+			condition = "NOT " + condition
+		}
+		return condition, nil
+	case f.IsNull != nil:
+		condition := fmt.Sprintf(`COALESCE(payload->%s = 'null'::jsonb, FALSE)`, field)
+		if !*f.IsNull {
+			condition = "NOT " + condition
+		}
+		return condition, nil
+	case f.Eq != nil, f.In != nil, f.Any != nil:
+		values := append(append([]interface{}{}, f.In...), f.Any...)
+		if f.Eq != nil {
+			values = []interface{}{f.Eq}
+		}
+		matches := make([]string, len(values))
+		for i, value := range values {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return "", fmt.Errorf("invalid filter value for %s: %w", f.Field, err)
+			}
+			matches[i] = fmt.Sprintf("payload->%s @> %s::jsonb", field, w.arg(string(data)))
+		}
+		return "COALESCE(" + strings.Join(matches, " OR ") + ", FALSE)", nil
+	case f.Range != nil:
+		value := fmt.Sprintf("(payload->>%s)::numeric", field)
+		if dateFields[f.Field] {
+			value = fmt.Sprintf("(payload->>%s)::timestamptz", field)
+		}
+		bounds := []string{}
+		for _, bound := range []struct {
+			operator string
+			value    interface{}
+		}{{">", f.Range.Gt}, {">=", f.Range.Gte}, {"<", f.Range.Lt}, {"<=", f.Range.Lte}} {
+			if bound.value == nil {
+				continue
+			}
+			var arg interface{}
+			if dateFields[f.Field] {
+				s, _ := bound.value.(string)
+				t, err := parseFilterTime(s)
+				if err != nil {
+					return "", err
+				}
+				arg = t
+			} else if n, ok := filterNumber(bound.value); ok {
+				arg = n
+			} else {
+				return "", fmt.Errorf("invalid filter: range on %s needs numbers", f.Field)
+			}
+			bounds = append(bounds, fmt.Sprintf("%s %s %s", value, bound.operator, w.arg(arg)))
+		}
+		return "COALESCE(" + strings.Join(bounds, " AND ") + ", FALSE)", nil
+	}
+	return "", fmt.Errorf("invalid filter: %s", f)
+}
@@ -317,6 +317,7 @@ ejemplo:
 const MEMORY_DEDUCTION_PROMPT_SPA = `Deduce los hechos relevantes en términos de sus intenciones, preferencias significativas y recuerdos importantes del texto proporcionado.
 Asegúrate de que los hechos extraídos estén formulados desde la perspectiva de la persona que hace el comentario.
 Solo devuelve los hechos relevantes, preferencias significativas y recuerdos importantes en viñetas:
+Fecha y hora actual: {{.now}}
 Texto en lenguaje natural: {{.conversation}}
 
 Restricciones para deducir hechos relevantes, preferencias significativas y recuerdos importantes:
@@ -325,6 +326,8 @@ Restricciones para deducir hechos relevantes, preferencias significativas y recu
 - Si no se ha deducido nada, No completes metadata.
 - Los hechos relevantes, preferencias significativas y recuerdos importantes deben ser concisos e informativos.
 - La extrae la metadata (scope, sentiment related_entities, related_events, tags) que creas conveniente para acompañar los hechos relevantes, preferencias significativas y recuerdos importantes. 
+- Si los hechos dejan de valer en una fecha (una reunión "mañana a las 17hs", una oferta "hasta el viernes", "esta semana"), agrega en la metadata "expires_at" con esa fecha y hora en formato RFC3339 (ej. 2025-01-11T19:00:00-03:00), calculada desde la fecha actual. Omítelo si los hechos no son temporales.
+- Asigna en la metadata "importance", un número de 1 a 10 de cuánto vale recordar los hechos a largo plazo: 1 para trivialidades (saludos, cortesías, "dijo buen día"), 5 para preferencias o planes comunes, 10 para datos personales, compromisos o decisiones importantes.
 - Respuesta en formato JSON con una clave como "relevant_facts" y otra para "metadata". Los valores correspondientes serán listas de cadenas.
 - Responde en el mismo idioma del texto.
 
@@ -340,7 +343,8 @@ ejemplo:
 		"sentiment": "neutral",
 		"related_entities": ["documentos", "equipos"],
 		"related_events": ["creación de documentos", "investigación de recursos"],
-		"tags": ["trabajo", "documentos", "prompts", "equipos"]
+		"tags": ["trabajo", "documentos", "prompts", "equipos"],
+		"importance": 6
 	}
 }
 
@@ -360,3 +364,50 @@ New Retrieved Facts:
 `
 
 // Return a JSON object where each fact is mapped to one of the above statuses, with a brief explanation of the reasoning for the status assignment.
+
+// MEMORY_CONSOLIDATION_PROMPT_SPA - the RESUMEN/HECHOS sections of the reduction of
+// chains.MEMORY_REDUCTION, over a cluster of similar memories of the same person
+const MEMORY_CONSOLIDATION_PROMPT_SPA = `Eres un sistema que consolida la memoria a largo plazo de una persona. Recibes un grupo de memorias numeradas, parecidas entre sí, guardadas en distintos momentos.
+
+Memorias:
+{{.memories}}
+
+Pasos:
+- En una sección llamada HECHOS, fusiona las memorias redundantes (que dicen lo mismo o una amplía a otra) en un solo hecho conciso e informativo que conserve todos los datos (nombres, números, fechas). Indica en "memorias" los números de las memorias que reemplaza, al menos dos. No fusiones memorias que se contradicen ni memorias que solo se parecen en el tema.
+- En una sección llamada RESUMEN, escribe como máximo un resumen de más alto nivel cuando el grupo revela algo que ninguna memoria dice por sí sola (un hábito, una preferencia, un proyecto en curso). Indica en "memorias" los números de las memorias de las que se deriva. Omítelo si sería solo una repetición.
+- Las memorias que no nombres quedan como están.
+- No inventes datos que no estén en las memorias.
+- Escribe desde la perspectiva de la persona, en el mismo idioma de las memorias.
+- Respuesta en formato JSON con las claves "HECHOS" y "RESUMEN", listas vacías si no hay nada que consolidar.
+
+ejemplo:
+{
+	"HECHOS": [
+		{"texto": "Juega al fútbol los martes y jueves con sus amigos del barrio", "memorias": [1, 3]}
+	],
+	"RESUMEN": [
+		{"texto": "El deporte en grupo es una parte importante de su semana", "memorias": [1, 2, 3]}
+	]
+}`
+
+const GRAPH_EXTRACTION_PROMPT_SPA = `Extrae un grafo de conocimiento de la memoria proporcionada: las entidades (personas, organizaciones, lugares, proyectos, objetos, eventos) y las relaciones entre ellas, como tripletas entidad-relación-entidad.
+Memoria: {{.memory}}
+Persona que habla: {{.speaker}}
+Entidades mencionadas: {{.entities}}
+
+Restricciones:
+- Cuando la memoria habla de la persona sin nombrarla, usa como entidad a la persona que habla.
+- Usa exactamente los nombres de las entidades mencionadas cuando se refieren a la misma entidad.
+- Los nombres de las entidades son cortos, sin artículos, tal como aparecen en la memoria.
+- Las relaciones son verbos en minúsculas unidos por guiones bajos (ej. trabaja_en, vive_en, es_amigo_de, prefiere).
+- Solo extrae relaciones que la memoria afirma, no las inventes.
+- Respuesta en formato JSON con una clave "triples", lista vacía si no hay relaciones.
+- Responde en el mismo idioma de la memoria.
+
+ejemplo:
+{
+	"triples": [
+		{"source": "Blas", "source_type": "persona", "relation": "trabaja_en", "target": "ITR", "target_type": "organizacion"},
+		{"source": "ITR", "source_type": "organizacion", "relation": "desarrolla", "target": "chatbot de WhatsApp", "target_type": "proyecto"}
+	]
+}`
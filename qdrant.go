@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
 	"github.com/google/uuid"
 	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Qdrant struct {
@@ -30,26 +32,38 @@ func NewQdrant(config map[string]interface{}) VectorStore {
 				api_key (str, optional): API key for Qdrant server. Defaults to None.
 				on_disk (bool, optional): Enables persistent storage. Defaults to False.
 	*/
+	host, ok := config["host"].(string)
+	if !ok || host == "" {
+		host = "localhost"
+	}
+	port, ok := configInt(config, "port")
+	if !ok {
+		port = 6334
+	}
+	apiKey, _ := config["api_key"].(string)
+
 	client, err := qdrant.NewClient(&qdrant.Config{
-		Host: "localhost",
-		Port: 6334,
+		Host:   host,
+		Port:   port,
+		APIKey: apiKey,
 	})
 
 	if err != nil {
 		panic(err)
 	}
 
-	collection, err := client.GetCollectionInfo(context.Background(), config["collection_name"].(string))
+	exists, err := client.CollectionExists(context.Background(), config["collection_name"].(string))
 
 	if err != nil {
 		panic(err)
 	}
 
-	if collection == nil {
+	if !exists {
+		dims, _ := configInt(config, "embedding_model_dims")
 		err = client.CreateCollection(context.Background(), &qdrant.CreateCollection{
 			CollectionName: config["collection_name"].(string),
 			VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
-				Size:     uint64(config["embedding_model_dims"].(int)),
+				Size:     uint64(dims),
 				Distance: qdrant.Distance_Cosine,
 			}),
 		})
@@ -90,22 +104,38 @@ func (q *Qdrant) Insert(vectors [][]float64, ids []string, payloads []map[string
 					listValues[j] = qdrant.NewValueString(str)
 				}
 				convertedPayload[key] = qdrant.NewValueList(&qdrant.ListValue{Values: listValues})
+			case []interface{}, map[string]interface{}, nil:
+				// lists read back from qdrant (see convertQdrantPayload) or decoded from JSON
+				value, err := qdrant.NewValue(v)
+				if err != nil {
+					return fmt.Errorf("invalid payload value for key %s: %w", key, err)
+				}
+				convertedPayload[key] = value
+			case *qdrant.Struct:
+				convertedPayload[key] = qdrant.NewValueStruct(v)
 			default:
 				panic(fmt.Sprintf("Unsupported payload type: %T for key %s", value, key))
 			}
 		}
 
+		pointID, err := parsePointID(ids[i])
+		if err != nil {
+			return fmt.Errorf("invalid vector ID: %v", err)
+		}
 		points[i] = &qdrant.PointStruct{
-			Id:      qdrant.NewID(ids[i]),
+			Id:      pointID,
 			Vectors: qdrant.NewVectors(float32Vector...),
 			Payload: convertedPayload,
 		}
 	}
 
-	q.client.Upsert(context.Background(), &qdrant.UpsertPoints{
+	_, err := q.client.Upsert(context.Background(), &qdrant.UpsertPoints{
 		CollectionName: q.config["collection_name"].(string),
 		Points:         points,
 	})
+	if err != nil {
+		return fmt.Errorf("failed to upsert points: %w", err)
+	}
 	return nil
 }
 
@@ -120,6 +150,9 @@ func (q *Qdrant) _createFilter(filters map[string]interface{}) *qdrant.Filter {
 	// Convert each filter key-value pair to a Qdrant condition
 	for key, value := range filters {
 		switch v := value.(type) {
+		case *Filter:
+			// the filter expression of Memory.WithFilter
+			conditions = append(conditions, qdrant.NewFilterAsCondition(qdrantFilter(*v)))
 		case string:
 			conditions = append(conditions, qdrant.NewMatchKeyword(key, v))
 		case float64:
@@ -166,6 +199,101 @@ func (q *Qdrant) _createFilter(filters map[string]interface{}) *qdrant.Filter {
 	}
 }
 
+// qdrantFilter translates a filter expression to a Qdrant filter: and, or and not to must,
+// should and must_not, and each condition to a match, range, datetime range, is_empty or
+// is_null condition
+func qdrantFilter(f Filter) *qdrant.Filter {
+	switch {
+	case f.And != nil:
+		return &qdrant.Filter{Must: qdrantConditions(f.And)}
+	case f.Or != nil:
+		return &qdrant.Filter{Should: qdrantConditions(f.Or)}
+	case f.Not != nil:
+		return &qdrant.Filter{MustNot: []*qdrant.Condition{qdrant.NewFilterAsCondition(qdrantFilter(*f.Not))}}
+	case f.Exists != nil && *f.Exists:
+		return &qdrant.Filter{MustNot: []*qdrant.Condition{qdrant.NewIsEmpty(f.Field)}}
+	case f.Exists != nil:
+		return &qdrant.Filter{Must: []*qdrant.Condition{qdrant.NewIsEmpty(f.Field)}}
+	case f.IsNull != nil && *f.IsNull:
+		return &qdrant.Filter{Must: []*qdrant.Condition{qdrant.NewIsNull(f.Field)}}
+	case f.IsNull != nil:
+		return &qdrant.Filter{MustNot: []*qdrant.Condition{qdrant.NewIsNull(f.Field)}}
+	case f.Eq != nil:
+		return &qdrant.Filter{Must: []*qdrant.Condition{qdrantMatch(f.Field, []interface{}{f.Eq})}}
+	case f.In != nil:
+		return &qdrant.Filter{Must: []*qdrant.Condition{qdrantMatch(f.Field, f.In)}}
+	case f.Any != nil:
+		return &qdrant.Filter{Must: []*qdrant.Condition{qdrantMatch(f.Field, f.Any)}}
+	case f.Range != nil && dateFields[f.Field]:
+		bound := func(value interface{}) *timestamppb.Timestamp {
+			if value == nil {
+				return nil
+			}
+			s, _ := value.(string)
+			t, _ := parseFilterTime(s)
+			return timestamppb.New(t)
+		}
+		return &qdrant.Filter{Must: []*qdrant.Condition{qdrant.NewDatetimeRange(f.Field, &qdrant.DatetimeRange{
+			Gt: bound(f.Range.Gt), Gte: bound(f.Range.Gte), Lt: bound(f.Range.Lt), Lte: bound(f.Range.Lte),
+		})}}
+	case f.Range != nil:
+		bound := func(value interface{}) *float64 {
+			if value == nil {
+				return nil
+			}
+			n, _ := filterNumber(value)
+			return &n
+		}
+		return &qdrant.Filter{Must: []*qdrant.Condition{qdrant.NewRange(f.Field, &qdrant.Range{
+			Gt: bound(f.Range.Gt), Gte: bound(f.Range.Gte), Lt: bound(f.Range.Lt), Lte: bound(f.Range.Lte),
+		})}}
+	}
+	return &qdrant.Filter{}
+}
+
+func qdrantConditions(filters []Filter) []*qdrant.Condition {
+	conditions := make([]*qdrant.Condition, len(filters))
+	for i, f := range filters {
+		conditions[i] = qdrant.NewFilterAsCondition(qdrantFilter(f))
+	}
+	return conditions
+}
+
+// qdrantMatch returns a condition matching a field (or an element of a list field) equal to
+// any of values: a keywords or integers match when they are all of one type, otherwise
+// should of a condition per value
+func qdrantMatch(field string, values []interface{}) *qdrant.Condition {
+	keywords := []string{}
+	ints := []int64{}
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			keywords = append(keywords, s)
+		} else if n, ok := filterNumber(value); ok && n == math.Trunc(n) {
+			ints = append(ints, int64(n))
+		}
+	}
+	switch {
+	case len(keywords) == len(values):
+		return qdrant.NewMatchKeywords(field, keywords...)
+	case len(ints) == len(values):
+		return qdrant.NewMatchInts(field, ints...)
+	}
+	conditions := []*qdrant.Condition{}
+	for _, value := range values {
+		switch v := value.(type) {
+		case string:
+			conditions = append(conditions, qdrant.NewMatchKeyword(field, v))
+		case bool:
+			conditions = append(conditions, qdrant.NewMatchBool(field, v))
+		default:
+			if n, ok := filterNumber(v); ok {
+				conditions = append(conditions, qdrant.NewRange(field, &qdrant.Range{Gte: &n, Lte: &n}))
+			}
+		}
+	}
+	return qdrant.NewFilterAsCondition(&qdrant.Filter{Should: conditions})
+}
+
 func Float32Ptr(f float32) *float32 {
 	return &f
 }
@@ -333,7 +461,7 @@ func (q *Qdrant) Get(vectorID string) (*qdrant.RetrievedPoint, error) {
 
 	// Check if any points were returned
 	if len(points) == 0 {
-		return nil, fmt.Errorf("no point found with ID: %s", vectorID)
+		return nil, fmt.Errorf("%w: no point found with ID: %s", ErrMemoryNotFound, vectorID)
 	}
 
 	// Take the first point (since we requested a single point)
@@ -351,6 +479,12 @@ func parsePointID(vectorID string) (*qdrant.PointId, error) {
 		return qdrant.NewIDNum(numID), nil
 	}
 
+	if num, ok := strings.CutPrefix(vectorID, "num:"); ok {
+		if numID, err := strconv.ParseUint(num, 10, 64); err == nil {
+			return qdrant.NewIDNum(numID), nil
+		}
+	}
+
 	if strings.HasPrefix(vectorID, "uuid:") {
 		parts := strings.Split(vectorID, ":")
 		if len(parts) == 2 {
@@ -372,9 +506,101 @@ func parsePointID(vectorID string) (*qdrant.PointId, error) {
 	return qdrant.NewID(vectorID), nil
 }
 
+// plainPointID returns a point id as accepted by the Qdrant API, e.g. uuid:"<uuid>" as <uuid>
+func plainPointID(vectorID string) string {
+	pointID, err := parsePointID(vectorID)
+	if err != nil {
+		return vectorID
+	}
+	if id := pointID.GetUuid(); id != "" {
+		return id
+	}
+	return strconv.FormatUint(pointID.GetNum(), 10)
+}
+
+// List returns the points matching filters, all of them if limit <= 0
 func (q *Qdrant) List(filters map[string]interface{}, limit int) ([][]SearchResult, error) {
-	return nil, errors.New("Qdrant.List not implemented")
+	filter := q._createFilter(filters)
+	results := []SearchResult{}
+	var offset *qdrant.PointId
+	for {
+		pageSize := 100
+		if limit > 0 && limit-len(results) < pageSize {
+			pageSize = limit - len(results)
+		}
+		page, next, err := q.scroll(filter, pageSize, offset, false)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, page...)
+		if next == nil || (limit > 0 && len(results) >= limit) {
+			break
+		}
+		offset = next
+	}
+	return [][]SearchResult{results}, nil
+}
+
+// Scroll returns a page of points in id order, see VectorStore.Scroll
+func (q *Qdrant) Scroll(filters map[string]interface{}, limit int, offset string, withVectors bool) ([]SearchResult, string, error) {
+	var offsetID *qdrant.PointId
+	if offset != "" {
+		id, err := parsePointID(offset)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid offset: %v", err)
+		}
+		offsetID = id
+	}
+	page, next, err := q.scroll(q._createFilter(filters), limit, offsetID, withVectors)
+	if err != nil || next == nil {
+		return page, "", err
+	}
+	return page, next.String(), nil
+}
+
+// scroll fetches one extra point to know where the next page starts, the client doesn't return it
+func (q *Qdrant) scroll(filter *qdrant.Filter, limit int, offset *qdrant.PointId, withVectors bool) ([]SearchResult, *qdrant.PointId, error) {
+	fetch := uint32(limit + 1)
+	points, err := q.client.Scroll(context.Background(), &qdrant.ScrollPoints{
+		CollectionName: q.config["collection_name"].(string),
+		Filter:         filter,
+		Offset:         offset,
+		Limit:          &fetch,
+		WithPayload:    qdrant.NewWithPayload(true),
+		WithVectors:    qdrant.NewWithVectors(withVectors),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to scroll points: %w", err)
+	}
+
+	var next *qdrant.PointId
+	if len(points) > limit {
+		next = points[limit].Id
+		points = points[:limit]
+	}
+	results := make([]SearchResult, len(points))
+	for i, point := range points {
+		results[i] = SearchResult{
+			ID:      point.Id.String(),
+			Payload: convertQdrantPayload(point.Payload),
+			Vector:  point.GetVectors().GetVector().GetData(),
+		}
+	}
+	return results, next, nil
 }
+
+func (q *Qdrant) Count() (int, error) {
+	exact := true
+	count, err := q.client.Count(context.Background(), &qdrant.CountPoints{
+		CollectionName: q.config["collection_name"].(string),
+		Exact:          &exact,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to count points: %w", err)
+	}
+	return int(count), nil
+}
+
 func (q *Qdrant) Update(vectorID string, vector []float32, payload map[string]interface{}) error {
 	pointID, err := parsePointID(vectorID)
 	if err != nil {
@@ -412,8 +638,38 @@ func (q *Qdrant) Update(vectorID string, vector []float32, payload map[string]in
 	return nil
 }
 func (q *Qdrant) Delete(vectorID string) error {
-	return errors.New("Qdrant.Delete not implemented")
+	pointID, err := parsePointID(vectorID)
+	if err != nil {
+		return fmt.Errorf("invalid vector ID: %v", err)
+	}
+	_, err = q.client.Delete(context.Background(), &qdrant.DeletePoints{
+		CollectionName: q.config["collection_name"].(string),
+		Points:         qdrant.NewPointsSelector(pointID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete point: %v", err)
+	}
+	return nil
+}
+func (q *Qdrant) VectorSize() (int, error) {
+	info, err := q.client.GetCollectionInfo(context.Background(), q.config["collection_name"].(string))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get collection info: %w", err)
+	}
+	vectorsConfig := info.GetConfig().GetParams().GetVectorsConfig()
+	if params := vectorsConfig.GetParams(); params != nil {
+		return int(params.GetSize()), nil
+	}
+	for _, params := range vectorsConfig.GetParamsMap().GetMap() {
+		return int(params.GetSize()), nil
+	}
+	return 0, errors.New("collection has no vectors config")
 }
+
 func (q *Qdrant) DeleteCol() error {
-	return errors.New("Qdrant.DeleteCol not implemented")
+	err := q.client.DeleteCollection(context.Background(), q.config["collection_name"].(string))
+	if err != nil {
+		return fmt.Errorf("failed to delete collection: %v", err)
+	}
+	return nil
 }
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+)
+
+// QuotaLimits - limits applied to a single user_id or agent_id. 0 means unlimited.
+type QuotaLimits struct {
+	RequestsPerMinute int `json:"requests_per_minute"`
+	MaxFactsPerDay    int `json:"max_facts_per_day"`
+	MaxMemories       int `json:"max_memories"`       // counted from when memGo kept the counter, see reserveFact
+	DailyTokenBudget  int `json:"daily_token_budget"` // measured from the usage ledger, requires usage.enabled
+}
+
+// QuotaConfig - quotas keyed by user_id and agent_id
+type QuotaConfig struct {
+	Enabled bool `json:"enabled" default:"false"`
+	// Default applies to every user_id and agent_id without an override
+	Default QuotaLimits            `json:"default"`
+	Users   map[string]QuotaLimits `json:"users,omitempty"`
+	Agents  map[string]QuotaLimits `json:"agents,omitempty"`
+}
+
+// limitsFor returns the limits for a quota key kind ("user" or "agent") and id
+func (qc QuotaConfig) limitsFor(kind string, id string) QuotaLimits {
+	overrides := qc.Users
+	if kind == "agent" {
+		overrides = qc.Agents
+	}
+	if limits, ok := overrides[id]; ok {
+		return limits
+	}
+	return qc.Default
+}
+
+// allLimits returns every configured limit keyed by a readable name
+func (qc QuotaConfig) allLimits() map[string]QuotaLimits {
+	all := map[string]QuotaLimits{"default": qc.Default}
+	for id, limits := range qc.Users {
+		all["users."+id] = limits
+	}
+	for id, limits := range qc.Agents {
+		all["agents."+id] = limits
+	}
+	return all
+}
+
+const (
+	quotaKindRequests = "requests"
+	quotaKindFacts    = "facts"
+	quotaKindMemories = "memories"
+)
+
+// QuotaExceededError is returned when a user_id or agent_id ran out of quota
+type QuotaExceededError struct {
+	Key        string        // e.g. "user:Blas" or "acme/agent:whatsapp", see quotaKeys
+	Limit      string        // e.g. "requests_per_minute"
+	Max        int           // configured limit
+	Used       int           // current usage
+	RetryAfter time.Duration // time until the quota resets, 0 if it never does
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded for %s: %s %d/%d", e.Key, e.Limit, e.Used, e.Max)
+}
+
+// QuotaStatus - the tightest request and token quota of a request, used for response headers
+type QuotaStatus struct {
+	RequestLimit     int
+	RequestRemaining int
+	RequestReset     time.Time
+	TokenLimit       int
+	TokenRemaining   int
+}
+
+// quotaKey - a user_id or agent_id quota of a scope
+type quotaKey struct {
+	kind string // "user" or "agent"
+	id   string
+	key  string // of its counters, e.g. "user:Blas", or "acme/user:Blas" in tenant acme
+}
+
+// quotaKeys returns the quota keys present in scope. Counters are kept per tenant, the
+// tenant_id of scope or else the Memory's.
+func (m *Memory) quotaKeys(scope map[string]interface{}) []quotaKey {
+	userID, agentID, _ := scopeFromMap(scope)
+	prefix := ""
+	if tenantID, _ := scope["tenant_id"].(string); tenantID != "" {
+		prefix = tenantID + "/"
+	} else if m.tenantID != "" {
+		prefix = m.tenantID + "/"
+	}
+	keys := []quotaKey{}
+	if userID != "" {
+		keys = append(keys, quotaKey{kind: "user", id: userID, key: prefix + "user:" + userID})
+	}
+	if agentID != "" {
+		keys = append(keys, quotaKey{kind: "agent", id: agentID, key: prefix + "agent:" + agentID})
+	}
+	return keys
+}
+
+// CheckQuota checks the request rate and daily token budget for the scope.
+// When consume is true the request counts against the requests_per_minute quota, unless
+// it is part of a request that already did, see Chat.
+func (m *Memory) CheckQuota(scope map[string]interface{}, consume bool) (*QuotaStatus, error) {
+	if m.db == nil || !m.config.Quotas.Enabled {
+		return nil, nil
+	}
+	consume = consume && !m.quotaConsumed
+
+	now := time.Now().UTC()
+	minute := now.Truncate(time.Minute)
+	minuteBucket := minute.Format(time.RFC3339)
+	dayStart := now.Truncate(24 * time.Hour)
+
+	if consume {
+		if err := m.db.PruneCounters(quotaKindRequests, minuteBucket); err != nil {
+			log.Printf("Error pruning quota counters: %v", err)
+		}
+	}
+
+	status := &QuotaStatus{RequestLimit: -1, TokenLimit: -1}
+	trackRequests := func(max int, used int) {
+		if remaining := max - used; status.RequestLimit < 0 || remaining < status.RequestRemaining {
+			status.RequestLimit = max
+			status.RequestRemaining = remaining
+			status.RequestReset = minute.Add(time.Minute)
+		}
+	}
+	// the requests are consumed at once after every other check, so that a request rejected
+	// on any key consumes none
+	counters := []sqlitemanager.QuotaCounter{}
+	for _, k := range m.quotaKeys(scope) {
+		key := k.key
+		limits := m.config.Quotas.limitsFor(k.kind, k.id)
+
+		if limits.DailyTokenBudget > 0 {
+			query := sqlitemanager.UsageQuery{From: dayStart.Format(time.RFC3339)}
+			if k.kind == "user" {
+				query.UserID = k.id
+			} else {
+				query.AgentID = k.id
+			}
+			totals, err := m.db.GetUsageTotals(query)
+			if err != nil {
+				return nil, err
+			}
+			used := 0
+			for _, total := range totals {
+				used += total.PromptTokens + total.CompletionTokens
+			}
+			if used >= limits.DailyTokenBudget {
+				return status, &QuotaExceededError{Key: key, Limit: "daily_token_budget", Max: limits.DailyTokenBudget, Used: used, RetryAfter: dayStart.Add(24 * time.Hour).Sub(now)}
+			}
+			remaining := limits.DailyTokenBudget - used
+			if status.TokenLimit < 0 || remaining < status.TokenRemaining {
+				status.TokenLimit = limits.DailyTokenBudget
+				status.TokenRemaining = remaining
+			}
+		}
+
+		if limits.RequestsPerMinute > 0 {
+			if consume {
+				counters = append(counters, sqlitemanager.QuotaCounter{Key: key, Kind: quotaKindRequests, Bucket: minuteBucket, Max: limits.RequestsPerMinute})
+				continue
+			}
+			used, err := m.db.GetCounter(key, quotaKindRequests, minuteBucket)
+			if err != nil {
+				return nil, err
+			}
+			if used >= limits.RequestsPerMinute {
+				return status, &QuotaExceededError{Key: key, Limit: "requests_per_minute", Max: limits.RequestsPerMinute, Used: used, RetryAfter: minute.Add(time.Minute).Sub(now)}
+			}
+			trackRequests(limits.RequestsPerMinute, used)
+		}
+	}
+
+	if len(counters) > 0 {
+		used, rejected, err := m.db.ConsumeCounters(counters)
+		if err != nil {
+			return nil, err
+		}
+		if rejected >= 0 {
+			c := counters[rejected]
+			return status, &QuotaExceededError{Key: c.Key, Limit: "requests_per_minute", Max: c.Max, Used: used[rejected], RetryAfter: minute.Add(time.Minute).Sub(now)}
+		}
+		for i, c := range counters {
+			trackRequests(c.Max, used[i])
+		}
+	}
+	return status, nil
+}
+
+// quotaMax returns the Max of a counter for a limit, unlimited when 0
+func quotaMax(limit int) int {
+	if limit <= 0 {
+		return math.MaxInt64
+	}
+	return limit
+}
+
+// reserveFact consumes the facts-per-day and total memories counters of the scope before a
+// memory is stored, at once so that concurrent adds can't go over the quotas. The counters are
+// kept with quotas disabled too; memories stored before they existed aren't counted towards
+// max_memories.
+func (m *Memory) reserveFact(scope map[string]interface{}) error {
+	if m.db == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	dayStart := now.Truncate(24 * time.Hour)
+	dayBucket := dayStart.Format("2006-01-02")
+
+	counters := []sqlitemanager.QuotaCounter{}
+	for _, k := range m.quotaKeys(scope) {
+		limits := QuotaLimits{}
+		if m.config.Quotas.Enabled {
+			limits = m.config.Quotas.limitsFor(k.kind, k.id)
+		}
+		counters = append(counters,
+			sqlitemanager.QuotaCounter{Key: k.key, Kind: quotaKindFacts, Bucket: dayBucket, Max: quotaMax(limits.MaxFactsPerDay)},
+			sqlitemanager.QuotaCounter{Key: k.key, Kind: quotaKindMemories, Bucket: "total", Max: quotaMax(limits.MaxMemories)},
+		)
+	}
+	if len(counters) == 0 {
+		return nil
+	}
+	used, rejected, err := m.db.ConsumeCounters(counters)
+	if err != nil {
+		return err
+	}
+	if rejected < 0 {
+		return nil
+	}
+	c := counters[rejected]
+	if c.Kind == quotaKindFacts {
+		return &QuotaExceededError{Key: c.Key, Limit: "max_facts_per_day", Max: c.Max, Used: used[rejected], RetryAfter: dayStart.Add(24 * time.Hour).Sub(now)}
+	}
+	return &QuotaExceededError{Key: c.Key, Limit: "max_memories", Max: c.Max, Used: used[rejected]}
+}
+
+// releaseFact gives back the counters consumed by reserveFact when the memory wasn't stored
+func (m *Memory) releaseFact(scope map[string]interface{}) {
+	if m.db == nil {
+		return
+	}
+	dayBucket := time.Now().UTC().Format("2006-01-02")
+	for _, k := range m.quotaKeys(scope) {
+		if _, err := m.db.IncrementCounter(k.key, quotaKindFacts, dayBucket, -1); err != nil {
+			log.Printf("Error updating quota counter: %v", err)
+		}
+		if _, err := m.db.IncrementCounter(k.key, quotaKindMemories, "total", -1); err != nil {
+			log.Printf("Error updating quota counter: %v", err)
+		}
+	}
+}
+
+// trackMemoryCount updates the total memories counter after a memory was imported (delta 1)
+// or deleted (delta -1), memories added by createMemory are counted by reserveFact
+func (m *Memory) trackMemoryCount(scope map[string]interface{}, delta int) {
+	if m.db == nil {
+		return
+	}
+	for _, k := range m.quotaKeys(scope) {
+		if _, err := m.db.IncrementCounter(k.key, quotaKindMemories, "total", delta); err != nil {
+			log.Printf("Error updating quota counter: %v", err)
+		}
+	}
+}
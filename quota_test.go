@@ -0,0 +1,111 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckQuota(t *testing.T) {
+	db, err := sqlitemanager.NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+	config := NewMemoryConfig()
+	config.Quotas = QuotaConfig{
+		Enabled: true,
+		Default: QuotaLimits{RequestsPerMinute: 10},
+		Agents:  map[string]QuotaLimits{"whatsapp": {RequestsPerMinute: 2}},
+	}
+	m := &Memory{config: config, db: db}
+	scope := map[string]interface{}{"user_id": "Blas", "agent_id": "whatsapp"}
+
+	status, err := m.CheckQuota(scope, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, status.RequestLimit)
+	assert.Equal(t, 1, status.RequestRemaining)
+	_, err = m.CheckQuota(scope, true)
+	assert.NoError(t, err)
+
+	// rejected on the agent key, without consuming the user one
+	_, err = m.CheckQuota(scope, true)
+	var quotaErr *QuotaExceededError
+	assert.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, "agent:whatsapp", quotaErr.Key)
+	assert.Equal(t, "requests_per_minute", quotaErr.Limit)
+	assert.Equal(t, 2, quotaErr.Used)
+	assert.Greater(t, quotaErr.RetryAfter, time.Duration(0))
+	assert.LessOrEqual(t, quotaErr.RetryAfter, time.Minute)
+	status, err = m.CheckQuota(map[string]interface{}{"user_id": "Blas"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, status.RequestRemaining)
+
+	// the Search and Add of a Chat don't consume its request again
+	consumed := *m
+	consumed.quotaConsumed = true
+	status, err = consumed.CheckQuota(map[string]interface{}{"user_id": "Blas"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, status.RequestRemaining)
+
+	// concurrent requests don't overshoot the limit
+	other := map[string]interface{}{"user_id": "Ana"}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.CheckQuota(other, true); err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 10, accepted)
+}
+
+func TestReserveFact(t *testing.T) {
+	db, err := sqlitemanager.NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+	config := NewMemoryConfig()
+	config.Quotas = QuotaConfig{Enabled: true, Default: QuotaLimits{MaxMemories: 5}}
+	m := &Memory{config: config, db: db}
+
+	// concurrent adds don't overshoot max_memories
+	scope := map[string]interface{}{"user_id": "Blas", "tenant_id": "acme"}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.reserveFact(scope); err == nil {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 5, accepted)
+	var quotaErr *QuotaExceededError
+	assert.ErrorAs(t, m.reserveFact(scope), &quotaErr)
+	assert.Equal(t, "acme/user:Blas", quotaErr.Key)
+	assert.Equal(t, "max_memories", quotaErr.Limit)
+
+	// the same user_id of another tenant has its own counters
+	assert.NoError(t, m.WithTenant("globex").reserveFact(map[string]interface{}{"user_id": "Blas"}))
+
+	m.releaseFact(scope)
+	assert.NoError(t, m.reserveFact(scope))
+
+	config.Usage.Enabled = false
+	config.Quotas.Default.DailyTokenBudget = 1000
+	assert.ErrorContains(t, config.Validate(), "daily_token_budget requires usage.enabled")
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecencyConfig - recency weighting of Memory.Search
+type RecencyConfig struct {
+	Enabled      bool    `json:"enabled"`                     // weight every search by recency, otherwise only the ones of WithRecency
+	HalfLifeDays float64 `json:"half_life_days" default:"30"` // age at which the recency of a memory halves
+	Weight       float64 `json:"weight" default:"0.3"`        // share of the score given by recency, from 0 to 1
+}
+
+// RecencyOptions - recency weighting of a single search, zero values use the recency config
+type RecencyOptions struct {
+	HalfLife time.Duration
+	Weight   float64
+}
+
+func (rc RecencyConfig) validate() []error {
+	errs := []error{}
+	if rc.HalfLifeDays <= 0 {
+		errs = append(errs, errors.New("recency.half_life_days must be positive"))
+	}
+	if rc.Weight < 0 || rc.Weight > 1 {
+		errs = append(errs, errors.New("recency.weight must be between 0 and 1"))
+	}
+	return errs
+}
+
+// WithRecency returns a copy of the Memory whose Search favours recent memories, see applyRecency
+func (m *Memory) WithRecency(opts RecencyOptions) *Memory {
+	scoped := *m
+	scoped.recency = &opts
+	return &scoped
+}
+
+// recencySettings returns the recency settings of Search, nil when it doesn't weight by recency
+func (m *Memory) recencySettings() *RecencyConfig {
+	if m.recency == nil && !m.config.Recency.Enabled {
+		return nil
+	}
+	settings := m.config.Recency
+	if settings.HalfLifeDays <= 0 {
+		settings.HalfLifeDays = 30
+	}
+	if opts := m.recency; opts != nil {
+		if opts.HalfLife > 0 {
+			settings.HalfLifeDays = opts.HalfLife.Hours() / 24
+		}
+		if opts.Weight > 0 {
+			settings.Weight = opts.Weight
+		}
+	}
+	return &settings
+}
+
+// applyRecency blends the score of each memory with its recency, which halves every half life
+// since the memory was last updated (or created):
+// score = (1-Weight)*score + Weight*0.5^(age/half life).
+// The recency is returned as "recency" and the results are sorted by the new score.
+func applyRecency(memories []map[string]interface{}, settings RecencyConfig, now time.Time) {
+	for _, memory := range memories {
+		recency := 0.0
+		changed, _ := memory["updated_at"].(string)
+		if changed == "" {
+			changed, _ = memory["created_at"].(string)
+		}
+		if t, err := time.Parse(time.RFC3339, changed); err == nil {
+			age := math.Max(now.Sub(t).Hours()/24, 0)
+			recency = math.Pow(0.5, age/settings.HalfLifeDays)
+		}
+		score, _ := memory["score"].(float64)
+		memory["recency"] = recency
+		memory["score"] = (1-settings.Weight)*score + settings.Weight*recency
+	}
+	sort.SliceStable(memories, func(i, j int) bool {
+		return memories[i]["score"].(float64) > memories[j]["score"].(float64)
+	})
+}
+
+// TimeWindow - the creation times a search is restricted to, zero bounds are open
+type TimeWindow struct {
+	Since time.Time // inclusive
+	Until time.Time // exclusive
+}
+
+// IsZero reports whether the window is unbounded
+func (w TimeWindow) IsZero() bool {
+	return w.Since.IsZero() && w.Until.IsZero()
+}
+
+// Filter returns the window as a range on created_at
+func (w TimeWindow) Filter() *Filter {
+	r := &FilterRange{}
+	if !w.Since.IsZero() {
+		r.Gte = w.Since.UTC().Format(time.RFC3339)
+	}
+	if !w.Until.IsZero() {
+		r.Lt = w.Until.UTC().Format(time.RFC3339)
+	}
+	return &Filter{Field: "created_at", Range: r}
+}
+
+// WithTimeWindow returns a copy of the Memory whose Search, HybridSearch and GetAll only
+// return the memories created within w, in addition to the filter of WithFilter
+func (m *Memory) WithTimeWindow(w TimeWindow) *Memory {
+	if w.IsZero() {
+		return m
+	}
+	if m.filter == nil {
+		return m.WithFilter(w.Filter())
+	}
+	return m.WithFilter(&Filter{And: []Filter{*m.filter, *w.Filter()}})
+}
+
+const timeWindowDate = `(\d{4}-\d{2}-\d{2}(?:t\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:z|[+-]\d{2}:\d{2}))?)`
+
+var (
+	timeWindowSince  = regexp.MustCompile(`\b(?:since|after|from|desde|a partir del?)\s+(?:el\s+)?` + timeWindowDate)
+	timeWindowBefore = regexp.MustCompile(`\b(?:before|antes del?)\s+(?:el\s+)?` + timeWindowDate)
+	timeWindowUntil  = regexp.MustCompile(`\b(?:until|through|hasta)\s+(?:el\s+)?` + timeWindowDate)
+	timeWindowLastN  = regexp.MustCompile(`\b(?:(?:last|past)\s+(\d+)\s+(day|week|month|year)s?|ultim[oa]s\s+(\d+)\s+(dia|semana|mes|ano)(?:s|es)?)\b`)
+)
+
+// timeWindowPhrases - named periods in English and Spanish, by their offset from the current one
+var timeWindowPhrases = []struct {
+	pattern *regexp.Regexp
+	unit    string // day, week, month or year
+	offset  int    // 0 for the current period, -1 for the previous one
+}{
+	{regexp.MustCompile(`\b(?:today|hoy)\b`), "day", 0},
+	{regexp.MustCompile(`\b(?:yesterday|ayer)\b`), "day", -1},
+	{regexp.MustCompile(`\b(?:(?:last|previous) week|semana pasada)\b`), "week", -1},
+	{regexp.MustCompile(`\b(?:this week|esta semana)\b`), "week", 0},
+	{regexp.MustCompile(`\b(?:(?:last|previous) month|mes pasado)\b`), "month", -1},
+	{regexp.MustCompile(`\b(?:this month|este mes)\b`), "month", 0},
+	{regexp.MustCompile(`\b(?:(?:last|previous) year|ano pasado)\b`), "year", -1},
+	{regexp.MustCompile(`\b(?:this year|este ano)\b`), "year", 0},
+}
+
+// ParseTimeWindow finds the time a query asks about, e.g. "since 2025-01-01", "last week",
+// "los últimos 3 días" or "ayer", and returns it as a window. Dates and periods are those of
+// the location of now, weeks start on Monday.
+func ParseTimeWindow(query string, now time.Time) (TimeWindow, bool) {
+	text := foldText(query)
+	loc := now.Location()
+
+	var w TimeWindow
+	if match := timeWindowSince.FindStringSubmatch(text); match != nil {
+		w.Since, _ = parseWindowTime(match[1], loc)
+	}
+	if match := timeWindowBefore.FindStringSubmatch(text); match != nil {
+		w.Until, _ = parseWindowTime(match[1], loc)
+	} else if match := timeWindowUntil.FindStringSubmatch(text); match != nil {
+		if until, dateOnly := parseWindowTime(match[1], loc); dateOnly {
+			w.Until = until.AddDate(0, 0, 1) // the whole day
+		} else {
+			w.Until = until
+		}
+	}
+	if !w.IsZero() {
+		return w, true
+	}
+
+	if match := timeWindowLastN.FindStringSubmatch(text); match != nil {
+		amount, unit := match[1], match[2]
+		if amount == "" {
+			amount, unit = match[3], map[string]string{"dia": "day", "semana": "week", "mes": "month", "ano": "year"}[match[4]]
+		}
+		n, _ := strconv.Atoi(amount)
+		return TimeWindow{Since: addPeriods(now, unit, -n)}, true
+	}
+
+	for _, phrase := range timeWindowPhrases {
+		if phrase.pattern.MatchString(text) {
+			start := addPeriods(periodStart(now, phrase.unit), phrase.unit, phrase.offset)
+			return TimeWindow{Since: start, Until: addPeriods(start, phrase.unit, 1)}, true
+		}
+	}
+	return TimeWindow{}, false
+}
+
+// parseWindowTime parses a date of a query in loc, reporting whether it had no time
+func parseWindowTime(s string, loc *time.Location) (time.Time, bool) {
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t, true
+	}
+	t, _ := time.Parse(time.RFC3339, strings.ToUpper(s))
+	return t, false
+}
+
+// periodStart returns the start of the day, week, month or year of t
+func periodStart(t time.Time, unit string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch unit {
+	case "week":
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case "month":
+		return day.AddDate(0, 0, 1-day.Day())
+	case "year":
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	}
+	return day
+}
+
+func addPeriods(t time.Time, unit string, n int) time.Time {
+	switch unit {
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+	case "month":
+		return t.AddDate(0, n, 0)
+	case "year":
+		return t.AddDate(n, 0, 0)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+// searchTimeWindow returns the window of a search request: the since and until dates when
+// given, otherwise the time the query asks about, in loc
+func searchTimeWindow(query string, since string, until string, loc *time.Location) (TimeWindow, error) {
+	if since == "" && until == "" {
+		w, _ := ParseTimeWindow(query, time.Now().In(loc))
+		return w, nil
+	}
+	var w TimeWindow
+	for _, bound := range []struct {
+		value string
+		t     *time.Time
+	}{{since, &w.Since}, {until, &w.Until}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02", bound.value, loc)
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339, bound.value); err != nil {
+				return TimeWindow{}, errors.New("since and until must be RFC3339 timestamps or YYYY-MM-DD dates")
+			}
+		}
+		*bound.t = t
+	}
+	return w, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Argentina/Buenos_Aires")
+	now := time.Date(2025, 3, 12, 15, 30, 0, 0, loc) // a Wednesday
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, loc) }
+
+	cases := map[string]TimeWindow{
+		"what did they say last week?":                     {Since: date(2025, 3, 3), Until: date(2025, 3, 10)},
+		"¿qué dijo ayer?":                                  {Since: date(2025, 3, 11), Until: date(2025, 3, 12)},
+		"reuniones de este mes":                            {Since: date(2025, 3, 1), Until: date(2025, 4, 1)},
+		"pedidos de los últimos 3 días":                    {Since: now.AddDate(0, 0, -3)},
+		"meetings since 2025-01-01":                        {Since: date(2025, 1, 1)},
+		"mensajes desde el 2025-01-01 hasta el 2025-01-31": {Since: date(2025, 1, 1), Until: date(2025, 2, 1)},
+		"calls before 2025-02-01T10:00:00Z":                {Until: time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC)},
+	}
+	for query, expected := range cases {
+		w, ok := ParseTimeWindow(query, now)
+		assert.True(t, ok, query)
+		assert.True(t, expected.Since.Equal(w.Since), "%s: since %v, expected %v", query, w.Since, expected.Since)
+		assert.True(t, expected.Until.Equal(w.Until), "%s: until %v, expected %v", query, w.Until, expected.Until)
+	}
+
+	_, ok := ParseTimeWindow("su número de teléfono", now)
+	assert.False(t, ok)
+
+	f := (&Memory{}).WithFilter(&Filter{Field: "tags", Eq: "trabajo"}).WithTimeWindow(cases["¿qué dijo ayer?"]).filter
+	assert.Len(t, f.And, 2)
+	assert.True(t, f.Matches(map[string]interface{}{"tags": []interface{}{"trabajo"}, "created_at": "2025-03-11T20:00:00-03:00"}))
+	assert.False(t, f.Matches(map[string]interface{}{"tags": []interface{}{"trabajo"}, "created_at": "2025-03-12T09:00:00-03:00"}))
+}
+
+func TestApplyRecency(t *testing.T) {
+	now := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+	memories := []map[string]interface{}{
+		{"id": "old", "score": 0.95, "created_at": "2024-12-31T00:00:00Z"},
+		{"id": "updated", "score": 0.9, "created_at": "2024-12-31T00:00:00Z", "updated_at": "2025-03-31T00:00:00Z"},
+		{"id": "month", "score": 0.9, "created_at": "2025-03-01T00:00:00Z"},
+	}
+	applyRecency(memories, RecencyConfig{HalfLifeDays: 30, Weight: 0.5}, now)
+
+	assert.Equal(t, "updated", memories[0]["id"])
+	assert.Equal(t, "month", memories[1]["id"])
+	assert.InDelta(t, 0.95, memories[0]["score"], 1e-9)
+	assert.InDelta(t, 0.5, memories[1]["recency"], 1e-9)
+	assert.InDelta(t, 0.7, memories[1]["score"], 1e-9)
+}
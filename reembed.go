@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/matigumma/memGo/utils"
+)
+
+// ReembedOptions - options of Memory.Reembed
+type ReembedOptions struct {
+	Embedder         EmbedderConfig // embedder the vectors are rebuilt with
+	TargetCollection string         // defaults to <collection_name>_<model>
+	BatchSize        int            // memories embedded and written per batch, defaults to 64
+	NoSwap           bool           // keep the current collection active after the migration
+}
+
+// ReembedReport - result of Memory.Reembed
+type ReembedReport struct {
+	JobID       string `json:"job_id"`
+	Source      string `json:"source"`
+	Target      string `json:"target"`
+	Model       string `json:"model"`
+	Dims        int    `json:"dims"`
+	Resumed     bool   `json:"resumed"`
+	Migrated    int    `json:"migrated"`
+	Skipped     int    `json:"skipped"` // points without a data text to embed
+	SourceCount int    `json:"source_count"`
+	TargetCount int    `json:"target_count"`
+	Swapped     bool   `json:"swapped"`
+}
+
+// activeCollectionKey is the settings key holding the collection that replaced the configured one
+func activeCollectionKey(configured string) string {
+	return "active_collection:" + configured
+}
+
+// activeEmbedderKey is the settings key holding the embedder of the active collection, as JSON
+func activeEmbedderKey(configured string) string {
+	return "active_embedder:" + configured
+}
+
+// ErrCollectionReplaced is returned by the writes of a Memory whose collection was replaced by
+// a re-embedding, e.g. in another process: it must be restarted to use the new collection
+var ErrCollectionReplaced = errors.New("the collection was replaced by a re-embedding, restart to use the new one")
+
+// resolveReembedded returns the config pointing to the collection and embedder a completed
+// re-embedding switched to, or the config unchanged if there was none. The credentials of the
+// configured embedder are kept when the provider is the same, they aren't stored.
+func resolveReembedded(db *sqlitemanager.SQLiteManager, config MemoryConfig) (MemoryConfig, error) {
+	configured, _ := config.VectorStore.Config["collection_name"].(string)
+	active, err := db.GetSetting(activeCollectionKey(configured))
+	if err != nil || active == "" || active == configured {
+		return config, err
+	}
+	log.Printf("Using collection %s, re-embedded from %s", active, configured)
+	vectorStore := map[string]interface{}{"collection_name": active}
+
+	stored, err := db.GetSetting(activeEmbedderKey(configured))
+	if err != nil {
+		return config, err
+	}
+	if stored != "" {
+		var embedder EmbedderConfig
+		if err := json.Unmarshal([]byte(stored), &embedder); err != nil {
+			return config, fmt.Errorf("invalid embedder of collection %s: %w", active, err)
+		}
+		if embedder.Provider == config.Embedder.Provider {
+			embedder.Config = utils.MergeMaps(config.Embedder.Config, embedder.Config)
+		}
+		config.Embedder = embedder
+		if dims, ok := embedder.Dims(); ok {
+			vectorStore["embedding_model_dims"] = dims
+		}
+		log.Printf("Using embedder %s/%s of collection %s", embedder.Provider, embedder.Model(), active)
+	}
+	config.VectorStore.Config = utils.MergeMaps(config.VectorStore.Config, vectorStore)
+	return config, nil
+}
+
+// checkActiveCollection returns ErrCollectionReplaced if a re-embedding switched to another
+// collection than the Memory writes to
+func (m *Memory) checkActiveCollection() error {
+	if m.db == nil {
+		return nil
+	}
+	active, err := m.db.GetSetting(activeCollectionKey(m.collectionName))
+	if err != nil {
+		return err
+	}
+	if current, _ := m.config.VectorStore.Config["collection_name"].(string); active != "" && active != current {
+		return fmt.Errorf("%w: %s", ErrCollectionReplaced, active)
+	}
+	return nil
+}
+
+var collectionNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// defaultReembedTarget names the collection for a model, e.g. memGo_nomic-embed-text
+func defaultReembedTarget(collection string, model string) string {
+	return collection + "_" + collectionNameUnsafe.ReplaceAllString(model, "-")
+}
+
+// Reembed rebuilds every vector of the active collection from its payload data with a new
+// embedder, writing them to a new collection with the embedder dims. Once the point counts
+// match, the new collection and its embedder become the active ones for this Memory and,
+// through the history database, for every Memory created afterwards with the same
+// collection_name. Memories created before, e.g. running servers, fail their writes with
+// ErrCollectionReplaced until restarted.
+// Progress is checkpointed after each batch: running it again with the same options resumes
+// an interrupted migration.
+func (m *Memory) Reembed(opts ReembedOptions) (*ReembedReport, error) {
+	if m.tenantID != "" {
+		return nil, errors.New("reembed is not allowed on a tenant scoped Memory")
+	}
+	if err := opts.Embedder.ValidateConfig(); err != nil {
+		return nil, err
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 64
+	}
+
+	embedder, err := EmbedderFactory{}.Create(opts.Embedder.Provider, opts.Embedder.Config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating embedder: %w", err)
+	}
+	dims, err := m.embeddingDims(embedder, opts.Embedder)
+	if err != nil {
+		return nil, err
+	}
+	model := embedder.Model()
+
+	source, _ := m.config.VectorStore.Config["collection_name"].(string)
+	target := opts.TargetCollection
+	if target == "" {
+		target = defaultReembedTarget(m.collectionName, model)
+	}
+	if target == source {
+		return nil, fmt.Errorf("collection %s is already the active collection", target)
+	}
+
+	targetConfig := utils.MergeMaps(m.config.VectorStore.Config, map[string]interface{}{
+		"collection_name":      target,
+		"embedding_model_dims": dims,
+	})
+	targetStore, err := VectorStoreFactory{}.Create(m.config.VectorStore.Provider, targetConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error creating vector store: %w", err)
+	}
+	if err := checkCollectionDims(targetStore, target, model, dims); err != nil {
+		return nil, err
+	}
+
+	job, resumed, err := m.db.StartReembedJob(source, target, model)
+	if err != nil {
+		return nil, err
+	}
+	report := &ReembedReport{JobID: job.ID, Source: source, Target: target, Model: model, Dims: dims, Resumed: resumed}
+	if resumed {
+		log.Printf("Resuming re-embedding of %s into %s after %d memories", source, target, job.Migrated)
+	}
+
+	for {
+		points, next, err := m.vectorStore.Scroll(nil, opts.BatchSize, job.NextOffset, false)
+		if err != nil {
+			return report, fmt.Errorf("error reading collection %s: %w", source, err)
+		}
+
+		vectors := make([][]float64, 0, len(points))
+		ids := make([]string, 0, len(points))
+		payloads := make([]map[string]interface{}, 0, len(points))
+		for _, point := range points {
+			data, _ := point.Payload["data"].(string)
+			if data == "" {
+				log.Printf("Skipping memory %s: no data to embed", point.ID)
+				job.Skipped++
+				continue
+			}
+			embeddings, _, err := m.embedWith(embedder, data, "reembed", point.Payload)
+			if err != nil {
+				return report, fmt.Errorf("error embedding memory %s: %w", point.ID, err)
+			}
+			vectors = append(vectors, embeddings)
+			ids = append(ids, point.ID)
+			payloads = append(payloads, point.Payload)
+		}
+		if len(ids) > 0 {
+			if err := targetStore.Insert(vectors, ids, payloads); err != nil {
+				return report, fmt.Errorf("error writing collection %s: %w", target, err)
+			}
+		}
+
+		job.Migrated += len(ids)
+		job.NextOffset = next
+		if err := m.db.SaveReembedJob(job); err != nil {
+			return report, err
+		}
+		report.Migrated, report.Skipped = job.Migrated, job.Skipped
+		log.Printf("Re-embedded %d memories into %s (%d skipped)", job.Migrated, target, job.Skipped)
+		if next == "" {
+			break
+		}
+	}
+
+	// verify that every memory made it before switching
+	if report.SourceCount, err = m.vectorStore.Count(); err != nil {
+		return report, err
+	}
+	if report.TargetCount, err = targetStore.Count(); err != nil {
+		return report, err
+	}
+	if report.TargetCount != report.SourceCount-job.Skipped {
+		// rescan from the start on the next run, writes are idempotent
+		job.NextOffset, job.Migrated, job.Skipped = "", 0, 0
+		if err := m.db.SaveReembedJob(job); err != nil {
+			log.Printf("Error saving reembed job: %v", err)
+		}
+		return report, fmt.Errorf(
+			"verification failed: %s has %d memories (%d skipped) but %s has %d, the active collection was not changed. "+
+				"Memories may have been added or deleted during the migration: run reembed again",
+			source, report.SourceCount, report.Skipped, target, report.TargetCount)
+	}
+
+	if !opts.NoSwap {
+		// the embedder is stored first, without its API key, and the collection row is the
+		// switch, read by NewMemory
+		stored := EmbedderConfig{Provider: opts.Embedder.Provider, Config: utils.MergeMaps(opts.Embedder.Config, map[string]interface{}{"embedding_dims": dims})}
+		delete(stored.Config, "api_key")
+		embedderJSON, err := json.Marshal(stored)
+		if err != nil {
+			return report, err
+		}
+		if err := m.db.SetSetting(activeEmbedderKey(m.collectionName), string(embedderJSON)); err != nil {
+			return report, err
+		}
+		if err := m.db.SetSetting(activeCollectionKey(m.collectionName), target); err != nil {
+			return report, err
+		}
+		m.vectorStore = targetStore
+		m.embeddingModel = embedder
+		m.config.Embedder = opts.Embedder
+		m.config.VectorStore.Config = targetConfig
+		report.Swapped = true
+	}
+
+	job.Status = sqlitemanager.ReembedDone
+	if err := m.db.SaveReembedJob(job); err != nil {
+		return report, err
+	}
+	return report, nil
+}
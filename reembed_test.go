@@ -0,0 +1,38 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveReembedded(t *testing.T) {
+	db, err := sqlitemanager.NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+	config := NewMemoryConfig()
+	config.Embedder = EmbedderConfig{Provider: "ollama", Config: map[string]interface{}{"model": "nomic-embed-text", "ollama_base_url": "http://ollama:11434"}}
+	config.VectorStore.Config = map[string]interface{}{"collection_name": "memGo", "embedding_model_dims": 768}
+
+	resolved, err := resolveReembedded(db, config)
+	assert.NoError(t, err)
+	assert.Equal(t, config, resolved)
+
+	// as stored by Reembed
+	assert.NoError(t, db.SetSetting(activeEmbedderKey("memGo"), `{"provider": "ollama", "config": {"model": "mxbai-embed-large", "embedding_dims": 1024}}`))
+	assert.NoError(t, db.SetSetting(activeCollectionKey("memGo"), "memGo_mxbai-embed-large"))
+	resolved, err = resolveReembedded(db, config)
+	assert.NoError(t, err)
+	assert.Equal(t, "mxbai-embed-large", resolved.Embedder.Model())
+	assert.Equal(t, "http://ollama:11434", resolved.Embedder.Config["ollama_base_url"])
+	assert.Equal(t, "memGo_mxbai-embed-large", resolved.VectorStore.Config["collection_name"])
+	dims, _ := configInt(resolved.VectorStore.Config, "embedding_model_dims")
+	assert.Equal(t, 1024, dims)
+
+	// a Memory created before the swap can't write anymore
+	stale := &Memory{config: config, db: db, collectionName: "memGo"}
+	assert.ErrorIs(t, stale.checkActiveCollection(), ErrCollectionReplaced)
+	current := &Memory{config: resolved, db: db, collectionName: "memGo"}
+	assert.NoError(t, current.checkActiveCollection())
+}
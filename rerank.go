@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// RerankConfig - the optional rerank stage of Memory.Search
+type RerankConfig struct {
+	Enabled        bool    `json:"enabled"`                      // rerank every search, otherwise only the ones of WithRerank
+	Provider       string  `json:"provider" default:"llm"`       // llm (the configured LLM) or endpoint
+	Endpoint       string  `json:"endpoint,omitempty"`           // rerank API of a local model for the endpoint provider
+	Model          string  `json:"model,omitempty"`              // defaults to the LLM model for llm
+	Candidates     int     `json:"candidates" default:"20"`      // results fetched by similarity and reranked
+	Cutoff         float64 `json:"cutoff"`                       // minimum rerank score, from 0 to 1
+	TimeoutSeconds int     `json:"timeout_seconds" default:"30"` // per rerank call
+}
+
+// RerankOptions - rerank settings of a single search, zero values use the rerank config
+type RerankOptions struct {
+	Provider   string
+	Model      string
+	Candidates int
+	Cutoff     float64
+}
+
+func (rc RerankConfig) validate() []error {
+	errs := []error{}
+	switch rc.Provider {
+	case "llm":
+	case "endpoint":
+		if u, err := url.Parse(rc.Endpoint); rc.Endpoint != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https")) {
+			errs = append(errs, errors.New("rerank.endpoint must be an http or https URL"))
+		}
+		if rc.Enabled && rc.Endpoint == "" {
+			errs = append(errs, errors.New("rerank.endpoint is required by the endpoint provider"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unsupported rerank provider: %s", rc.Provider))
+	}
+	if rc.Candidates < 1 {
+		errs = append(errs, errors.New("rerank.candidates must be at least 1"))
+	}
+	if rc.Cutoff < 0 || rc.Cutoff > 1 {
+		errs = append(errs, errors.New("rerank.cutoff must be between 0 and 1"))
+	}
+	return errs
+}
+
+// WithRerank returns a copy of the Memory whose Search reranks its results with opts
+func (m *Memory) WithRerank(opts RerankOptions) *Memory {
+	scoped := *m
+	scoped.rerank = &opts
+	return &scoped
+}
+
+// rerankSettings returns the rerank settings of Search, nil when it doesn't rerank
+func (m *Memory) rerankSettings() *RerankConfig {
+	if m.rerank == nil && !m.config.Rerank.Enabled {
+		return nil
+	}
+	settings := m.config.Rerank
+	if settings.Provider == "" {
+		settings.Provider = "llm"
+	}
+	if settings.Candidates <= 0 {
+		settings.Candidates = 20
+	}
+	if opts := m.rerank; opts != nil {
+		if opts.Provider != "" {
+			settings.Provider = opts.Provider
+		}
+		if opts.Model != "" {
+			settings.Model = opts.Model
+		}
+		if opts.Candidates > 0 {
+			settings.Candidates = opts.Candidates
+		}
+		if opts.Cutoff > 0 {
+			settings.Cutoff = opts.Cutoff
+		}
+	}
+	return &settings
+}
+
+// validateSearch checks the options of WithFilter and WithRerank, see ErrInvalidSearch
+func (m *Memory) validateSearch() error {
+	if m.filter != nil {
+		if err := m.filter.Validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+		}
+	}
+	if settings := m.rerankSettings(); settings != nil {
+		if errs := settings.validate(); len(errs) > 0 {
+			return fmt.Errorf("%w: %v", ErrInvalidSearch, errors.Join(errs...))
+		}
+	}
+	return nil
+}
+
+// rerankResults scores each memory against query, drops the ones below the cutoff and
+// returns up to limit of them by score. The scores replace "score", which is kept as
+// "vector_score".
+func (m *Memory) rerankResults(query string, memories []map[string]interface{}, limit int, settings RerankConfig, scope map[string]interface{}) ([]map[string]interface{}, error) {
+	if len(memories) == 0 {
+		return memories, nil
+	}
+	documents := make([]string, len(memories))
+	for i, memory := range memories {
+		documents[i] = fmt.Sprint(memory["memory"])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(max(settings.TimeoutSeconds, 1))*time.Second)
+	defer cancel()
+	var scores []float64
+	var err error
+	if settings.Provider == "endpoint" {
+		scores, err = rerankEndpoint(ctx, settings, query, documents)
+	} else {
+		scores, err = m.rerankLLM(ctx, settings.Model, query, documents, scope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reranking search results: %w", err)
+	}
+
+	reranked := []map[string]interface{}{}
+	for i, memory := range memories {
+		if scores[i] < settings.Cutoff {
+			continue
+		}
+		memory["vector_score"] = memory["score"]
+		memory["score"] = scores[i]
+		reranked = append(reranked, memory)
+	}
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return reranked[i]["score"].(float64) > reranked[j]["score"].(float64)
+	})
+	if len(reranked) > limit {
+		reranked = reranked[:limit]
+	}
+	return reranked, nil
+}
+
+// rerankPrompt asks the LLM to judge every document against the query, like a cross-encoder
+const rerankPrompt = `You are a relevance judge for a memory retrieval system.
+Rate how relevant each memory is to the query, independently of the others, from 0 to 10:
+10 the memory directly answers or is exactly about the query, 5 it is related but doesn't answer it,
+0 it is unrelated. Answer only with JSON: {"scores": [{"index": <memory number>, "score": <0-10>}, ...]}
+with one entry per memory.`
+
+var rerankJSON = regexp.MustCompile(`(?s)\{.*\}`)
+
+// rerankLLM scores the documents with the configured LLM, or with model of the same provider.
+// The 0 to 10 grades are calibrated to 0 to 1; documents the LLM skips score 0.
+func (m *Memory) rerankLLM(ctx context.Context, model string, query string, documents []string, scope map[string]interface{}) ([]float64, error) {
+	scorer := m
+	if model != "" {
+		config := map[string]interface{}{}
+		for k, v := range m.config.Llm.Config {
+			config[k] = v
+		}
+		config["model"] = model
+		llm, err := LlmFactory{}.Create(m.config.Llm.Provider, config)
+		if err != nil {
+			return nil, err
+		}
+		scoped := *m
+		scoped.llm = llm
+		scorer = &scoped
+	}
+
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Query: %s\n\nMemories:\n", query)
+	for i, document := range documents {
+		fmt.Fprintf(&prompt, "[%d] %s\n", i+1, document)
+	}
+	messages := []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, rerankPrompt),
+		llms.TextParts(llms.ChatMessageTypeHuman, prompt.String()),
+	}
+	answer, err := scorer.generate(ctx, messages, nil, "rerank", scope)
+	if err != nil {
+		return nil, err
+	}
+
+	var graded struct {
+		Scores []struct {
+			Index int     `json:"index"`
+			Score float64 `json:"score"`
+		} `json:"scores"`
+	}
+	if err := json.Unmarshal([]byte(rerankJSON.FindString(answer.Content)), &graded); err != nil {
+		return nil, fmt.Errorf("invalid rerank answer: %w", err)
+	}
+	scores := make([]float64, len(documents))
+	for _, grade := range graded.Scores {
+		if grade.Index >= 1 && grade.Index <= len(documents) {
+			scores[grade.Index-1] = math.Min(math.Max(grade.Score, 0), 10) / 10
+		}
+	}
+	return scores, nil
+}
+
+// rerankEndpoint scores the documents with a rerank API as served by local rerank models
+// (Infinity, vLLM, text-embeddings-inference, Jina or Cohere compatible): the query and
+// documents are POSTed and results of index and relevance_score (or score) are read.
+// Scores outside 0 to 1, i.e. logits, are calibrated with a sigmoid.
+func rerankEndpoint(ctx context.Context, settings RerankConfig, query string, documents []string) ([]float64, error) {
+	if settings.Endpoint == "" {
+		return nil, errors.New("rerank.endpoint is not configured")
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":     settings.Model,
+		"query":     query,
+		"documents": documents,
+		"top_n":     len(documents),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, settings.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("rerank endpoint answered %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	type result struct {
+		Index          int      `json:"index"`
+		RelevanceScore *float64 `json:"relevance_score"`
+		Score          *float64 `json:"score"`
+	}
+	var results []result
+	var wrapped struct {
+		Results []result `json:"results"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err == nil && wrapped.Results != nil {
+		results = wrapped.Results
+	} else if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("invalid rerank endpoint answer: %w", err)
+	}
+
+	raw := make([]float64, len(documents))
+	ranked := make([]bool, len(documents))
+	calibrate := false
+	for _, r := range results {
+		if r.Index < 0 || r.Index >= len(documents) {
+			continue
+		}
+		ranked[r.Index] = true
+		score := 0.0
+		if r.RelevanceScore != nil {
+			score = *r.RelevanceScore
+		} else if r.Score != nil {
+			score = *r.Score
+		}
+		raw[r.Index] = score
+		calibrate = calibrate || score < 0 || score > 1
+	}
+	if calibrate {
+		for i, score := range raw {
+			if ranked[i] {
+				raw[i] = 1 / (1 + math.Exp(-score))
+			}
+		}
+	}
+	return raw, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/matigumma/memGo/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// gradingLLM answers every prompt with the same text
+type gradingLLM struct{ answer string }
+
+func (g gradingLLM) GenerateResponse(messages []llms.MessageContent, tools []models.Tool, jsonMode bool, toolChoice string) (interface{}, error) {
+	return g.answer, nil
+}
+
+func TestRerankResults(t *testing.T) {
+	config := NewMemoryConfig()
+	config.Usage.Enabled = false
+	m := &Memory{config: config, llm: gradingLLM{`Sure: {"scores": [{"index": 1, "score": 2}, {"index": 2, "score": 9}, {"index": 3, "score": 5}]}`}}
+	memories := []map[string]interface{}{
+		{"id": "a", "memory": "likes coffee", "score": 0.91},
+		{"id": "b", "memory": "phone is 11 5555-1234", "score": 0.85},
+		{"id": "c", "memory": "lives in Rosario", "score": 0.84},
+	}
+
+	settings := *m.WithRerank(RerankOptions{Cutoff: 0.3}).rerankSettings()
+	reranked, err := m.rerankResults("what is the phone number?", memories, 5, settings, nil)
+	assert.NoError(t, err)
+	assert.Len(t, reranked, 2)
+	assert.Equal(t, "b", reranked[0]["id"])
+	assert.Equal(t, 0.9, reranked[0]["score"])
+	assert.Equal(t, 0.85, reranked[0]["vector_score"])
+	assert.Equal(t, "c", reranked[1]["id"])
+
+	// logits of a local rerank model are calibrated with a sigmoid
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"index": 1, "relevance_score": 4.2}, {"index": 0, "relevance_score": -3.1}]}`))
+	}))
+	defer server.Close()
+	scores, err := rerankEndpoint(context.Background(), RerankConfig{Endpoint: server.URL}, "phone", []string{"coffee", "phone", "Rosario"})
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.985, scores[1], 0.001)
+	assert.InDelta(t, 0.043, scores[0], 0.001)
+	assert.Equal(t, 0.0, scores[2])
+}
+
+func TestValidateSearch(t *testing.T) {
+	config := NewMemoryConfig()
+	m := &Memory{config: config}
+	assert.NoError(t, m.validateSearch())
+	assert.NoError(t, m.WithRerank(RerankOptions{Cutoff: 0.5}).validateSearch())
+	assert.ErrorIs(t, m.WithRerank(RerankOptions{Provider: "bogus"}).validateSearch(), ErrInvalidSearch)
+	assert.ErrorIs(t, m.WithRerank(RerankOptions{Cutoff: 2}).validateSearch(), ErrInvalidSearch)
+	assert.ErrorIs(t, m.WithFilter(&Filter{Field: "tags"}).validateSearch(), ErrInvalidSearch)
+
+	_, err := m.HybridSearch("coffee", nil, nil, nil, 5, nil, HybridOptions{VectorWeight: -1})
+	assert.ErrorIs(t, err, ErrInvalidSearch)
+
+	for err, status := range map[error]int{
+		fmt.Errorf("%w: bad weights", ErrInvalidSearch): http.StatusBadRequest,
+		&QuotaExceededError{Key: "user:u"}:              http.StatusTooManyRequests,
+		errors.New("qdrant is down"):                    http.StatusInternalServerError,
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		respondMemoryError(c, err)
+		assert.Equal(t, status, w.Code, err.Error())
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// scopeLocks - the locks serializing the writes to the memories of a scope. Add searches the
+// neighbours of a fact with its user_id, agent_id and run_id as filters and then updates or
+// deletes them, so a write holds the lock of every memory the search can return: the user's
+// when user_id is set, shared with the other users of the tenant, otherwise the whole tenant.
+// Writes to different users still run in parallel.
+type scopeLocks struct {
+	mu    sync.Mutex
+	locks map[string]*scopeLock
+}
+
+type scopeLock struct {
+	sync.RWMutex
+	refs int // holders and waiters, the entry is removed at 0
+}
+
+func newScopeLocks() *scopeLocks {
+	return &scopeLocks{locks: map[string]*scopeLock{}}
+}
+
+// lock blocks until the key is free and returns the function releasing it
+func (sl *scopeLocks) lock(key string) func() {
+	return sl.acquire(key, false)
+}
+
+// rlock blocks until no lock holds the key, it is shared with other rlocks
+func (sl *scopeLocks) rlock(key string) func() {
+	return sl.acquire(key, true)
+}
+
+func (sl *scopeLocks) acquire(key string, shared bool) func() {
+	sl.mu.Lock()
+	l, ok := sl.locks[key]
+	if !ok {
+		l = &scopeLock{}
+		sl.locks[key] = l
+	}
+	l.refs++
+	sl.mu.Unlock()
+
+	if shared {
+		l.RLock()
+	} else {
+		l.Lock()
+	}
+	return func() {
+		if shared {
+			l.RUnlock()
+		} else {
+			l.Unlock()
+		}
+		sl.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(sl.locks, key)
+		}
+		sl.mu.Unlock()
+	}
+}
+
+// scopeKey identifies the (tenant, user_id, agent_id, run_id) scope of a metadata, filters or payload map
+func scopeKey(scope map[string]interface{}) string {
+	parts := make([]string, 0, 4)
+	for _, key := range []string{"tenant_id", "user_id", "agent_id", "run_id"} {
+		value := ""
+		if v, ok := scope[key]; ok && v != nil {
+			value = fmt.Sprint(v)
+		}
+		parts = append(parts, value)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// lockKeys returns the lock of the tenant of a scope map, and of its user when user_id is set
+func lockKeys(scope map[string]interface{}) (tenant string, user string) {
+	tenant = "tenant\x00"
+	if v, ok := scope["tenant_id"]; ok && v != nil {
+		tenant += fmt.Sprint(v)
+	}
+	if userID, _, _ := scopeFromMap(scope); userID != "" {
+		user = "user" + strings.TrimPrefix(tenant, "tenant") + "\x00" + userID
+	}
+	return tenant, user
+}
+
+// lockScope serializes the writes to the scope of a map, see scopeLocks
+func (m *Memory) lockScope(scope map[string]interface{}) func() {
+	tenant, user := lockKeys(scope)
+	if user == "" {
+		return m.scopeLocks.lock(tenant)
+	}
+	unlockTenant := m.scopeLocks.rlock(tenant)
+	unlockUser := m.scopeLocks.lock(user)
+	return func() {
+		unlockUser()
+		unlockTenant()
+	}
+}
+
+// lockMemoryScope locks the scope of a stored memory, the unlock is a no-op if the
+// memory can't be read: the write then fails on its own
+func (m *Memory) lockMemoryScope(memoryID string) func() {
+	memory, err := m.vectorStore.Get(memoryID)
+	if err != nil || memory == nil {
+		return func() {}
+	}
+	return m.lockScope(convertQdrantPayload(memory.Payload))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeLocksSerializeSameScope(t *testing.T) {
+	locks := newScopeLocks()
+	_, blas := lockKeys(map[string]interface{}{"user_id": "Blas", "agent_id": "whatsapp"})
+	_, ana := lockKeys(map[string]interface{}{"user_id": "Ana", "agent_id": "whatsapp"})
+	assert.NotEqual(t, blas, ana)
+	_, blasTelegram := lockKeys(map[string]interface{}{"user_id": "Blas", "agent_id": "telegram"})
+	assert.Equal(t, blas, blasTelegram) // Add searches every agent of the user
+
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer locks.lock(blas)()
+			n := atomic.AddInt32(&running, 1)
+			for {
+				prev := atomic.LoadInt32(&maxRunning)
+				if n <= prev || atomic.CompareAndSwapInt32(&maxRunning, prev, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		}()
+	}
+
+	// another scope isn't blocked by the writes to Blas
+	unlockBlas := locks.lock(blas)
+	done := make(chan struct{})
+	go func() {
+		locks.lock(ana)()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lock of another scope blocked")
+	}
+	unlockBlas()
+
+	wg.Wait()
+	assert.Equal(t, int32(1), maxRunning)
+	assert.Empty(t, locks.locks)
+}
+
+func TestLockScopeWithoutUserLocksTenant(t *testing.T) {
+	m := &Memory{scopeLocks: newScopeLocks()}
+	unlockBlas := m.lockScope(map[string]interface{}{"tenant_id": "acme", "user_id": "Blas"})
+	unlockAna := m.lockScope(map[string]interface{}{"tenant_id": "acme", "user_id": "Ana"})
+	unlockOther := m.lockScope(map[string]interface{}{"tenant_id": "globex", "agent_id": "whatsapp"})
+	unlockOther()
+
+	// an add by agent_id alone can touch the memories of any user of the tenant
+	done := make(chan struct{})
+	go func() {
+		m.lockScope(map[string]interface{}{"tenant_id": "acme", "agent_id": "whatsapp"})()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("tenant lock acquired while its users are locked")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlockBlas()
+	unlockAna()
+	<-done
+	assert.Empty(t, m.scopeLocks.locks)
+}
@@ -0,0 +1,89 @@
+package sqlitemanager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MemoryAccess - how often and when a memory was last returned by a search or get
+type MemoryAccess struct {
+	Count        int
+	LastAccessed time.Time
+}
+
+func (sm *SQLiteManager) createAccessTable() error {
+	_, err := sm.db.Exec(`
+		CREATE TABLE IF NOT EXISTS memory_access (
+			memory_id TEXT PRIMARY KEY,
+			access_count INTEGER,
+			last_accessed_at TEXT
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create memory_access table: %w", err)
+	}
+	return nil
+}
+
+// RecordAccess counts an access to each memory at the current time
+func (sm *SQLiteManager) RecordAccess(memoryIDs []string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, memoryID := range memoryIDs {
+		_, err := sm.db.Exec(`
+			INSERT INTO memory_access (memory_id, access_count, last_accessed_at) VALUES (?, 1, ?)
+			ON CONFLICT (memory_id) DO UPDATE SET access_count = access_count + 1, last_accessed_at = excluded.last_accessed_at
+		`, memoryID, now)
+		if err != nil {
+			return fmt.Errorf("failed to record memory access: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetAccess returns the accesses of the memories, those never accessed are missing
+func (sm *SQLiteManager) GetAccess(memoryIDs []string) (map[string]MemoryAccess, error) {
+	accesses := map[string]MemoryAccess{}
+	if len(memoryIDs) == 0 {
+		return accesses, nil
+	}
+	args := make([]interface{}, len(memoryIDs))
+	for i, memoryID := range memoryIDs {
+		args[i] = memoryID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(memoryIDs)), ", ")
+	rows, err := sm.db.Query(`SELECT memory_id, access_count, last_accessed_at FROM memory_access WHERE memory_id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query memory access: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var memoryID, lastAccessed string
+		var access MemoryAccess
+		if err := rows.Scan(&memoryID, &access.Count, &lastAccessed); err != nil {
+			return nil, fmt.Errorf("failed to scan memory access: %w", err)
+		}
+		access.LastAccessed, _ = time.Parse(time.RFC3339, lastAccessed)
+		accesses[memoryID] = access
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading memory access: %w", err)
+	}
+	return accesses, nil
+}
+
+// DeleteAccess forgets the accesses of a memory
+func (sm *SQLiteManager) DeleteAccess(memoryID string) error {
+	if _, err := sm.db.Exec(`DELETE FROM memory_access WHERE memory_id = ?`, memoryID); err != nil {
+		return fmt.Errorf("failed to delete memory access: %w", err)
+	}
+	return nil
+}
+
+// ClearAccess forgets the accesses of every memory
+func (sm *SQLiteManager) ClearAccess() error {
+	if _, err := sm.db.Exec(`DELETE FROM memory_access`); err != nil {
+		return fmt.Errorf("failed to clear memory access: %w", err)
+	}
+	return nil
+}
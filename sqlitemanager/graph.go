@@ -0,0 +1,206 @@
+package sqlitemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GraphScope - the ids a graph query is restricted to, empty fields match any
+type GraphScope = KeywordScope
+
+// GraphEntity - a node of the knowledge graph, deduplicated by the embedding of its name
+type GraphEntity struct {
+	ID        string
+	Name      string
+	Type      string
+	Scope     GraphScope
+	Embedding []float32
+}
+
+// GraphRelation - an entity-relation-entity triple extracted from a memory
+type GraphRelation struct {
+	ID       string `json:"id"`
+	SourceID string `json:"source_id"`
+	Source   string `json:"source"`
+	Relation string `json:"relation"`
+	TargetID string `json:"target_id"`
+	Target   string `json:"target"`
+	MemoryID string `json:"memory_id"`
+	Hops     int    `json:"hops"` // from the entities of GraphNeighbourhood
+}
+
+func (sm *SQLiteManager) createGraphTables() error {
+	_, err := sm.db.Exec(`
+		CREATE TABLE IF NOT EXISTS graph_entities (
+			id TEXT PRIMARY KEY,
+			tenant_id TEXT,
+			user_id TEXT,
+			agent_id TEXT,
+			run_id TEXT,
+			name TEXT,
+			type TEXT,
+			embedding TEXT
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create graph_entities table: %w", err)
+	}
+	_, err = sm.db.Exec(`
+		CREATE TABLE IF NOT EXISTS graph_relations (
+			id TEXT PRIMARY KEY,
+			source_id TEXT,
+			relation TEXT,
+			target_id TEXT,
+			memory_id TEXT,
+			UNIQUE (source_id, relation, target_id, memory_id)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create graph_relations table: %w", err)
+	}
+	for _, column := range []string{"source_id", "target_id", "memory_id"} {
+		_, err = sm.db.Exec(`CREATE INDEX IF NOT EXISTS graph_relations_` + column + ` ON graph_relations (` + column + `)`)
+		if err != nil {
+			return fmt.Errorf("failed to create graph_relations index: %w", err)
+		}
+	}
+	return nil
+}
+
+// AddGraphEntity stores an entity with the embedding of its name
+func (sm *SQLiteManager) AddGraphEntity(entity GraphEntity) error {
+	embedding, err := json.Marshal(entity.Embedding)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entity embedding: %w", err)
+	}
+	_, err = sm.db.Exec(`
+		INSERT INTO graph_entities (id, tenant_id, user_id, agent_id, run_id, name, type, embedding)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, entity.ID, entity.Scope.TenantID, entity.Scope.UserID, entity.Scope.AgentID, entity.Scope.RunID, entity.Name, entity.Type, string(embedding))
+	if err != nil {
+		return fmt.Errorf("failed to insert graph entity: %w", err)
+	}
+	return nil
+}
+
+// GraphEntities returns the entities of scope with their embeddings
+func (sm *SQLiteManager) GraphEntities(scope GraphScope) ([]GraphEntity, error) {
+	where, args := scope.clause()
+	rows, err := sm.db.Query(`
+		SELECT d.id, d.tenant_id, d.user_id, d.agent_id, d.run_id, d.name, d.type, d.embedding
+		FROM graph_entities d WHERE `+where+` ORDER BY d.name, d.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query graph entities: %w", err)
+	}
+	defer rows.Close()
+
+	entities := []GraphEntity{}
+	for rows.Next() {
+		var entity GraphEntity
+		var embedding string
+		if err := rows.Scan(&entity.ID, &entity.Scope.TenantID, &entity.Scope.UserID, &entity.Scope.AgentID, &entity.Scope.RunID, &entity.Name, &entity.Type, &embedding); err != nil {
+			return nil, fmt.Errorf("failed to scan graph entity: %w", err)
+		}
+		if err := json.Unmarshal([]byte(embedding), &entity.Embedding); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal embedding of entity %s: %w", entity.ID, err)
+		}
+		entities = append(entities, entity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading graph entities: %w", err)
+	}
+	return entities, nil
+}
+
+// AddGraphRelation stores a triple, a triple already extracted from the memory is ignored
+func (sm *SQLiteManager) AddGraphRelation(relation GraphRelation) error {
+	_, err := sm.db.Exec(`
+		INSERT OR IGNORE INTO graph_relations (id, source_id, relation, target_id, memory_id) VALUES (?, ?, ?, ?, ?)
+	`, relation.ID, relation.SourceID, relation.Relation, relation.TargetID, relation.MemoryID)
+	if err != nil {
+		return fmt.Errorf("failed to insert graph relation: %w", err)
+	}
+	return nil
+}
+
+// DeleteGraphRelations removes the triples of a memory and the entities left without any
+func (sm *SQLiteManager) DeleteGraphRelations(memoryID string) error {
+	if _, err := sm.db.Exec(`DELETE FROM graph_relations WHERE memory_id = ?`, memoryID); err != nil {
+		return fmt.Errorf("failed to delete graph relations: %w", err)
+	}
+	_, err := sm.db.Exec(`
+		DELETE FROM graph_entities WHERE id NOT IN (
+			SELECT source_id FROM graph_relations UNION SELECT target_id FROM graph_relations
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to delete orphan graph entities: %w", err)
+	}
+	return nil
+}
+
+// ClearGraph empties the knowledge graph
+func (sm *SQLiteManager) ClearGraph() error {
+	if _, err := sm.db.Exec(`DELETE FROM graph_relations`); err != nil {
+		return fmt.Errorf("failed to clear graph relations: %w", err)
+	}
+	if _, err := sm.db.Exec(`DELETE FROM graph_entities`); err != nil {
+		return fmt.Errorf("failed to clear graph entities: %w", err)
+	}
+	return nil
+}
+
+// GraphNeighbourhood returns the triples within depth hops of the entities, nearest first
+func (sm *SQLiteManager) GraphNeighbourhood(entityIDs []string, depth int) ([]GraphRelation, error) {
+	visited := map[string]bool{}
+	for _, id := range entityIDs {
+		visited[id] = true
+	}
+	seen := map[string]bool{}
+	relations := []GraphRelation{}
+	frontier := entityIDs
+	for hops := 1; hops <= depth && len(frontier) > 0; hops++ {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(frontier)), ", ")
+		args := make([]interface{}, 0, 2*len(frontier))
+		for _, id := range frontier {
+			args = append(args, id)
+		}
+		args = append(args, args...)
+		rows, err := sm.db.Query(`
+			SELECT r.id, r.source_id, s.name, r.relation, r.target_id, t.name, r.memory_id
+			FROM graph_relations r
+			JOIN graph_entities s ON s.id = r.source_id
+			JOIN graph_entities t ON t.id = r.target_id
+			WHERE r.source_id IN (`+placeholders+`) OR r.target_id IN (`+placeholders+`)
+			ORDER BY r.memory_id, r.id`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query graph relations: %w", err)
+		}
+		next := []string{}
+		for rows.Next() {
+			relation := GraphRelation{Hops: hops}
+			if err := rows.Scan(&relation.ID, &relation.SourceID, &relation.Source, &relation.Relation, &relation.TargetID, &relation.Target, &relation.MemoryID); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan graph relation: %w", err)
+			}
+			if seen[relation.ID] {
+				continue
+			}
+			seen[relation.ID] = true
+			relations = append(relations, relation)
+			for _, id := range []string{relation.SourceID, relation.TargetID} {
+				if !visited[id] {
+					visited[id] = true
+					next = append(next, id)
+				}
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error reading graph relations: %w", err)
+		}
+		frontier = next
+	}
+	return relations, nil
+}
@@ -0,0 +1,56 @@
+package sqlitemanager
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphNeighbourhood(t *testing.T) {
+	sm, err := NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+
+	blas := GraphScope{UserID: "blas"}
+	for _, entity := range []GraphEntity{
+		{ID: "blas", Name: "Blas", Type: "persona", Scope: blas, Embedding: []float32{1, 0}},
+		{ID: "itr", Name: "ITR", Type: "organizacion", Scope: blas, Embedding: []float32{0, 1}},
+		{ID: "chatbot", Name: "chatbot de WhatsApp", Type: "proyecto", Scope: blas},
+		{ID: "other", Name: "ITR", Scope: GraphScope{UserID: "other"}},
+	} {
+		assert.NoError(t, sm.AddGraphEntity(entity))
+	}
+	assert.NoError(t, sm.AddGraphRelation(GraphRelation{ID: "r1", SourceID: "blas", Relation: "trabaja_en", TargetID: "itr", MemoryID: "m1"}))
+	assert.NoError(t, sm.AddGraphRelation(GraphRelation{ID: "r1b", SourceID: "blas", Relation: "trabaja_en", TargetID: "itr", MemoryID: "m1"})) // same triple
+	assert.NoError(t, sm.AddGraphRelation(GraphRelation{ID: "r2", SourceID: "itr", Relation: "desarrolla", TargetID: "chatbot", MemoryID: "m2"}))
+
+	entities, err := sm.GraphEntities(blas)
+	assert.NoError(t, err)
+	assert.Len(t, entities, 3)
+	assert.Equal(t, []float32{1, 0}, entities[0].Embedding)
+
+	relations, err := sm.GraphNeighbourhood([]string{"blas"}, 1)
+	assert.NoError(t, err)
+	assert.Len(t, relations, 1)
+	assert.Equal(t, GraphRelation{ID: "r1", SourceID: "blas", Source: "Blas", Relation: "trabaja_en", TargetID: "itr", Target: "ITR", MemoryID: "m1", Hops: 1}, relations[0])
+
+	relations, err = sm.GraphNeighbourhood([]string{"blas"}, 2)
+	assert.NoError(t, err)
+	assert.Len(t, relations, 2)
+	assert.Equal(t, "m2", relations[1].MemoryID)
+	assert.Equal(t, 2, relations[1].Hops)
+
+	// the entities only related by m2 go with it
+	assert.NoError(t, sm.DeleteGraphRelations("m2"))
+	entities, err = sm.GraphEntities(GraphScope{})
+	assert.NoError(t, err)
+	assert.Len(t, entities, 2)
+	relations, err = sm.GraphNeighbourhood([]string{"itr"}, 2)
+	assert.NoError(t, err)
+	assert.Len(t, relations, 1)
+
+	assert.NoError(t, sm.ClearGraph())
+	entities, err = sm.GraphEntities(GraphScope{})
+	assert.NoError(t, err)
+	assert.Empty(t, entities)
+}
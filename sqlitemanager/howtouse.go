@@ -12,7 +12,7 @@ func main() {
 	defer sqlManager.db.Close()
 
 	// Add history
-	err = sqlManager.AddHistory("memory123", nil, "New memory data", "ADD", nil, nil, 0)
+	err = sqlManager.AddHistory("memory123", "", nil, "New memory data", "ADD", nil, nil, 0)
 	if err != nil {
 		log.Printf("Error adding history: %v", err)
 	}
@@ -0,0 +1,155 @@
+package sqlitemanager
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Status of an ingestion and of its windows
+const (
+	IngestRunning = "running"
+	IngestPaused  = "paused"
+	IngestDone    = "done"
+	IngestFailed  = "failed"
+)
+
+// IngestStatus - progress of the ingestion of a conversation archive
+type IngestStatus struct {
+	Source      string `json:"source"`
+	Fingerprint string `json:"-"`
+	Status      string `json:"status"`
+	Messages    int    `json:"messages"`
+	Windows     int    `json:"windows"`
+	Done        int    `json:"done"`   // windows added to the memory
+	Failed      int    `json:"failed"` // windows retried on the next run
+	StartedAt   string `json:"started_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+func (sm *SQLiteManager) createIngestTables() error {
+	_, err := sm.db.Exec(`
+		CREATE TABLE IF NOT EXISTS ingest_sources (
+			source TEXT PRIMARY KEY,
+			fingerprint TEXT,
+			status TEXT,
+			messages INTEGER,
+			windows INTEGER,
+			started_at DATETIME,
+			updated_at DATETIME
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create ingest_sources table: %w", err)
+	}
+	_, err = sm.db.Exec(`
+		CREATE TABLE IF NOT EXISTS ingest_windows (
+			source TEXT,
+			window_index INTEGER,
+			status TEXT,
+			error TEXT,
+			updated_at DATETIME,
+			PRIMARY KEY (source, window_index)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create ingest_windows table: %w", err)
+	}
+	return nil
+}
+
+// StartIngest registers a run of the ingestion of source and returns the windows already
+// done by previous runs. The fingerprint identifies the archive and windowing options:
+// a checkpoint with another fingerprint can't be resumed.
+func (sm *SQLiteManager) StartIngest(source string, fingerprint string, messages int, windows int) (map[int]bool, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	status, err := sm.GetIngest(source)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		_, err = sm.db.Exec(`
+			INSERT INTO ingest_sources (source, fingerprint, status, messages, windows, started_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, source, fingerprint, IngestRunning, messages, windows, now, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ingest checkpoint: %w", err)
+		}
+		return map[int]bool{}, nil
+	}
+	if status.Fingerprint != fingerprint {
+		return nil, fmt.Errorf("the checkpoint of %s was created for another archive or other window options, restart it or use another source name", source)
+	}
+	if err := sm.SetIngestStatus(source, IngestRunning); err != nil {
+		return nil, err
+	}
+
+	rows, err := sm.db.Query(`SELECT window_index FROM ingest_windows WHERE source = ? AND status = ?`, source, IngestDone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ingest windows: %w", err)
+	}
+	defer rows.Close()
+	done := map[int]bool{}
+	for rows.Next() {
+		var window int
+		if err := rows.Scan(&window); err != nil {
+			return nil, fmt.Errorf("failed to scan ingest window: %w", err)
+		}
+		done[window] = true
+	}
+	return done, rows.Err()
+}
+
+// MarkIngestWindow records the outcome of a window, IngestDone or IngestFailed with its error
+func (sm *SQLiteManager) MarkIngestWindow(source string, window int, status string, errMsg string) error {
+	_, err := sm.db.Exec(`
+		INSERT INTO ingest_windows (source, window_index, status, error, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (source, window_index) DO UPDATE SET status = excluded.status, error = excluded.error, updated_at = excluded.updated_at
+	`, source, window, status, errMsg, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to mark ingest window: %w", err)
+	}
+	return nil
+}
+
+// SetIngestStatus updates the status of an ingestion
+func (sm *SQLiteManager) SetIngestStatus(source string, status string) error {
+	_, err := sm.db.Exec(`UPDATE ingest_sources SET status = ?, updated_at = ? WHERE source = ?`,
+		status, time.Now().UTC().Format(time.RFC3339), source)
+	if err != nil {
+		return fmt.Errorf("failed to update ingest status: %w", err)
+	}
+	return nil
+}
+
+// GetIngest returns the progress of the ingestion of source, nil if it never started
+func (sm *SQLiteManager) GetIngest(source string) (*IngestStatus, error) {
+	status := &IngestStatus{}
+	err := sm.db.QueryRow(`
+		SELECT s.source, s.fingerprint, s.status, s.messages, s.windows, s.started_at, s.updated_at,
+			(SELECT COUNT(*) FROM ingest_windows w WHERE w.source = s.source AND w.status = ?),
+			(SELECT COUNT(*) FROM ingest_windows w WHERE w.source = s.source AND w.status = ?)
+		FROM ingest_sources s WHERE s.source = ?
+	`, IngestDone, IngestFailed, source).Scan(
+		&status.Source, &status.Fingerprint, &status.Status, &status.Messages, &status.Windows,
+		&status.StartedAt, &status.UpdatedAt, &status.Done, &status.Failed,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ingest status: %w", err)
+	}
+	return status, nil
+}
+
+// DeleteIngest removes the checkpoint of source so the next run starts over
+func (sm *SQLiteManager) DeleteIngest(source string) error {
+	if _, err := sm.db.Exec(`DELETE FROM ingest_windows WHERE source = ?`, source); err != nil {
+		return fmt.Errorf("failed to delete ingest windows: %w", err)
+	}
+	if _, err := sm.db.Exec(`DELETE FROM ingest_sources WHERE source = ?`, source); err != nil {
+		return fmt.Errorf("failed to delete ingest checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package sqlitemanager
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Status of a background job
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// queueTime - fixed width UTC timestamps of the queues, so they compare as strings
+const queueTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// Job - a unit of background work, e.g. an asynchronous Memory.Add
+type Job struct {
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	Tenant     string `json:"-"`
+	Status     string `json:"status"`
+	Payload    string `json:"-"`                // JSON arguments of the job
+	Result     string `json:"result,omitempty"` // JSON result, set when succeeded
+	Error      string `json:"error,omitempty"`
+	Attempts   int    `json:"attempts"`
+	CreatedAt  string `json:"created_at"`
+	StartedAt  string `json:"started_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
+}
+
+func (sm *SQLiteManager) createJobsTable() error {
+	_, err := sm.db.Exec(`
+		CREATE TABLE IF NOT EXISTS jobs (
+			id TEXT PRIMARY KEY,
+			kind TEXT,
+			tenant TEXT,
+			status TEXT,
+			payload TEXT,
+			result TEXT,
+			error TEXT,
+			attempts INTEGER DEFAULT 0,
+			run_after DATETIME,
+			created_at DATETIME,
+			started_at DATETIME,
+			finished_at DATETIME
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create jobs table: %w", err)
+	}
+	_, err = sm.db.Exec(`CREATE INDEX IF NOT EXISTS jobs_queue ON jobs (status, run_after)`)
+	if err != nil {
+		return fmt.Errorf("failed to create jobs index: %w", err)
+	}
+	return nil
+}
+
+const jobColumns = `id, kind, tenant, status, payload, COALESCE(result, ''), COALESCE(error, ''), attempts,
+	created_at, COALESCE(started_at, ''), COALESCE(finished_at, '')`
+
+func scanJob(row interface{ Scan(...interface{}) error }) (*Job, error) {
+	job := &Job{}
+	err := row.Scan(&job.ID, &job.Kind, &job.Tenant, &job.Status, &job.Payload, &job.Result, &job.Error,
+		&job.Attempts, &job.CreatedAt, &job.StartedAt, &job.FinishedAt)
+	return job, err
+}
+
+// EnqueueJob stores a queued job of kind with its JSON payload and returns it
+func (sm *SQLiteManager) EnqueueJob(kind string, tenant string, payload string) (*Job, error) {
+	now := time.Now().UTC().Format(queueTime)
+	job := &Job{ID: uuid.New().String(), Kind: kind, Tenant: tenant, Status: JobQueued, Payload: payload, CreatedAt: now}
+	_, err := sm.db.Exec(`
+		INSERT INTO jobs (id, kind, tenant, status, payload, attempts, run_after, created_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?)
+	`, job.ID, kind, tenant, JobQueued, payload, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return job, nil
+}
+
+// ClaimJob marks the oldest queued job that is due as running and returns it, nil if there is none
+func (sm *SQLiteManager) ClaimJob() (*Job, error) {
+	now := time.Now().UTC().Format(queueTime)
+	job, err := scanJob(sm.db.QueryRow(`
+		UPDATE jobs SET status = ?, attempts = attempts + 1, started_at = ?
+		WHERE id = (SELECT id FROM jobs WHERE status = ? AND run_after <= ? ORDER BY created_at LIMIT 1)
+		RETURNING `+jobColumns,
+		JobRunning, now, JobQueued, now))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return job, nil
+}
+
+// CompleteJob marks a job as succeeded with its JSON result
+func (sm *SQLiteManager) CompleteJob(id string, result string) error {
+	_, err := sm.db.Exec(`UPDATE jobs SET status = ?, result = ?, error = NULL, finished_at = ? WHERE id = ?`,
+		JobSucceeded, result, time.Now().UTC().Format(queueTime), id)
+	if err != nil {
+		return fmt.Errorf("failed to complete job: %w", err)
+	}
+	return nil
+}
+
+// FailJob records the error of a job attempt. With retryAfter > 0 the job is queued
+// again to run after that delay, otherwise it is marked as failed.
+func (sm *SQLiteManager) FailJob(id string, errMsg string, retryAfter time.Duration) error {
+	now := time.Now().UTC()
+	var err error
+	if retryAfter > 0 {
+		_, err = sm.db.Exec(`UPDATE jobs SET status = ?, error = ?, run_after = ? WHERE id = ?`,
+			JobQueued, errMsg, now.Add(retryAfter).Format(queueTime), id)
+	} else {
+		_, err = sm.db.Exec(`UPDATE jobs SET status = ?, error = ?, finished_at = ? WHERE id = ?`,
+			JobFailed, errMsg, now.Format(queueTime), id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fail job: %w", err)
+	}
+	return nil
+}
+
+// RequeueRunningJobs queues again the jobs left running by a stopped process, returns how many
+func (sm *SQLiteManager) RequeueRunningJobs() (int, error) {
+	res, err := sm.db.Exec(`UPDATE jobs SET status = ? WHERE status = ?`, JobQueued, JobRunning)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue jobs: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// GetJob returns a job by id, nil if it doesn't exist
+func (sm *SQLiteManager) GetJob(id string) (*Job, error) {
+	job, err := scanJob(sm.db.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return job, nil
+}
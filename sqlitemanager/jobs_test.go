@@ -0,0 +1,42 @@
+package sqlitemanager
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobQueue(t *testing.T) {
+	sm, err := NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+
+	queued, err := sm.EnqueueJob("add", "acme", `{"text":"hola"}`)
+	assert.NoError(t, err)
+
+	job, err := sm.ClaimJob()
+	assert.NoError(t, err)
+	assert.Equal(t, queued.ID, job.ID)
+	assert.Equal(t, JobRunning, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.Equal(t, "acme", job.Tenant)
+
+	// nothing else is due
+	none, err := sm.ClaimJob()
+	assert.NoError(t, err)
+	assert.Nil(t, none)
+
+	// a retry is not claimed before its delay
+	assert.NoError(t, sm.FailJob(job.ID, "timeout", time.Hour))
+	none, err = sm.ClaimJob()
+	assert.NoError(t, err)
+	assert.Nil(t, none)
+
+	assert.NoError(t, sm.CompleteJob(job.ID, `{"message":"ok"}`))
+	done, err := sm.GetJob(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, JobSucceeded, done.Status)
+	assert.Equal(t, `{"message":"ok"}`, done.Result)
+	assert.Empty(t, done.Error)
+}
@@ -0,0 +1,203 @@
+package sqlitemanager
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// KeywordScope - the ids a keyword search is restricted to, empty fields match any
+type KeywordScope struct {
+	TenantID string
+	UserID   string
+	AgentID  string
+	RunID    string
+}
+
+// KeywordHit - a memory matching a keyword search with its BM25 score
+type KeywordHit struct {
+	MemoryID string
+	Score    float64
+}
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+func (sm *SQLiteManager) createKeywordTables() error {
+	_, err := sm.db.Exec(`
+		CREATE TABLE IF NOT EXISTS keyword_docs (
+			memory_id TEXT PRIMARY KEY,
+			tenant_id TEXT,
+			user_id TEXT,
+			agent_id TEXT,
+			run_id TEXT,
+			length INTEGER
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create keyword_docs table: %w", err)
+	}
+	_, err = sm.db.Exec(`
+		CREATE TABLE IF NOT EXISTS keyword_terms (
+			term TEXT,
+			memory_id TEXT,
+			tf INTEGER,
+			PRIMARY KEY (term, memory_id)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create keyword_terms table: %w", err)
+	}
+	_, err = sm.db.Exec(`CREATE INDEX IF NOT EXISTS keyword_terms_memory ON keyword_terms (memory_id)`)
+	if err != nil {
+		return fmt.Errorf("failed to create keyword_terms index: %w", err)
+	}
+	return nil
+}
+
+// IndexKeywords replaces the terms of a memory in the inverted index. terms maps each
+// term to its frequency in the memory.
+func (sm *SQLiteManager) IndexKeywords(memoryID string, scope KeywordScope, terms map[string]int) error {
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin keyword transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM keyword_terms WHERE memory_id = ?`, memoryID); err != nil {
+		return fmt.Errorf("failed to delete keyword terms: %w", err)
+	}
+	length := 0
+	for term, tf := range terms {
+		length += tf
+		if _, err := tx.Exec(`INSERT INTO keyword_terms (term, memory_id, tf) VALUES (?, ?, ?)`, term, memoryID, tf); err != nil {
+			return fmt.Errorf("failed to insert keyword term: %w", err)
+		}
+	}
+	_, err = tx.Exec(`
+		INSERT INTO keyword_docs (memory_id, tenant_id, user_id, agent_id, run_id, length) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (memory_id) DO UPDATE SET tenant_id = excluded.tenant_id, user_id = excluded.user_id,
+			agent_id = excluded.agent_id, run_id = excluded.run_id, length = excluded.length
+	`, memoryID, scope.TenantID, scope.UserID, scope.AgentID, scope.RunID, length)
+	if err != nil {
+		return fmt.Errorf("failed to index keyword document: %w", err)
+	}
+	return tx.Commit()
+}
+
+// DeleteKeywords removes a memory from the inverted index
+func (sm *SQLiteManager) DeleteKeywords(memoryID string) error {
+	if _, err := sm.db.Exec(`DELETE FROM keyword_terms WHERE memory_id = ?`, memoryID); err != nil {
+		return fmt.Errorf("failed to delete keyword terms: %w", err)
+	}
+	if _, err := sm.db.Exec(`DELETE FROM keyword_docs WHERE memory_id = ?`, memoryID); err != nil {
+		return fmt.Errorf("failed to delete keyword document: %w", err)
+	}
+	return nil
+}
+
+// ClearKeywords empties the inverted index
+func (sm *SQLiteManager) ClearKeywords() error {
+	if _, err := sm.db.Exec(`DELETE FROM keyword_terms`); err != nil {
+		return fmt.Errorf("failed to clear keyword terms: %w", err)
+	}
+	if _, err := sm.db.Exec(`DELETE FROM keyword_docs`); err != nil {
+		return fmt.Errorf("failed to clear keyword documents: %w", err)
+	}
+	return nil
+}
+
+// clause returns the WHERE conditions on keyword_docs d for the scope and their arguments
+func (scope KeywordScope) clause() (string, []interface{}) {
+	conditions := []string{"1 = 1"}
+	args := []interface{}{}
+	for column, value := range map[string]string{"tenant_id": scope.TenantID, "user_id": scope.UserID, "agent_id": scope.AgentID, "run_id": scope.RunID} {
+		if value != "" {
+			conditions = append(conditions, "d."+column+" = ?")
+			args = append(args, value)
+		}
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// KeywordSearch returns up to limit memories of scope containing any of terms, ranked by
+// BM25. The document frequencies and average length are those of the scope.
+func (sm *SQLiteManager) KeywordSearch(terms []string, scope KeywordScope, limit int) ([]KeywordHit, error) {
+	if len(terms) == 0 {
+		return []KeywordHit{}, nil
+	}
+	where, scopeArgs := scope.clause()
+
+	var docs int
+	var avgLength float64
+	err := sm.db.QueryRow(`SELECT COUNT(*), COALESCE(AVG(d.length), 0) FROM keyword_docs d WHERE `+where, scopeArgs...).Scan(&docs, &avgLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyword statistics: %w", err)
+	}
+	if docs == 0 {
+		return []KeywordHit{}, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(terms)), ", ")
+	args := []interface{}{}
+	for _, term := range terms {
+		args = append(args, term)
+	}
+	args = append(args, scopeArgs...)
+	rows, err := sm.db.Query(`
+		SELECT t.memory_id, t.term, t.tf, d.length
+		FROM keyword_terms t JOIN keyword_docs d ON d.memory_id = t.memory_id
+		WHERE t.term IN (`+placeholders+`) AND `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query keyword terms: %w", err)
+	}
+	defer rows.Close()
+
+	type posting struct {
+		memoryID string
+		tf       int
+		length   int
+	}
+	postings := map[string][]posting{}
+	for rows.Next() {
+		var p posting
+		var term string
+		if err := rows.Scan(&p.memoryID, &term, &p.tf, &p.length); err != nil {
+			return nil, fmt.Errorf("failed to scan keyword term: %w", err)
+		}
+		postings[term] = append(postings[term], p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading keyword terms: %w", err)
+	}
+
+	scores := map[string]float64{}
+	for _, list := range postings {
+		df := float64(len(list))
+		idf := math.Log(1 + (float64(docs)-df+0.5)/(df+0.5))
+		for _, p := range list {
+			tf := float64(p.tf)
+			norm := 1 - bm25B + bm25B*float64(p.length)/math.Max(avgLength, 1)
+			scores[p.memoryID] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+
+	hits := make([]KeywordHit, 0, len(scores))
+	for memoryID, score := range scores {
+		hits = append(hits, KeywordHit{MemoryID: memoryID, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].MemoryID < hits[j].MemoryID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
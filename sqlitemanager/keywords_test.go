@@ -0,0 +1,36 @@
+package sqlitemanager
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeywordSearch(t *testing.T) {
+	sm, err := NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+
+	blas := KeywordScope{UserID: "blas"}
+	assert.NoError(t, sm.IndexKeywords("m1", blas, map[string]int{"llamar": 1, "1155551234": 1}))
+	assert.NoError(t, sm.IndexKeywords("m2", blas, map[string]int{"reunion": 2, "chatbot": 1}))
+	assert.NoError(t, sm.IndexKeywords("m3", blas, map[string]int{"chatbot": 1, "whatsapp": 1, "cliente": 1, "itr": 1}))
+	assert.NoError(t, sm.IndexKeywords("m4", KeywordScope{UserID: "other"}, map[string]int{"1155551234": 1}))
+
+	hits, err := sm.KeywordSearch([]string{"1155551234"}, blas, 10)
+	assert.NoError(t, err)
+	assert.Len(t, hits, 1)
+	assert.Equal(t, "m1", hits[0].MemoryID)
+
+	// the shorter document with the term ranks first
+	hits, err = sm.KeywordSearch([]string{"chatbot"}, blas, 10)
+	assert.NoError(t, err)
+	assert.Len(t, hits, 2)
+	assert.Equal(t, "m2", hits[0].MemoryID)
+
+	assert.NoError(t, sm.DeleteKeywords("m2"))
+	hits, err = sm.KeywordSearch([]string{"chatbot"}, blas, 10)
+	assert.NoError(t, err)
+	assert.Len(t, hits, 1)
+	assert.Equal(t, "m3", hits[0].MemoryID)
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
@@ -24,6 +25,10 @@ func NewSQLiteManager(dbPath string) (*SQLiteManager, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
+	// SQLite allows a single writer: concurrent Add calls and workers share one connection
+	// instead of failing with "database is locked"
+	db.SetMaxOpenConns(1)
+
 	sm := &SQLiteManager{db: db}
 	if err := sm.migrateHistoryTable(); err != nil {
 		// Non-fatal, but log it
@@ -32,6 +37,36 @@ func NewSQLiteManager(dbPath string) (*SQLiteManager, error) {
 	if err := sm.createHistoryTable(); err != nil {
 		return nil, err
 	}
+	if err := sm.createUsageTable(); err != nil {
+		return nil, err
+	}
+	if err := sm.createQuotaTable(); err != nil {
+		return nil, err
+	}
+	if err := sm.createSettingsTable(); err != nil {
+		return nil, err
+	}
+	if err := sm.createReembedTable(); err != nil {
+		return nil, err
+	}
+	if err := sm.createIngestTables(); err != nil {
+		return nil, err
+	}
+	if err := sm.createJobsTable(); err != nil {
+		return nil, err
+	}
+	if err := sm.createWebhookOutboxTable(); err != nil {
+		return nil, err
+	}
+	if err := sm.createKeywordTables(); err != nil {
+		return nil, err
+	}
+	if err := sm.createAccessTable(); err != nil {
+		return nil, err
+	}
+	if err := sm.createGraphTables(); err != nil {
+		return nil, err
+	}
 	return sm, nil
 }
 
@@ -78,6 +113,19 @@ func (sm *SQLiteManager) migrateHistoryTable() error {
 		"created_at": "DATETIME",
 		"updated_at": "DATETIME",
 		"is_deleted": "INTEGER",
+		"tenant_id":  "TEXT",
+	}
+
+	// tables created before the tenant_id column only miss it
+	if _, ok := currentSchema["tenant_id"]; !ok {
+		currentSchema["tenant_id"] = "TEXT"
+		if sm.schemaEquals(currentSchema, expectedSchema) {
+			if _, err := sm.db.Exec("ALTER TABLE history ADD COLUMN tenant_id TEXT"); err != nil {
+				return fmt.Errorf("failed to add tenant_id to history table: %w", err)
+			}
+			return nil
+		}
+		delete(currentSchema, "tenant_id")
 	}
 
 	// Check if schemas are the same
@@ -136,7 +184,8 @@ func (sm *SQLiteManager) createHistoryTable() error {
 			event TEXT,
 			created_at DATETIME,
 			updated_at DATETIME,
-			is_deleted INTEGER
+			is_deleted INTEGER,
+			tenant_id TEXT
 		)
 	`)
 	if err != nil {
@@ -145,12 +194,12 @@ func (sm *SQLiteManager) createHistoryTable() error {
 	return nil
 }
 
-// AddHistory adds a new history record
-func (sm *SQLiteManager) AddHistory(memoryID string, oldMemory *string, newMemory string, event string, createdAt *string, updatedAt *string, isDeleted int) error {
+// AddHistory adds a new history record of a memory of tenantID ("" without tenant)
+func (sm *SQLiteManager) AddHistory(memoryID string, tenantID string, oldMemory *string, newMemory string, event string, createdAt *string, updatedAt *string, isDeleted int) error {
 	_, err := sm.db.Exec(`
-		INSERT INTO history (id, memory_id, old_memory, new_memory, event, created_at, updated_at, is_deleted)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, uuid.New().String(), memoryID, oldMemory, newMemory, event, createdAt, updatedAt, isDeleted)
+		INSERT INTO history (id, memory_id, old_memory, new_memory, event, created_at, updated_at, is_deleted, tenant_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, uuid.New().String(), memoryID, oldMemory, newMemory, event, createdAt, updatedAt, isDeleted, tenantID)
 	if err != nil {
 		return fmt.Errorf("failed to insert history: %w", err)
 	}
@@ -172,8 +221,8 @@ func (sm *SQLiteManager) GetHistory(memoryID string) ([]map[string]interface{},
 
 	var history []map[string]interface{}
 	for rows.Next() {
-		var id, memID, oldMem, newMem, evt string
-		var createdAt, updatedAt *string
+		var id, memID, evt string
+		var oldMem, newMem, createdAt, updatedAt *string // NULL for ADD events and old rows
 		if err := rows.Scan(&id, &memID, &oldMem, &newMem, &evt, &createdAt, &updatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan history row: %w", err)
 		}
@@ -193,6 +242,112 @@ func (sm *SQLiteManager) GetHistory(memoryID string) ([]map[string]interface{},
 	return history, nil
 }
 
+// GetHistoryTenant returns the tenant recorded in the history of a memory, "" if none, to
+// check the access to the history of deleted memories
+func (sm *SQLiteManager) GetHistoryTenant(memoryID string) (string, error) {
+	var tenantID string
+	err := sm.db.QueryRow(`
+		SELECT tenant_id FROM history
+		WHERE memory_id = ? AND tenant_id IS NOT NULL
+		ORDER BY updated_at DESC
+		LIMIT 1
+	`, memoryID).Scan(&tenantID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get history tenant: %w", err)
+	}
+	return tenantID, nil
+}
+
+// MigrateHistoryTimes rewrites the RFC3339 created_at and updated_at of the history rows in
+// UTC, so that they sort chronologically. Returns how many rows changed.
+func (sm *SQLiteManager) MigrateHistoryTimes() (int, error) {
+	rows, err := sm.db.Query(`SELECT id, created_at, updated_at FROM history`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query history: %w", err)
+	}
+	type times struct {
+		id                   string
+		createdAt, updatedAt *string
+	}
+	changed := []times{}
+	toUTC := func(value *string) (*string, bool) {
+		if value == nil {
+			return nil, false
+		}
+		t, err := time.Parse(time.RFC3339, *value)
+		if err != nil {
+			return value, false
+		}
+		utc := t.UTC().Format(time.RFC3339)
+		return &utc, utc != *value
+	}
+	for rows.Next() {
+		var row times
+		if err := rows.Scan(&row.id, &row.createdAt, &row.updatedAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan history row: %w", err)
+		}
+		var createdChanged, updatedChanged bool
+		row.createdAt, createdChanged = toUTC(row.createdAt)
+		row.updatedAt, updatedChanged = toUTC(row.updatedAt)
+		if createdChanged || updatedChanged {
+			changed = append(changed, row)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error reading history rows: %w", err)
+	}
+
+	for _, row := range changed {
+		if _, err := sm.db.Exec(`UPDATE history SET created_at = ?, updated_at = ? WHERE id = ?`, row.createdAt, row.updatedAt, row.id); err != nil {
+			return 0, fmt.Errorf("failed to migrate history row: %w", err)
+		}
+	}
+	return len(changed), nil
+}
+
+// ImportHistory inserts history rows as returned by GetHistory, plus their tenant_id, keeping
+// their ids.
+// Rows whose id already exists are left untouched.
+func (sm *SQLiteManager) ImportHistory(rows []map[string]interface{}) error {
+	for _, row := range rows {
+		id, _ := row["id"].(string)
+		memoryID, _ := row["memory_id"].(string)
+		if memoryID == "" {
+			return fmt.Errorf("history row %s has no memory_id", id)
+		}
+		if id == "" {
+			id = uuid.New().String()
+		}
+		event, _ := row["event"].(string)
+		isDeleted := 0
+		if event == "DELETE" {
+			isDeleted = 1
+		}
+		_, err := sm.db.Exec(`
+			INSERT OR IGNORE INTO history (id, memory_id, old_memory, new_memory, event, created_at, updated_at, is_deleted, tenant_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, id, memoryID, row["old_memory"], row["new_memory"], event, row["created_at"], row["updated_at"], isDeleted, row["tenant_id"])
+		if err != nil {
+			return fmt.Errorf("failed to import history: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteHistory deletes every history row of a memory
+func (sm *SQLiteManager) DeleteHistory(memoryID string) error {
+	_, err := sm.db.Exec(`DELETE FROM history WHERE memory_id = ?`, memoryID)
+	if err != nil {
+		return fmt.Errorf("failed to delete history: %w", err)
+	}
+	return nil
+}
+
 // Reset drops the history table
 func (sm *SQLiteManager) Reset() error {
 	_, err := sm.db.Exec("DROP TABLE IF EXISTS history")
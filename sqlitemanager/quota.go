@@ -0,0 +1,106 @@
+package sqlitemanager
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+func (sm *SQLiteManager) createQuotaTable() error {
+	_, err := sm.db.Exec(`
+		CREATE TABLE IF NOT EXISTS quota_counters (
+			key TEXT,
+			kind TEXT,
+			bucket TEXT,
+			count INTEGER,
+			PRIMARY KEY (key, kind, bucket)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create quota_counters table: %w", err)
+	}
+	return nil
+}
+
+// IncrementCounter adds delta to the counter for key/kind/bucket and returns the new value
+func (sm *SQLiteManager) IncrementCounter(key string, kind string, bucket string, delta int) (int, error) {
+	_, err := sm.db.Exec(`
+		INSERT INTO quota_counters (key, kind, bucket, count)
+		VALUES (?, ?, ?, MAX(?, 0))
+		ON CONFLICT (key, kind, bucket) DO UPDATE SET count = MAX(count + ?, 0)
+	`, key, kind, bucket, delta, delta)
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment quota counter: %w", err)
+	}
+	return sm.GetCounter(key, kind, bucket)
+}
+
+// QuotaCounter - a counter consumed by ConsumeCounters while it is below Max
+type QuotaCounter struct {
+	Key    string
+	Kind   string
+	Bucket string
+	Max    int
+}
+
+// ConsumeCounters adds 1 to every counter in a single transaction and returns their new values.
+// If a counter already reached its Max nothing is consumed, and its index and current value are
+// returned; rejected is -1 otherwise.
+func (sm *SQLiteManager) ConsumeCounters(counters []QuotaCounter) (values []int, rejected int, err error) {
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to begin quota transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	values = make([]int, len(counters))
+	for i, c := range counters {
+		_, err := tx.Exec(`INSERT OR IGNORE INTO quota_counters (key, kind, bucket, count) VALUES (?, ?, ?, 0)`, c.Key, c.Kind, c.Bucket)
+		if err != nil {
+			return nil, -1, fmt.Errorf("failed to create quota counter: %w", err)
+		}
+		err = tx.QueryRow(`
+			UPDATE quota_counters SET count = count + 1
+			WHERE key = ? AND kind = ? AND bucket = ? AND count < ?
+			RETURNING count
+		`, c.Key, c.Kind, c.Bucket, c.Max).Scan(&values[i])
+		if err == sql.ErrNoRows {
+			// the rollback gives back the counters consumed before this one
+			err = tx.QueryRow(`SELECT count FROM quota_counters WHERE key = ? AND kind = ? AND bucket = ?`, c.Key, c.Kind, c.Bucket).Scan(&values[i])
+			if err != nil {
+				return nil, -1, fmt.Errorf("failed to get quota counter: %w", err)
+			}
+			return values, i, nil
+		}
+		if err != nil {
+			return nil, -1, fmt.Errorf("failed to consume quota counter: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, -1, fmt.Errorf("failed to commit quota counters: %w", err)
+	}
+	return values, -1, nil
+}
+
+// GetCounter returns the counter for key/kind/bucket, 0 if it doesn't exist
+func (sm *SQLiteManager) GetCounter(key string, kind string, bucket string) (int, error) {
+	var count int
+	err := sm.db.QueryRow(`
+		SELECT count FROM quota_counters WHERE key = ? AND kind = ? AND bucket = ?
+	`, key, kind, bucket).Scan(&count)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get quota counter: %w", err)
+	}
+	return count, nil
+}
+
+// PruneCounters deletes the counters of the given kind older than bucket
+func (sm *SQLiteManager) PruneCounters(kind string, bucket string) error {
+	_, err := sm.db.Exec(`DELETE FROM quota_counters WHERE kind = ? AND bucket < ?`, kind, bucket)
+	if err != nil {
+		return fmt.Errorf("failed to prune quota counters: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package sqlitemanager
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumeCounters(t *testing.T) {
+	sm, err := NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+
+	user := QuotaCounter{Key: "user:u1", Kind: "requests", Bucket: "2025-01-10T10:00:00Z", Max: 3}
+	agent := QuotaCounter{Key: "agent:whatsapp", Kind: "requests", Bucket: "2025-01-10T10:00:00Z", Max: 2}
+	for i := 1; i <= 2; i++ {
+		values, rejected, err := sm.ConsumeCounters([]QuotaCounter{user, agent})
+		assert.NoError(t, err)
+		assert.Equal(t, -1, rejected)
+		assert.Equal(t, []int{i, i}, values)
+	}
+
+	// the agent is at its limit: the user counter consumed before it is given back
+	values, rejected, err := sm.ConsumeCounters([]QuotaCounter{user, agent})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rejected)
+	assert.Equal(t, 2, values[1])
+	count, err := sm.GetCounter(user.Key, user.Kind, user.Bucket)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	values, rejected, err = sm.ConsumeCounters([]QuotaCounter{user})
+	assert.NoError(t, err)
+	assert.Equal(t, -1, rejected)
+	assert.Equal(t, []int{3}, values)
+	_, rejected, err = sm.ConsumeCounters([]QuotaCounter{user})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rejected)
+}
@@ -0,0 +1,103 @@
+package sqlitemanager
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Status of a re-embedding job
+const (
+	ReembedRunning = "running"
+	ReembedDone    = "done"
+)
+
+// ReembedJob - checkpoint of a re-embedding migration from one collection to another
+type ReembedJob struct {
+	ID         string
+	Source     string
+	Target     string
+	Model      string
+	NextOffset string // id of the first point not yet migrated, "" at the start
+	Migrated   int
+	Skipped    int
+	Status     string
+	CreatedAt  string
+	UpdatedAt  string
+}
+
+func (sm *SQLiteManager) createReembedTable() error {
+	_, err := sm.db.Exec(`
+		CREATE TABLE IF NOT EXISTS reembed_jobs (
+			id TEXT PRIMARY KEY,
+			source TEXT,
+			target TEXT,
+			model TEXT,
+			next_offset TEXT,
+			migrated INTEGER,
+			skipped INTEGER,
+			status TEXT,
+			created_at DATETIME,
+			updated_at DATETIME
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create reembed_jobs table: %w", err)
+	}
+	return nil
+}
+
+// StartReembedJob returns the unfinished job migrating source to target with model,
+// or creates a new one. resumed is true when an existing checkpoint is returned.
+func (sm *SQLiteManager) StartReembedJob(source string, target string, model string) (job *ReembedJob, resumed bool, err error) {
+	job = &ReembedJob{}
+	err = sm.db.QueryRow(`
+		SELECT id, source, target, model, next_offset, migrated, skipped, status, created_at, updated_at
+		FROM reembed_jobs
+		WHERE source = ? AND target = ? AND model = ? AND status != ?
+		ORDER BY created_at DESC LIMIT 1
+	`, source, target, model, ReembedDone).Scan(
+		&job.ID, &job.Source, &job.Target, &job.Model, &job.NextOffset,
+		&job.Migrated, &job.Skipped, &job.Status, &job.CreatedAt, &job.UpdatedAt,
+	)
+	if err == nil {
+		return job, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, fmt.Errorf("failed to get reembed job: %w", err)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	job = &ReembedJob{
+		ID:        uuid.New().String(),
+		Source:    source,
+		Target:    target,
+		Model:     model,
+		Status:    ReembedRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	_, err = sm.db.Exec(`
+		INSERT INTO reembed_jobs (id, source, target, model, next_offset, migrated, skipped, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, job.Source, job.Target, job.Model, job.NextOffset, job.Migrated, job.Skipped, job.Status, job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create reembed job: %w", err)
+	}
+	return job, false, nil
+}
+
+// SaveReembedJob stores the checkpoint and status of a job
+func (sm *SQLiteManager) SaveReembedJob(job *ReembedJob) error {
+	job.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	_, err := sm.db.Exec(`
+		UPDATE reembed_jobs SET next_offset = ?, migrated = ?, skipped = ?, status = ?, updated_at = ?
+		WHERE id = ?
+	`, job.NextOffset, job.Migrated, job.Skipped, job.Status, job.UpdatedAt, job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save reembed job: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package sqlitemanager
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReembedJobResume(t *testing.T) {
+	sm, err := NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+
+	job, resumed, err := sm.StartReembedJob("memGo", "memGo_nomic-embed-text", "nomic-embed-text")
+	assert.NoError(t, err)
+	assert.False(t, resumed)
+
+	job.NextOffset = `uuid:"4d3c1f0e-5b8a-4f44-9d3e-2a1b0c9d8e7f"`
+	job.Migrated = 64
+	assert.NoError(t, sm.SaveReembedJob(job))
+
+	// interrupted: the next run continues from the checkpoint
+	again, resumed, err := sm.StartReembedJob("memGo", "memGo_nomic-embed-text", "nomic-embed-text")
+	assert.NoError(t, err)
+	assert.True(t, resumed)
+	assert.Equal(t, job.ID, again.ID)
+	assert.Equal(t, job.NextOffset, again.NextOffset)
+	assert.Equal(t, 64, again.Migrated)
+
+	// finished jobs aren't resumed
+	again.Status = ReembedDone
+	assert.NoError(t, sm.SaveReembedJob(again))
+	fresh, resumed, err := sm.StartReembedJob("memGo", "memGo_nomic-embed-text", "nomic-embed-text")
+	assert.NoError(t, err)
+	assert.False(t, resumed)
+	assert.NotEqual(t, job.ID, fresh.ID)
+
+	value, err := sm.GetSetting("active_collection:memGo")
+	assert.NoError(t, err)
+	assert.Equal(t, "", value)
+	assert.NoError(t, sm.SetSetting("active_collection:memGo", "memGo_nomic-embed-text"))
+	value, err = sm.GetSetting("active_collection:memGo")
+	assert.NoError(t, err)
+	assert.Equal(t, "memGo_nomic-embed-text", value)
+}
@@ -0,0 +1,46 @@
+package sqlitemanager
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+func (sm *SQLiteManager) createSettingsTable() error {
+	_, err := sm.db.Exec(`
+		CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT,
+			updated_at DATETIME
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create settings table: %w", err)
+	}
+	return nil
+}
+
+// GetSetting returns the value stored for key, "" if it doesn't exist
+func (sm *SQLiteManager) GetSetting(key string) (string, error) {
+	var value string
+	err := sm.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get setting %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// SetSetting stores value for key, replacing the previous value
+func (sm *SQLiteManager) SetSetting(key string, value string) error {
+	_, err := sm.db.Exec(`
+		INSERT INTO settings (key, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`, key, value, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to set setting %s: %w", key, err)
+	}
+	return nil
+}
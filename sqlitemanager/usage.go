@@ -0,0 +1,159 @@
+package sqlitemanager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// UsageRecord - a single LLM or embedding call in the usage ledger
+type UsageRecord struct {
+	ID               string  `json:"id"`
+	Kind             string  `json:"kind"` // "llm" or "embedding"
+	Operation        string  `json:"operation"`
+	Model            string  `json:"model"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	UserID           string  `json:"user_id"`
+	AgentID          string  `json:"agent_id"`
+	RunID            string  `json:"run_id"`
+	CreatedAt        string  `json:"created_at"`
+}
+
+// UsageQuery - filters for GetUsageTotals. Empty fields are not filtered.
+type UsageQuery struct {
+	From    string // RFC3339, inclusive
+	To      string // RFC3339, exclusive
+	UserID  string
+	AgentID string
+	RunID   string
+	GroupBy []string // any of "user_id", "agent_id", "run_id", "model", "kind"
+}
+
+// UsageTotal - aggregated usage for one group
+type UsageTotal struct {
+	Group            map[string]string `json:"group,omitempty"`
+	Calls            int               `json:"calls"`
+	PromptTokens     int               `json:"prompt_tokens"`
+	CompletionTokens int               `json:"completion_tokens"`
+	Cost             float64           `json:"cost"`
+}
+
+var usageGroupColumns = map[string]bool{
+	"user_id":  true,
+	"agent_id": true,
+	"run_id":   true,
+	"model":    true,
+	"kind":     true,
+}
+
+func (sm *SQLiteManager) createUsageTable() error {
+	_, err := sm.db.Exec(`
+		CREATE TABLE IF NOT EXISTS usage (
+			id TEXT PRIMARY KEY,
+			kind TEXT,
+			operation TEXT,
+			model TEXT,
+			prompt_tokens INTEGER,
+			completion_tokens INTEGER,
+			cost REAL,
+			user_id TEXT,
+			agent_id TEXT,
+			run_id TEXT,
+			created_at DATETIME
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create usage table: %w", err)
+	}
+	_, err = sm.db.Exec(`CREATE INDEX IF NOT EXISTS idx_usage_created_at ON usage (created_at)`)
+	if err != nil {
+		return fmt.Errorf("failed to create usage index: %w", err)
+	}
+	return nil
+}
+
+// AddUsage adds a new usage record
+func (sm *SQLiteManager) AddUsage(rec UsageRecord) error {
+	if rec.ID == "" {
+		rec.ID = uuid.New().String()
+	}
+	_, err := sm.db.Exec(`
+		INSERT INTO usage (id, kind, operation, model, prompt_tokens, completion_tokens, cost, user_id, agent_id, run_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, rec.ID, rec.Kind, rec.Operation, rec.Model, rec.PromptTokens, rec.CompletionTokens, rec.Cost, rec.UserID, rec.AgentID, rec.RunID, rec.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert usage: %w", err)
+	}
+	return nil
+}
+
+// GetUsageTotals aggregates the usage ledger by time range and principal
+func (sm *SQLiteManager) GetUsageTotals(q UsageQuery) ([]UsageTotal, error) {
+	for _, col := range q.GroupBy {
+		if !usageGroupColumns[col] {
+			return nil, fmt.Errorf("unsupported group_by column: %s", col)
+		}
+	}
+
+	where := []string{"1=1"}
+	args := []interface{}{}
+	if q.From != "" {
+		where = append(where, "created_at >= ?")
+		args = append(args, q.From)
+	}
+	if q.To != "" {
+		where = append(where, "created_at < ?")
+		args = append(args, q.To)
+	}
+	for col, val := range map[string]string{"user_id": q.UserID, "agent_id": q.AgentID, "run_id": q.RunID} {
+		if val != "" {
+			where = append(where, col+" = ?")
+			args = append(args, val)
+		}
+	}
+
+	selectCols := "COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(cost), 0)"
+	query := "SELECT " + selectCols
+	if len(q.GroupBy) > 0 {
+		query += ", " + strings.Join(q.GroupBy, ", ")
+	}
+	query += " FROM usage WHERE " + strings.Join(where, " AND ")
+	if len(q.GroupBy) > 0 {
+		query += " GROUP BY " + strings.Join(q.GroupBy, ", ") + " ORDER BY SUM(cost) DESC"
+	}
+
+	rows, err := sm.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	totals := []UsageTotal{}
+	for rows.Next() {
+		var total UsageTotal
+		groupVals := make([]*string, len(q.GroupBy))
+		dest := []interface{}{&total.Calls, &total.PromptTokens, &total.CompletionTokens, &total.Cost}
+		for i := range groupVals {
+			dest = append(dest, &groupVals[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan usage row: %w", err)
+		}
+		if len(q.GroupBy) > 0 {
+			total.Group = make(map[string]string, len(q.GroupBy))
+			for i, col := range q.GroupBy {
+				if groupVals[i] != nil {
+					total.Group[col] = *groupVals[i]
+				}
+			}
+		}
+		totals = append(totals, total)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading usage rows: %w", err)
+	}
+	return totals, nil
+}
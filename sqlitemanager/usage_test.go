@@ -0,0 +1,38 @@
+package sqlitemanager
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUsageTotals(t *testing.T) {
+	sm, err := NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+
+	records := []UsageRecord{
+		{Kind: "llm", Model: "gpt-4o-mini", PromptTokens: 100, CompletionTokens: 10, Cost: 0.5, UserID: "u1", AgentID: "whatsapp", CreatedAt: "2025-01-10T10:00:00Z"},
+		{Kind: "embedding", Model: "text-embedding-3-small", PromptTokens: 20, Cost: 0.1, UserID: "u1", AgentID: "whatsapp", CreatedAt: "2025-01-11T10:00:00Z"},
+		{Kind: "llm", Model: "gpt-4o-mini", PromptTokens: 50, CompletionTokens: 5, Cost: 0.25, UserID: "u2", AgentID: "http", CreatedAt: "2025-02-01T10:00:00Z"},
+	}
+	for _, rec := range records {
+		assert.NoError(t, sm.AddUsage(rec))
+	}
+
+	totals, err := sm.GetUsageTotals(UsageQuery{From: "2025-01-01T00:00:00Z", To: "2025-02-01T00:00:00Z"})
+	assert.NoError(t, err)
+	assert.Len(t, totals, 1)
+	assert.Equal(t, 2, totals[0].Calls)
+	assert.Equal(t, 120, totals[0].PromptTokens)
+	assert.InDelta(t, 0.6, totals[0].Cost, 1e-9)
+
+	totals, err = sm.GetUsageTotals(UsageQuery{GroupBy: []string{"agent_id"}})
+	assert.NoError(t, err)
+	assert.Len(t, totals, 2)
+	assert.Equal(t, "whatsapp", totals[0].Group["agent_id"])
+	assert.Equal(t, "http", totals[1].Group["agent_id"])
+
+	_, err = sm.GetUsageTotals(UsageQuery{GroupBy: []string{"data"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,113 @@
+package sqlitemanager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Status of a webhook delivery
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// WebhookDelivery - an event waiting in the outbox to be posted to a webhook endpoint
+type WebhookDelivery struct {
+	ID        string
+	Endpoint  string // name of the configured endpoint
+	Event     string
+	Payload   string // JSON body
+	Attempts  int
+	LastError string
+	CreatedAt string
+}
+
+func (sm *SQLiteManager) createWebhookOutboxTable() error {
+	_, err := sm.db.Exec(`
+		CREATE TABLE IF NOT EXISTS webhook_outbox (
+			id TEXT PRIMARY KEY,
+			endpoint TEXT,
+			event TEXT,
+			payload TEXT,
+			status TEXT,
+			attempts INTEGER DEFAULT 0,
+			last_error TEXT,
+			next_attempt_at DATETIME,
+			created_at DATETIME,
+			delivered_at DATETIME
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook_outbox table: %w", err)
+	}
+	_, err = sm.db.Exec(`CREATE INDEX IF NOT EXISTS webhook_outbox_due ON webhook_outbox (status, next_attempt_at)`)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook_outbox index: %w", err)
+	}
+	return nil
+}
+
+// EnqueueWebhook stores a delivery of payload to endpoint in the outbox, due immediately
+func (sm *SQLiteManager) EnqueueWebhook(endpoint string, event string, payload string) (string, error) {
+	id := uuid.New().String()
+	now := time.Now().UTC().Format(queueTime)
+	_, err := sm.db.Exec(`
+		INSERT INTO webhook_outbox (id, endpoint, event, payload, status, attempts, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?)
+	`, id, endpoint, event, payload, WebhookPending, now, now)
+	if err != nil {
+		return "", fmt.Errorf("failed to enqueue webhook: %w", err)
+	}
+	return id, nil
+}
+
+// DueWebhooks returns up to limit pending deliveries whose next attempt is due, oldest first
+func (sm *SQLiteManager) DueWebhooks(limit int) ([]WebhookDelivery, error) {
+	rows, err := sm.db.Query(`
+		SELECT id, endpoint, event, payload, attempts, COALESCE(last_error, ''), created_at
+		FROM webhook_outbox WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY created_at LIMIT ?
+	`, WebhookPending, time.Now().UTC().Format(queueTime), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook outbox: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.Endpoint, &d.Event, &d.Payload, &d.Attempts, &d.LastError, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// MarkWebhookDelivered records a successful delivery
+func (sm *SQLiteManager) MarkWebhookDelivered(id string) error {
+	_, err := sm.db.Exec(`UPDATE webhook_outbox SET status = ?, attempts = attempts + 1, last_error = NULL, delivered_at = ? WHERE id = ?`,
+		WebhookDelivered, time.Now().UTC().Format(queueTime), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook delivered: %w", err)
+	}
+	return nil
+}
+
+// MarkWebhookAttemptFailed records a failed attempt. With retryAfter > 0 the delivery is
+// attempted again after that delay, otherwise it is given up as failed.
+func (sm *SQLiteManager) MarkWebhookAttemptFailed(id string, errMsg string, retryAfter time.Duration) error {
+	status := WebhookPending
+	if retryAfter <= 0 {
+		status = WebhookFailed
+	}
+	_, err := sm.db.Exec(`UPDATE webhook_outbox SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?`,
+		status, errMsg, time.Now().UTC().Add(retryAfter).Format(queueTime), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook attempt: %w", err)
+	}
+	return nil
+}
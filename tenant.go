@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTenantRequired is returned when authentication is enabled and a Memory
+// is used without a tenant, see Memory.WithTenant
+var ErrTenantRequired = errors.New("tenant required: use Memory.WithTenant when auth is enabled")
+
+// WithTenant returns a copy of the Memory scoped to tenantID.
+// Every read and write of the copy is constrained to the tenant's memories.
+func (m *Memory) WithTenant(tenantID string) *Memory {
+	scoped := *m
+	scoped.tenantID = tenantID
+	return &scoped
+}
+
+// TenantID returns the tenant the Memory is scoped to, "" if none
+func (m *Memory) TenantID() string {
+	return m.tenantID
+}
+
+// systemScope returns a copy of the Memory for the background jobs, which work over the
+// memories of every tenant even when auth is enabled
+func (m *Memory) systemScope() *Memory {
+	scoped := *m
+	scoped.tenantID = ""
+	scoped.system = true
+	return &scoped
+}
+
+// applyTenant adds the mandatory tenant_id constraint to filter and metadata maps
+func (m *Memory) applyTenant(maps ...map[string]interface{}) error {
+	if m.tenantID == "" {
+		if m.config.Auth.Enabled && !m.system {
+			return ErrTenantRequired
+		}
+		return nil
+	}
+	for _, mp := range maps {
+		mp["tenant_id"] = m.tenantID
+	}
+	return nil
+}
+
+// payloadTenant returns the tenant_id of a memory payload, "" if none
+func payloadTenant(payload map[string]interface{}) string {
+	tenantID, _ := payload["tenant_id"].(string)
+	return tenantID
+}
+
+// checkTenant verifies that a stored memory payload belongs to the Memory's tenant
+func (m *Memory) checkTenant(memoryID string, payload map[string]interface{}) error {
+	if m.tenantID == "" {
+		if m.config.Auth.Enabled && !m.system {
+			return ErrTenantRequired
+		}
+		return nil
+	}
+	if payloadTenant(payload) != m.tenantID {
+		// same error as a missing memory, to not leak other tenants ids
+		return fmt.Errorf("memory with ID %s not found", memoryID)
+	}
+	return nil
+}
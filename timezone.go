@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// timestamp returns t as stored in memory payloads: an RFC3339 string in UTC for
+// created_at/updated_at and Unix seconds for created_at_ts/updated_at_ts
+func timestamp(t time.Time) (string, int64) {
+	return t.UTC().Format(time.RFC3339), t.Unix()
+}
+
+// epochOf returns the Unix seconds of a payload timestamp, false when it isn't RFC3339
+func epochOf(value interface{}) (int64, bool) {
+	s, _ := value.(string)
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Unix(), true
+}
+
+// WithTimeZone returns a copy of the Memory whose results have their timestamps in loc,
+// instead of the time zone of the user or the timezone config
+func (m *Memory) WithTimeZone(loc *time.Location) *Memory {
+	scoped := *m
+	scoped.timeZone = loc
+	return &scoped
+}
+
+func userTimeZoneKey(tenantID string, userID string) string {
+	return "timezone:" + tenantID + ":" + userID
+}
+
+// SetUserTimeZone stores the IANA time zone timestamps are shown in to a user of the tenant,
+// "" uses the timezone config again
+func (m *Memory) SetUserTimeZone(userID string, timeZone string) error {
+	if timeZone != "" {
+		if _, err := time.LoadLocation(timeZone); err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+	return m.db.SetSetting(userTimeZoneKey(m.tenantID, userID), timeZone)
+}
+
+// UserTimeZone returns the time zone of SetUserTimeZone, "" when the user has none
+func (m *Memory) UserTimeZone(userID string) (string, error) {
+	return m.db.GetSetting(userTimeZoneKey(m.tenantID, userID))
+}
+
+// displayLocation returns the time zone of the timestamps shown to a user: the one of
+// WithTimeZone, the one of the user, or the timezone config
+func (m *Memory) displayLocation(userID string) *time.Location {
+	if m.timeZone != nil {
+		return m.timeZone
+	}
+	if userID != "" && m.db != nil {
+		if timeZone, err := m.UserTimeZone(userID); err == nil && timeZone != "" {
+			if loc, err := time.LoadLocation(timeZone); err == nil {
+				return loc
+			}
+		}
+	}
+	if loc, err := time.LoadLocation(m.config.TimeZone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// localizeTimes rewrites the created_at and updated_at of a result in loc
+func localizeTimes(item map[string]interface{}, loc *time.Location) {
+	for _, key := range []string{"created_at", "updated_at"} {
+		switch value := item[key].(type) {
+		case string:
+			if t, err := time.Parse(time.RFC3339, value); err == nil {
+				item[key] = t.In(loc).Format(time.RFC3339)
+			}
+		case *string: // history rows
+			if value == nil {
+				continue
+			}
+			if t, err := time.Parse(time.RFC3339, *value); err == nil {
+				local := t.In(loc).Format(time.RFC3339)
+				item[key] = &local
+			}
+		}
+	}
+}
+
+// migratedTimestampsKey - setting marking that MigrateTimestamps ran over the store
+const migratedTimestampsKey = "timestamps_migrated"
+
+// MigrateTimestamps rewrites the created_at/updated_at of the memories stored in a local time
+// zone in UTC, adds their created_at_ts/updated_at_ts, and rewrites the history timestamps in
+// UTC. Returns how many memories changed.
+func (m *Memory) MigrateTimestamps() (int, error) {
+	filters := map[string]interface{}{}
+	if err := m.applyTenant(filters); err != nil {
+		return 0, err
+	}
+	count := 0
+	offset := ""
+	for {
+		page, next, err := m.vectorStore.Scroll(filters, 256, offset, true)
+		if err != nil {
+			return count, fmt.Errorf("error listing memories: %w", err)
+		}
+		for _, memory := range page {
+			payload, changed := migratePayloadTimes(memory.Payload)
+			if !changed {
+				continue
+			}
+			vector := make([]float64, len(memory.Vector))
+			for i, v := range memory.Vector {
+				vector[i] = float64(v)
+			}
+			if err := m.vectorStore.Insert([][]float64{vector}, []string{plainPointID(memory.ID)}, []map[string]interface{}{payload}); err != nil {
+				return count, fmt.Errorf("error migrating memory %s: %w", memory.ID, err)
+			}
+			count++
+		}
+		if next == "" {
+			break
+		}
+		offset = next
+	}
+	if m.tenantID == "" {
+		if _, err := m.db.MigrateHistoryTimes(); err != nil {
+			return count, err
+		}
+		if err := m.db.SetSetting(migratedTimestampsKey, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// migratePayloadTimes returns the payload with its timestamps in UTC and their epoch fields
+func migratePayloadTimes(payload map[string]interface{}) (map[string]interface{}, bool) {
+	migrated := make(map[string]interface{}, len(payload)+2)
+	for k, v := range payload {
+		migrated[k] = v
+	}
+	changed := false
+	for _, key := range []string{"created_at", "updated_at"} {
+		s, _ := payload[key].(string)
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			continue
+		}
+		utc, epoch := timestamp(t)
+		if s != utc || payload[key+"_ts"] == nil {
+			migrated[key], migrated[key+"_ts"] = utc, epoch
+			changed = true
+		}
+	}
+	return migrated, changed
+}
+
+// migrateTimestampsOnce runs MigrateTimestamps the first time the server starts, before it
+// serves requests or runs the background jobs
+func (m *Memory) migrateTimestampsOnce() {
+	if done, err := m.db.GetSetting(migratedTimestampsKey); err != nil || done != "" {
+		return
+	}
+	count, err := m.systemScope().MigrateTimestamps()
+	if err != nil {
+		log.Printf("Error migrating timestamps to UTC: %v", err)
+		return
+	}
+	log.Printf("Migrated the timestamps of %d memories to UTC", count)
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
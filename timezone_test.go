@@ -0,0 +1,46 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimestampsAndDisplayTimeZone(t *testing.T) {
+	payload, changed := migratePayloadTimes(map[string]interface{}{"data": "likes coffee", "created_at": "2025-01-10T11:32:53-03:00"})
+	assert.True(t, changed)
+	assert.Equal(t, "2025-01-10T14:32:53Z", payload["created_at"])
+	assert.Equal(t, int64(1736519573), payload["created_at_ts"])
+	assert.NotContains(t, payload, "updated_at")
+	_, changed = migratePayloadTimes(payload)
+	assert.False(t, changed)
+
+	db, err := sqlitemanager.NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+	createdAt := "2025-01-10T11:32:53-03:00"
+	assert.NoError(t, db.AddHistory("m1", "", nil, "likes coffee", "ADD", &createdAt, nil, 0))
+	migrated, err := db.MigrateHistoryTimes()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, migrated)
+	history, err := db.GetHistory("m1")
+	assert.NoError(t, err)
+	assert.Equal(t, "2025-01-10T14:32:53Z", *history[0]["created_at"].(*string))
+
+	config := NewMemoryConfig()
+	config.TimeZone = "Europe/Madrid"
+	m := &Memory{config: config, db: db}
+	assert.Equal(t, "Europe/Madrid", m.displayLocation("Blas").String())
+	assert.Error(t, m.SetUserTimeZone("Blas", "Mars/Olympus_Mons"))
+	assert.NoError(t, m.SetUserTimeZone("Blas", "America/Argentina/Buenos_Aires"))
+	assert.Equal(t, "America/Argentina/Buenos_Aires", m.displayLocation("Blas").String())
+	assert.Equal(t, "Europe/Madrid", m.WithTenant("other").displayLocation("Blas").String())
+	assert.Equal(t, "UTC", m.WithTimeZone(time.UTC).displayLocation("Blas").String())
+
+	result := map[string]interface{}{"created_at": "2025-01-10T14:32:53Z", "updated_at": nil}
+	localizeTimes(result, m.displayLocation("Blas"))
+	assert.Equal(t, "2025-01-10T11:32:53-03:00", result["created_at"])
+	assert.Nil(t, result["updated_at"])
+}
@@ -0,0 +1,155 @@
+package tools
+
+import (
+	"github.com/matigumma/memGo/models"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// scope arguments shared by the MCP tools, they default to the mcp section of the config
+var mcpScopeProperties = map[string]interface{}{
+	"user_id": map[string]interface{}{
+		"type":        "string",
+		"description": "user_id the memories belong to",
+	},
+	"agent_id": map[string]interface{}{
+		"type":        "string",
+		"description": "agent_id the memories belong to",
+	},
+	"run_id": map[string]interface{}{
+		"type":        "string",
+		"description": "run_id the memories belong to",
+	},
+}
+
+func withScope(properties map[string]interface{}) map[string]interface{} {
+	for k, v := range mcpScopeProperties {
+		properties[k] = v
+	}
+	return properties
+}
+
+var MCP_ADD_MEMORY_TOOL = models.Tool{
+	Type: "function",
+	Function: &llms.FunctionDefinition{
+		Name:        "add_memory",
+		Description: "Extract the relevant facts of a text and store them as memories, updating or deleting the existing memories they contradict",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": withScope(map[string]interface{}{
+				"data": map[string]interface{}{
+					"type":        "string",
+					"description": "Text to remember, e.g. a message or a conversation",
+				},
+				"metadata": map[string]interface{}{
+					"type":        "object",
+					"description": "Metadata stored with the memories",
+				},
+			}),
+			"required": []string{"data"},
+		},
+	},
+}
+
+var MCP_SEARCH_MEMORY_TOOL = models.Tool{
+	Type: "function",
+	Function: &llms.FunctionDefinition{
+		Name:        "search_memory",
+		Description: "Search the memories most similar to a query",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": withScope(map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "What to search for",
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": "Maximum number of memories, defaults to 5",
+				},
+			}),
+			"required": []string{"query"},
+		},
+	},
+}
+
+var MCP_GET_MEMORY_TOOL = models.Tool{
+	Type: "function",
+	Function: &llms.FunctionDefinition{
+		Name:        "get_memory",
+		Description: "Get a memory by memory_id",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"memory_id": map[string]interface{}{
+					"type":        "string",
+					"description": "memory_id of the memory",
+				},
+			},
+			"required": []string{"memory_id"},
+		},
+	},
+}
+
+var MCP_LIST_MEMORIES_TOOL = models.Tool{
+	Type: "function",
+	Function: &llms.FunctionDefinition{
+		Name:        "list_memories",
+		Description: "List the memories of a user, agent or run",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": withScope(map[string]interface{}{
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": "Maximum number of memories, defaults to 100",
+				},
+			}),
+			"required": []string{},
+		},
+	},
+}
+
+var MCP_DELETE_MEMORY_TOOL = models.Tool{
+	Type: "function",
+	Function: &llms.FunctionDefinition{
+		Name:        "delete_memory",
+		Description: "Delete memory by memory_id",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"memory_id": map[string]interface{}{
+					"type":        "string",
+					"description": "memory_id of the memory to delete",
+				},
+			},
+			"required": []string{"memory_id"},
+		},
+	},
+}
+
+var MCP_MEMORY_HISTORY_TOOL = models.Tool{
+	Type: "function",
+	Function: &llms.FunctionDefinition{
+		Name:        "memory_history",
+		Description: "Get the change history of a memory by memory_id",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"memory_id": map[string]interface{}{
+					"type":        "string",
+					"description": "memory_id of the memory",
+				},
+			},
+			"required": []string{"memory_id"},
+		},
+	},
+}
+
+// MCP_TOOLS - the tools of the memGo MCP server
+var MCP_TOOLS = []models.Tool{
+	MCP_ADD_MEMORY_TOOL,
+	MCP_SEARCH_MEMORY_TOOL,
+	MCP_GET_MEMORY_TOOL,
+	MCP_LIST_MEMORIES_TOOL,
+	MCP_DELETE_MEMORY_TOOL,
+	MCP_MEMORY_HISTORY_TOOL,
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// EventExpire - memory event of the expiry sweeper, in the history and for webhooks
+const EventExpire = "EXPIRE"
+
+// ExpiryConfig - the sweeper deleting expired memories, see Memory.SweepExpired
+type ExpiryConfig struct {
+	DisableSweeper       bool `json:"disable_sweeper"`                     // expired memories are still hidden from Search and GetAll
+	SweepIntervalMinutes int  `json:"sweep_interval_minutes" default:"15"` // between sweeps
+}
+
+func (ec ExpiryConfig) validate() []error {
+	if ec.SweepIntervalMinutes < 1 {
+		return []error{errors.New("expiry.sweep_interval_minutes must be at least 1")}
+	}
+	return nil
+}
+
+// parseExpiry returns the expiry of a memory given as an RFC3339 timestamp or a YYYY-MM-DD
+// date (the end of that day in loc), or as a ttl duration from now such as "48h"
+func parseExpiry(expiresAt string, ttl string, loc *time.Location) (time.Time, error) {
+	if expiresAt != "" && ttl != "" {
+		return time.Time{}, errors.New("expires_at and ttl are exclusive")
+	}
+	if ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return time.Time{}, fmt.Errorf("invalid ttl %q, expected a positive duration such as 48h", ttl)
+		}
+		return time.Now().Add(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, expiresAt); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", expiresAt, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expires_at %q, expected an RFC3339 timestamp or YYYY-MM-DD date", expiresAt)
+	}
+	return day.AddDate(0, 0, 1), nil
+}
+
+// setExpiry stores the expiry in the metadata of Add: expires_at in UTC and expires_at_ts
+func setExpiry(metadata map[string]interface{}, expiry time.Time) {
+	metadata["expires_at"], metadata["expires_at_ts"] = timestamp(expiry)
+}
+
+// WithExpired returns a copy of the Memory whose Search, HybridSearch and GetAll also return
+// the memories past their expires_at the sweeper didn't delete yet
+func (m *Memory) WithExpired() *Memory {
+	scoped := *m
+	scoped.includeExpired = true
+	return &scoped
+}
+
+// expiredFilter matches the memories whose expires_at passed at now
+func expiredFilter(now time.Time) Filter {
+	return Filter{Field: "expires_at_ts", Range: &FilterRange{Lte: float64(now.Unix())}}
+}
+
+// SweepExpired deletes the memories of the tenant past their expires_at, recording EXPIRE in
+// their history. Returns the ids deleted.
+func (m *Memory) SweepExpired() ([]string, error) {
+	filters := map[string]interface{}{}
+	if err := m.applyTenant(filters); err != nil {
+		return nil, err
+	}
+	expired := expiredFilter(time.Now())
+	filters[filterExprKey] = &expired
+
+	deleted := []string{}
+	seen := map[string]bool{}
+	for {
+		// deleted memories leave the filter, so the first page is read until it is empty
+		page, _, err := m.vectorStore.Scroll(filters, 256, "", false)
+		if err != nil {
+			return deleted, fmt.Errorf("error listing expired memories: %w", err)
+		}
+		if len(page) == 0 {
+			return deleted, nil
+		}
+		for _, memory := range page {
+			memoryID := plainPointID(memory.ID)
+			if seen[memoryID] {
+				return deleted, fmt.Errorf("expired memory %s is still listed after its deletion", memoryID)
+			}
+			seen[memoryID] = true
+			ok, err := m.expireMemory(memoryID, memory, expired)
+			if err != nil {
+				return deleted, err
+			}
+			if ok {
+				deleted = append(deleted, memoryID)
+			}
+		}
+	}
+}
+
+// expireMemory deletes a listed memory under its scope lock if it is still expired, it
+// may have been deleted or given a new expiry since it was listed
+func (m *Memory) expireMemory(memoryID string, memory SearchResult, expired Filter) (bool, error) {
+	defer m.lockScope(memory.Payload)()
+	point, err := m.vectorStore.Get(memoryID)
+	if errors.Is(err, ErrMemoryNotFound) || (err == nil && point == nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error getting memory %s: %w", memoryID, err)
+	}
+	if !expired.Matches(convertQdrantPayload(point.Payload)) {
+		return false, nil
+	}
+	return true, m.deleteMemory(memoryID, EventExpire)
+}
+
+// StartExpirySweeper runs SweepExpired every expiry.sweep_interval_minutes unless
+// expiry.disable_sweeper
+func (m *Memory) StartExpirySweeper(ctx context.Context) {
+	if m.config.Expiry.DisableSweeper {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(max(m.config.Expiry.SweepIntervalMinutes, 1)) * time.Minute)
+		defer ticker.Stop()
+		for {
+			deleted, err := m.systemScope().SweepExpired()
+			if err != nil {
+				log.Printf("Error sweeping expired memories: %v", err)
+			}
+			if len(deleted) > 0 {
+				log.Printf("Deleted %d expired memories", len(deleted))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiry(t *testing.T) {
+	assert.Empty(t, NewMemoryConfig().Expiry.validate())
+
+	buenosAires := time.FixedZone("ART", -3*60*60)
+	expiry, err := parseExpiry("2025-06-30", "", buenosAires)
+	assert.NoError(t, err)
+	assert.Equal(t, "2025-07-01T03:00:00Z", expiry.UTC().Format(time.RFC3339)) // end of the day
+
+	expiry, err = parseExpiry("2025-06-30T17:00:00-03:00", "", time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, "2025-06-30T20:00:00Z", expiry.UTC().Format(time.RFC3339))
+
+	expiry, err = parseExpiry("", "48h", time.UTC)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(48*time.Hour), expiry, time.Minute)
+
+	for _, invalid := range [][2]string{{"mañana", ""}, {"", "-1h"}, {"", "2 days"}, {"2025-06-30", "48h"}} {
+		_, err := parseExpiry(invalid[0], invalid[1], time.UTC)
+		assert.Error(t, err, invalid)
+	}
+
+	metadata := map[string]interface{}{}
+	setExpiry(metadata, time.Now().Add(-time.Hour))
+	expired := metadata
+	live := map[string]interface{}{"data": "x"}
+	setExpiry(live, time.Now().Add(time.Hour))
+
+	m := &Memory{config: NewMemoryConfig()}
+	expr := m.filterExpr()
+	assert.False(t, expr.Matches(expired))
+	assert.True(t, expr.Matches(live))
+	assert.True(t, expr.Matches(map[string]interface{}{"data": "no expiry"}))
+	assert.False(t, expr.Matches(map[string]interface{}{"data": "x", "archived": true}))
+
+	assert.True(t, m.WithExpired().filterExpr().Matches(expired))
+	assert.Nil(t, m.WithExpired().WithArchived().filterExpr())
+}
+
+func TestSweepExpiredWithAuth(t *testing.T) {
+	db, err := sqlitemanager.NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+	store := &fakeVectorStore{points: map[string]SearchResult{}}
+	config := NewMemoryConfig()
+	config.Auth.Enabled = true
+	config.Usage.Enabled = false
+	m := &Memory{config: config, vectorStore: store, embeddingModel: letterEmbedder{}, db: db, scopeLocks: newScopeLocks()}
+
+	for id, tenant := range map[string]string{"a": "acme", "b": "globex"} {
+		payload := map[string]interface{}{"data": "expired " + id, "tenant_id": tenant, "user_id": "blas"}
+		setExpiry(payload, time.Now().Add(-time.Hour))
+		assert.NoError(t, store.Insert([][]float64{make([]float64, 26)}, []string{id}, []map[string]interface{}{payload}))
+	}
+	live := map[string]interface{}{"data": "live", "tenant_id": "acme", "user_id": "blas"}
+	setExpiry(live, time.Now().Add(time.Hour))
+	assert.NoError(t, store.Insert([][]float64{make([]float64, 26)}, []string{"c"}, []map[string]interface{}{live}))
+
+	_, err = m.SweepExpired()
+	assert.ErrorIs(t, err, ErrTenantRequired)
+
+	// the sweeper runs over every tenant
+	deleted, err := m.systemScope().SweepExpired()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b"}, deleted)
+	assert.Len(t, store.points, 1)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/matigumma/memGo/chains"
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/matigumma/memGo/utils"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// UsageConfig - configuration of the token and cost ledger
+type UsageConfig struct {
+	Enabled bool `json:"enabled" default:"true"`
+	// Prices overrides or extends utils.DefaultPriceTable, USD per 1M tokens
+	Prices utils.PriceTable `json:"prices,omitempty"`
+}
+
+// priceTable returns the effective price table for the config
+func (uc UsageConfig) priceTable() utils.PriceTable {
+	return utils.DefaultPriceTable.Merge(uc.Prices)
+}
+
+// scopeFromMap extracts user_id, agent_id and run_id from a filters or metadata map
+func scopeFromMap(scope map[string]interface{}) (userID, agentID, runID string) {
+	userID, _ = scope["user_id"].(string)
+	agentID, _ = scope["agent_id"].(string)
+	runID, _ = scope["run_id"].(string)
+	return userID, agentID, runID
+}
+
+// recordUsage stores a usage record attributed to the user/agent/run found in scope
+func (m *Memory) recordUsage(kind string, operation string, model string, promptTokens int, completionTokens int, scope map[string]interface{}) {
+	if m.db == nil || !m.config.Usage.Enabled {
+		return
+	}
+	userID, agentID, runID := scopeFromMap(scope)
+	err := m.db.AddUsage(sqlitemanager.UsageRecord{
+		Kind:             kind,
+		Operation:        operation,
+		Model:            model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Cost:             m.config.Usage.priceTable().Cost(model, promptTokens, completionTokens),
+		UserID:           userID,
+		AgentID:          agentID,
+		RunID:            runID,
+		CreatedAt:        time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Printf("Error adding usage: %v", err) // Non-critical error
+	}
+}
+
+// chainUsage returns a chains.UsageFunc that records LLM usage for the given scope
+func (m *Memory) chainUsage(scope map[string]interface{}) chains.UsageFunc {
+	return func(operation string, model string, promptTokens int, completionTokens int) {
+		m.recordUsage("llm", operation, model, promptTokens, completionTokens, scope)
+	}
+}
+
+// embed embeds text with the configured embedder and records its usage.
+// Embedding APIs don't report token counts, so they are estimated with the model tokenizer.
+func (m *Memory) embed(text string, operation string, scope map[string]interface{}) ([]float64, []float32, error) {
+	return m.embedWith(m.embeddingModel, text, operation, scope)
+}
+
+// embedWith is embed with an embedder other than the configured one, e.g. while re-embedding
+func (m *Memory) embedWith(embedder Embedder, text string, operation string, scope map[string]interface{}) ([]float64, []float32, error) {
+	embeddings, embeddings32, err := embedder.Embed(text)
+	if err != nil {
+		return nil, nil, err
+	}
+	model := embedder.Model()
+	m.recordUsage("embedding", operation, model, llms.CountTokens(model, text), 0, scope)
+	return embeddings, embeddings32, nil
+}
+
+// Usage returns the aggregated token and cost usage matching the query
+func (m *Memory) Usage(q sqlitemanager.UsageQuery) ([]sqlitemanager.UsageTotal, error) {
+	return m.db.GetUsageTotals(q)
+}
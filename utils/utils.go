@@ -63,7 +63,11 @@ func GetUpdateMemoryMessages(existingMemories []map[string]interface{}, memory s
 }
 
 // --- Helper function to map a map to a struct ---
+// fields missing in config take the value of their `default` struct tag
 func MapToStruct(config map[string]interface{}, target interface{}) error {
+	if err := ApplyDefaults(target); err != nil {
+		return err
+	}
 	configBytes, err := json.Marshal(config)
 	if err != nil {
 		return fmt.Errorf("error marshaling config: %w", err)
@@ -77,8 +81,17 @@ func MapToStruct(config map[string]interface{}, target interface{}) error {
 
 /* ====== TOKEN COUNTER ====== */
 
-// EstimateCost calculates the estimated cost in USD for LLM API usage
-// based on input and output tokens. Currently only supports gpt-4o model.
+// ModelPrice holds the USD price per 1M tokens for a model.
+// Embedding models only use InputPerMillion.
+type ModelPrice struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
+}
+
+// PriceTable maps a model name to its price.
+type PriceTable map[string]ModelPrice
+
+// DefaultPriceTable is used when no price table is configured.
 /*
 considerations:
 gpt-4o: $2.50 / 1M input tokens
@@ -87,15 +100,40 @@ gpt-4o-mini $0.150 / 1M input tokens
 gpt-4o-mini $0.600 / 1M output token
 text-embedding-3-small $0.020 / 1M tokens
 */
-func EstimateCost(llmModel string, inputTokens, outputTokens int) float64 {
-	switch llmModel {
-	case "gpt-4o":
-		return (float64(inputTokens) / 1000.0 * 0.0025) + (float64(outputTokens) / 1000.0 * 0.01)
-	case "gpt-4o-mini":
-		return (float64(inputTokens) / 1000.0 * 0.00015) + (float64(outputTokens) / 1000.0 * 0.0006)
-	case "text-embedding-3-small":
-		return float64(inputTokens) / 1000.0 * 0.00002 // $0.020 per 1M tokens
-	default:
+var DefaultPriceTable = PriceTable{
+	"gpt-4o":                 {InputPerMillion: 2.50, OutputPerMillion: 10.00},
+	"gpt-4o-mini":            {InputPerMillion: 0.150, OutputPerMillion: 0.600},
+	"gpt-4-turbo":            {InputPerMillion: 10.00, OutputPerMillion: 30.00},
+	"gpt-3.5-turbo":          {InputPerMillion: 0.50, OutputPerMillion: 1.50},
+	"text-embedding-3-small": {InputPerMillion: 0.020},
+	"text-embedding-3-large": {InputPerMillion: 0.130},
+	"text-embedding-ada-002": {InputPerMillion: 0.100},
+}
+
+// Cost calculates the cost in USD for the given model and token counts.
+// Unknown models cost 0.
+func (pt PriceTable) Cost(model string, inputTokens, outputTokens int) float64 {
+	price, ok := pt[model]
+	if !ok {
 		return 0
 	}
+	return float64(inputTokens)/1_000_000.0*price.InputPerMillion + float64(outputTokens)/1_000_000.0*price.OutputPerMillion
+}
+
+// Merge returns a new PriceTable with the entries of other overriding pt.
+func (pt PriceTable) Merge(other PriceTable) PriceTable {
+	merged := make(PriceTable, len(pt)+len(other))
+	for k, v := range pt {
+		merged[k] = v
+	}
+	for k, v := range other {
+		merged[k] = v
+	}
+	return merged
+}
+
+// EstimateCost calculates the estimated cost in USD for LLM API usage
+// based on input and output tokens, using DefaultPriceTable.
+func EstimateCost(llmModel string, inputTokens, outputTokens int) float64 {
+	return DefaultPriceTable.Cost(llmModel, inputTokens, outputTokens)
 }
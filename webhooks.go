@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Memory change events sent to the webhooks
+const (
+	EventAdd      = "ADD"
+	EventUpdate   = "UPDATE"
+	EventDelete   = "DELETE"
+	EventConflict = "CONFLICT"
+)
+
+// WebhooksConfig - outgoing webhooks fired on memory changes
+type WebhooksConfig struct {
+	Endpoints      []WebhookEndpoint `json:"endpoints,omitempty"`
+	MaxAttempts    int               `json:"max_attempts" default:"10"`    // a delivery is given up after this many failed attempts
+	TimeoutSeconds int               `json:"timeout_seconds" default:"10"` // per attempt
+}
+
+// WebhookEndpoint - a receiver of memory events. Deliveries are POSTed as JSON and signed
+// with HMAC-SHA256 of "<timestamp>.<body>" using Secret, see signWebhook.
+type WebhookEndpoint struct {
+	Name     string   `json:"name,omitempty"` // defaults to the URL, identifies the endpoint in the outbox
+	URL      string   `json:"url"`
+	Secret   string   `json:"secret,omitempty"`
+	Events   []string `json:"events,omitempty"`    // ADD, UPDATE, DELETE, CONFLICT, ARCHIVE, FORGET, EXPIRE, MERGE, CONSOLIDATE; empty for all
+	AgentIDs []string `json:"agent_ids,omitempty"` // empty for all
+}
+
+func (e WebhookEndpoint) name() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	return e.URL
+}
+
+// matches reports whether the endpoint subscribed to the event of agentID
+func (e WebhookEndpoint) matches(event string, agentID string) bool {
+	if len(e.Events) > 0 && !slices.ContainsFunc(e.Events, func(s string) bool { return strings.EqualFold(s, event) }) {
+		return false
+	}
+	return len(e.AgentIDs) == 0 || slices.Contains(e.AgentIDs, agentID)
+}
+
+func (wc WebhooksConfig) validate() []error {
+	errs := []error{}
+	names := map[string]bool{}
+	for i, endpoint := range wc.Endpoints {
+		if u, err := url.Parse(endpoint.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("webhooks.endpoints[%d].url must be an http or https URL", i))
+		}
+		for _, event := range endpoint.Events {
+			if !slices.Contains([]string{EventAdd, EventUpdate, EventDelete, EventConflict, EventArchive, EventForget, EventExpire, EventMerge, EventConsolidate}, strings.ToUpper(event)) {
+				errs = append(errs, fmt.Errorf("webhooks.endpoints[%d].events: unknown event %q", i, event))
+			}
+		}
+		if names[endpoint.name()] {
+			errs = append(errs, fmt.Errorf("webhooks.endpoints[%d]: duplicate name %q", i, endpoint.name()))
+		}
+		names[endpoint.name()] = true
+	}
+	return errs
+}
+
+// MemoryEvent - body of a webhook delivery
+type MemoryEvent struct {
+	ID           string                 `json:"id"` // unique per event, receivers can dedupe retries with it
+	Event        string                 `json:"event"`
+	MemoryID     string                 `json:"memory_id,omitempty"`
+	Data         string                 `json:"data,omitempty"`
+	PreviousData string                 `json:"previous_data,omitempty"`
+	UserID       string                 `json:"user_id,omitempty"`
+	AgentID      string                 `json:"agent_id,omitempty"`
+	RunID        string                 `json:"run_id,omitempty"`
+	TenantID     string                 `json:"tenant_id,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp    string                 `json:"timestamp"`
+}
+
+// emitMemoryEvent stores the event in the webhook outbox for every subscribed endpoint.
+// Errors are logged: the memory change itself already happened.
+func (m *Memory) emitMemoryEvent(event string, memoryID string, data string, previousData string, payload map[string]interface{}) {
+	if len(m.config.Webhooks.Endpoints) == 0 {
+		return
+	}
+	str := func(key string) string {
+		s, _ := payload[key].(string)
+		return s
+	}
+	memoryEvent := MemoryEvent{
+		ID:           uuid.New().String(),
+		Event:        event,
+		MemoryID:     plainPointID(memoryID),
+		Data:         data,
+		PreviousData: previousData,
+		UserID:       str("user_id"),
+		AgentID:      str("agent_id"),
+		RunID:        str("run_id"),
+		TenantID:     str("tenant_id"),
+		Metadata:     map[string]interface{}{},
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, key := range []string{"scope", "sentiment", "related_entities", "related_events", "tags", "conflict"} {
+		if v, ok := payload[key]; ok {
+			memoryEvent.Metadata[key] = v
+		}
+	}
+	body, err := json.Marshal(memoryEvent)
+	if err != nil {
+		log.Printf("Error marshaling %s event: %v", event, err)
+		return
+	}
+
+	queued := false
+	for _, endpoint := range m.config.Webhooks.Endpoints {
+		if !endpoint.matches(event, memoryEvent.AgentID) {
+			continue
+		}
+		if _, err := m.db.EnqueueWebhook(endpoint.name(), event, string(body)); err != nil {
+			log.Printf("Error queuing %s event for webhook %s: %v", event, endpoint.name(), err)
+			continue
+		}
+		queued = true
+	}
+	if queued {
+		select {
+		case m.webhookNotify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// signWebhook returns the X-MemGo-Signature of a delivery: "sha256=" and the hex
+// HMAC-SHA256 of "<timestamp>.<body>". Receivers recompute it with the shared secret
+// and reject old timestamps to prevent replays.
+func signWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff returns the delay before the attempt following the given number of failed
+// attempts: 10s doubling up to an hour
+func webhookBackoff(failed int) time.Duration {
+	delay := 10 * time.Second
+	for i := 1; i < failed && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, time.Hour)
+}
+
+// StartWebhookDispatcher delivers the outbox until ctx is done. Every event is delivered at
+// least once: it stays in the outbox until the endpoint answers 2xx or MaxAttempts is reached,
+// including across restarts. Events written by other processes sharing the history database
+// (e.g. the CLI) are delivered too.
+func (m *Memory) StartWebhookDispatcher(ctx context.Context) {
+	if len(m.config.Webhooks.Endpoints) == 0 {
+		return
+	}
+	client := &http.Client{Timeout: time.Duration(max(m.config.Webhooks.TimeoutSeconds, 1)) * time.Second}
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			m.deliverDueWebhooks(ctx, client)
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.webhookNotify:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (m *Memory) deliverDueWebhooks(ctx context.Context, client *http.Client) {
+	endpoints := map[string]WebhookEndpoint{}
+	for _, endpoint := range m.config.Webhooks.Endpoints {
+		endpoints[endpoint.name()] = endpoint
+	}
+	for ctx.Err() == nil {
+		deliveries, err := m.db.DueWebhooks(50)
+		if err != nil {
+			log.Printf("Error reading webhook outbox: %v", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+		for _, delivery := range deliveries {
+			endpoint, ok := endpoints[delivery.Endpoint]
+			if !ok {
+				if err := m.db.MarkWebhookAttemptFailed(delivery.ID, "endpoint no longer configured", 0); err != nil {
+					log.Printf("Error updating webhook outbox: %v", err)
+				}
+				continue
+			}
+
+			err := postWebhook(ctx, client, endpoint, delivery.ID, delivery.Event, []byte(delivery.Payload))
+			if err == nil {
+				err = m.db.MarkWebhookDelivered(delivery.ID)
+			} else {
+				failed := delivery.Attempts + 1
+				retryAfter := time.Duration(0)
+				if failed < m.config.Webhooks.MaxAttempts {
+					retryAfter = webhookBackoff(failed)
+				}
+				log.Printf("Webhook %s delivery %s attempt %d failed: %v", endpoint.name(), delivery.ID, failed, err)
+				err = m.db.MarkWebhookAttemptFailed(delivery.ID, err.Error(), retryAfter)
+			}
+			if err != nil {
+				log.Printf("Error updating webhook outbox: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// postWebhook sends one delivery, any answer other than 2xx is an error
+func postWebhook(ctx context.Context, client *http.Client, endpoint WebhookEndpoint, deliveryID string, event string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "memGo-webhooks")
+	req.Header.Set("X-MemGo-Event", event)
+	req.Header.Set("X-MemGo-Delivery", deliveryID)
+	req.Header.Set("X-MemGo-Timestamp", timestamp)
+	if endpoint.Secret != "" {
+		req.Header.Set("X-MemGo-Signature", signWebhook(endpoint.Secret, timestamp, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("endpoint answered " + resp.Status)
+	}
+	return nil
+}
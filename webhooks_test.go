@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matigumma/memGo/sqlitemanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	db, err := sqlitemanager.NewSQLiteManager(filepath.Join(t.TempDir(), "history.db"))
+	assert.NoError(t, err)
+
+	received := []MemoryEvent{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, signWebhook("s3cret", r.Header.Get("X-MemGo-Timestamp"), body), r.Header.Get("X-MemGo-Signature"))
+		var event MemoryEvent
+		assert.NoError(t, json.Unmarshal(body, &event))
+		received = append(received, event)
+	}))
+	defer server.Close()
+
+	config := NewMemoryConfig()
+	config.Webhooks.Endpoints = []WebhookEndpoint{
+		{URL: server.URL + "/crm", Secret: "s3cret", Events: []string{"add", "delete", "archive", "forget", "expire", "merge", "consolidate"}, AgentIDs: []string{"whatsapp"}},
+		{Name: "analytics", URL: server.URL + "/down"},
+	}
+	assert.Empty(t, config.Webhooks.validate())
+	m := &Memory{config: config, db: db, webhookNotify: make(chan struct{}, 1)}
+
+	payload := map[string]interface{}{"user_id": "Blas", "agent_id": "whatsapp", "tags": []string{"viajes"}}
+	m.emitMemoryEvent(EventUpdate, "1", "only for analytics", "", payload)
+	m.emitMemoryEvent(EventAdd, `uuid:"4d3c1f0e-5b8a-4f44-9d3e-2a1b0c9d8e7f"`, "Viaja a Córdoba", "", payload)
+	m.emitMemoryEvent(EventAdd, "2", "other agent", "", map[string]interface{}{"agent_id": "slack"})
+
+	m.deliverDueWebhooks(context.Background(), server.Client())
+
+	assert.Len(t, received, 1)
+	assert.Equal(t, EventAdd, received[0].Event)
+	assert.Equal(t, "4d3c1f0e-5b8a-4f44-9d3e-2a1b0c9d8e7f", received[0].MemoryID)
+	assert.Equal(t, "Blas", received[0].UserID)
+
+	// the failed analytics deliveries wait in the outbox for their retry
+	due, err := db.DueWebhooks(10)
+	assert.NoError(t, err)
+	assert.Empty(t, due)
+	assert.Equal(t, 10*time.Second, webhookBackoff(1))
+	assert.Equal(t, 40*time.Second, webhookBackoff(3))
+	assert.Equal(t, time.Hour, webhookBackoff(20))
+}